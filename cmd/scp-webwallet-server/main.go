@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"time"
@@ -28,7 +29,9 @@ var (
 		Headless:                      true,
 		Port:                          4300,
 		Dir:                           build.ScPrimeWebWalletDir(),
-		CheckTokenExpirationFrequency: 1 * time.Hour, // default
+		CheckTokenExpirationFrequency: 1 * time.Hour,    // default
+		SessionIdleTimeout:            15 * time.Minute, // default
+		PersistSessions:               false,
 	}
 )
 
@@ -41,6 +44,11 @@ func die(err error) {
 
 // main starts the daemon.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		runTokenCmd(os.Args[2:])
+	}
+	flag.DurationVar(&webWalletConfig.SessionIdleTimeout, "session-idle-timeout", webWalletConfig.SessionIdleTimeout, "how long an idle session keeps its wallets unlocked, 0 never expires")
+	flag.Parse()
 	// Start the ScPrime web wallet daemon.
 	// the startDaemon method will only return when it is shutting down.
 	err := daemon.StartDaemon(&webWalletConfig)
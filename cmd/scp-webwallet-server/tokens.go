@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/scpcorp/webwallet/modules/apitokens"
+)
+
+// tokenUsage describes the token subcommand.
+const tokenUsage = `usage:
+  scp-webwallet-server token create -name <name> [-scope read-only|spend|admin] [-expires 720h]
+  scp-webwallet-server token list
+  scp-webwallet-server token revoke <id>`
+
+// errTokenUsage is returned when the token subcommand is misused.
+var errTokenUsage = errors.New(tokenUsage)
+
+// tokenCmd manages the API tokens stored under the web wallet directory.
+func tokenCmd(dir string, args []string) error {
+	if len(args) == 0 {
+		return errTokenUsage
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		name := fs.String("name", "", "name of the token")
+		scope := fs.String("scope", string(apitokens.ScopeReadOnly), "scope of the token")
+		expires := fs.Duration("expires", 30*24*time.Hour, "lifetime of the token, 0 never expires")
+		if err := fs.Parse(args[1:]); err != nil || *name == "" {
+			return errTokenUsage
+		}
+		s, err := apitokens.ParseScope(*scope)
+		if err != nil {
+			return err
+		}
+		secret, token, err := apitokens.Create(dir, *name, s, *expires)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s token %s (%s).\n", token.Scope, token.ID, token.Name)
+		fmt.Println("Store this secret now, it will not be shown again:")
+		fmt.Println(secret)
+	case "list":
+		tokens, err := apitokens.List(dir)
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			expires := "never"
+			if !t.Expires.IsZero() {
+				expires = t.Expires.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\texpires %s\n", t.ID, t.Scope, t.Name, expires)
+		}
+	case "revoke":
+		if len(args) != 2 {
+			return errTokenUsage
+		}
+		if err := apitokens.Revoke(dir, args[1]); err != nil {
+			return err
+		}
+		fmt.Println("Revoked token", args[1])
+	default:
+		return errTokenUsage
+	}
+	return nil
+}
+
+// runTokenCmd runs the token subcommand and exits.
+func runTokenCmd(args []string) {
+	err := tokenCmd(webWalletConfig.Dir, args)
+	if errors.Is(err, errTokenUsage) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeUsage)
+	}
+	if err != nil {
+		die(err)
+	}
+	os.Exit(0)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"time"
@@ -29,7 +30,9 @@ var (
 		Headless:                      false,
 		Port:                          4300,
 		Dir:                           build.ScPrimeWebWalletDir(),
-		CheckTokenExpirationFrequency: 1 * time.Hour, // default
+		CheckTokenExpirationFrequency: 1 * time.Hour,    // default
+		SessionIdleTimeout:            15 * time.Minute, // default
+		PersistSessions:               true,
 	}
 )
 
@@ -45,6 +48,8 @@ func die(err error) {
 
 // main starts the daemon.
 func main() {
+	flag.DurationVar(&webWalletConfig.SessionIdleTimeout, "session-idle-timeout", webWalletConfig.SessionIdleTimeout, "how long an idle session keeps its wallets unlocked, 0 never expires")
+	flag.Parse()
 	// Start the ScPrime web wallet daemon.
 	// the startDaemon method will only return when it is shutting down.
 	err := daemon.StartDaemon(&webWalletConfig)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 
 	mnemonics "gitlab.com/NebulousLabs/entropy-mnemonics"
@@ -48,9 +49,52 @@ func WasmAddressFromSeed() js.Func {
 	return jsonFunc
 }
 
+// WasmSignTransaction signs an offline transaction with the seed.
+// requires exactly two parameters.
+// first parameter must be the wallet seed supplied as a string
+// second parameter must be the unsigned transaction file supplied as a string
+// returns an object holding the signed transaction file, the number of
+// signatures added and a summary of the transaction, or an error message.
+func WasmSignTransaction() js.Func {
+	jsonFunc := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 2 {
+			fmt.Println("invalid number of arguments passed")
+			return nil
+		}
+		fail := func(err error) interface{} {
+			fmt.Printf("unable to sign transaction: %s\n", err)
+			return map[string]interface{}{"error": err.Error()}
+		}
+		seed, err := wallet.StringToSeed(args[0].String(), mnemonics.DictionaryID("english"))
+		if err != nil {
+			return fail(err)
+		}
+		var txn wallet.OfflineTransaction
+		err = json.Unmarshal([]byte(args[1].String()), &txn)
+		if err != nil {
+			return fail(err)
+		}
+		signed, err := txn.SignWithSeed(seed)
+		if err != nil {
+			return fail(err)
+		}
+		signedJSON, err := json.MarshalIndent(txn, "", "  ")
+		if err != nil {
+			return fail(err)
+		}
+		return map[string]interface{}{
+			"transaction": string(signedJSON),
+			"signatures":  signed,
+			"summary":     txn.Summary(),
+		}
+	})
+	return jsonFunc
+}
+
 func main() {
 	fmt.Println("Go Web Assembly")
 	js.Global().Set("wasmAddressFromSeed", WasmAddressFromSeed())
 	js.Global().Set("wasmNewWalletSeed", WasmNewWalletSeed())
+	js.Global().Set("wasmSignTransaction", WasmSignTransaction())
 	<-make(chan bool)
 }
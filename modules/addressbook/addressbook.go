@@ -0,0 +1,274 @@
+package addressbook
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AddressBookFile is the file in a wallet directory that the address book is
+// stored in.
+const AddressBookFile = "addressbook.json"
+
+// csvHeader is the header row of an exported address book.
+var csvHeader = []string{"name", "address", "coin_type", "notes"}
+
+var (
+	// ErrEntryNotFound is returned when no entry has the supplied ID.
+	ErrEntryNotFound = errors.New("address book entry was not found")
+	// ErrDuplicateName is returned when another entry already has the name.
+	ErrDuplicateName = errors.New("another address book entry has the same name")
+	// ErrMissingName is returned when an entry has no name.
+	ErrMissingName = errors.New("address book entry must have a name")
+	// ErrUnknownCoinType is returned when the default coin type of an entry
+	// is not one of SCP, SPF-A or SPF-B.
+	ErrUnknownCoinType = errors.New("unknown coin type")
+
+	mu sync.Mutex
+)
+
+// Entry is a named address that coins are sent to repeatedly.
+type Entry struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Notes    string `json:"notes"`
+	CoinType string `json:"coin_type"`
+}
+
+// normalize trims the entry and checks its name and default coin type. An
+// empty coin type defaults to SCP.
+func (e *Entry) normalize() error {
+	e.Name = strings.TrimSpace(e.Name)
+	e.Address = strings.TrimSpace(e.Address)
+	e.Notes = strings.TrimSpace(e.Notes)
+	e.CoinType = strings.ToUpper(strings.TrimSpace(e.CoinType))
+	if e.Name == "" {
+		return ErrMissingName
+	}
+	switch e.CoinType {
+	case "":
+		e.CoinType = "SCP"
+	case "SCP", "SPF-A", "SPF-B":
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownCoinType, e.CoinType)
+	}
+	return nil
+}
+
+// List returns the entries of the wallet directory's address book.
+func List(walletDir string) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return load(walletDir)
+}
+
+// Lookup returns the entry whose name matches, ignoring case.
+func Lookup(entries []Entry, name string) (Entry, bool) {
+	name = strings.TrimSpace(name)
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Add adds the entry to the address book and returns it with its new ID.
+func Add(walletDir string, entry Entry) (Entry, error) {
+	if err := entry.normalize(); err != nil {
+		return Entry{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := load(walletDir)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, exists := Lookup(entries, entry.Name); exists {
+		return Entry{}, ErrDuplicateName
+	}
+	entry.ID, err = randomHex(8)
+	if err != nil {
+		return Entry{}, err
+	}
+	entries = append(entries, entry)
+	return entry, save(walletDir, entries)
+}
+
+// Update replaces the entry that has the same ID.
+func Update(walletDir string, entry Entry) (Entry, error) {
+	if err := entry.normalize(); err != nil {
+		return Entry{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := load(walletDir)
+	if err != nil {
+		return Entry{}, err
+	}
+	if existing, exists := Lookup(entries, entry.Name); exists && existing.ID != entry.ID {
+		return Entry{}, ErrDuplicateName
+	}
+	for i := range entries {
+		if entries[i].ID == entry.ID {
+			entries[i] = entry
+			return entry, save(walletDir, entries)
+		}
+	}
+	return Entry{}, ErrEntryNotFound
+}
+
+// Remove deletes the entry with the supplied ID.
+func Remove(walletDir string, id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := load(walletDir)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		if entry.ID == id {
+			entries = append(entries[:i], entries[i+1:]...)
+			return save(walletDir, entries)
+		}
+	}
+	return ErrEntryNotFound
+}
+
+// Import adds the entries to the address book. Entries whose name is already
+// taken replace the existing entry when overwrite is true and are skipped
+// otherwise. It returns the number of entries added or replaced.
+func Import(walletDir string, imported []Entry, overwrite bool) (int, error) {
+	for i := range imported {
+		if err := imported[i].normalize(); err != nil {
+			return 0, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := load(walletDir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range imported {
+		replaced := false
+		for i := range entries {
+			if !strings.EqualFold(entries[i].Name, entry.Name) {
+				continue
+			}
+			if overwrite {
+				entry.ID = entries[i].ID
+				entries[i] = entry
+				count++
+			}
+			replaced = true
+			break
+		}
+		if replaced {
+			continue
+		}
+		entry.ID, err = randomHex(8)
+		if err != nil {
+			return 0, err
+		}
+		entries = append(entries, entry)
+		count++
+	}
+	return count, save(walletDir, entries)
+}
+
+// WriteCSV writes the entries as CSV with a header row.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := cw.Write([]string{entry.Name, entry.Address, entry.CoinType, entry.Notes}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads entries written by WriteCSV. The header row is optional and
+// the coin type and notes columns may be left out.
+func ReadCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	lines, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for i, line := range lines {
+		if i == 0 && len(line) > 0 && strings.EqualFold(strings.TrimSpace(line[0]), csvHeader[0]) {
+			continue
+		}
+		if len(line) < 2 {
+			return nil, fmt.Errorf("line %d must have at least a name and an address", i+1)
+		}
+		entry := Entry{Name: line[0], Address: line[1]}
+		if len(line) > 2 {
+			entry.CoinType = line[2]
+		}
+		if len(line) > 3 {
+			entry.Notes = line[3]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// load reads the address book from disk. Callers must hold the lock.
+func load(walletDir string) ([]Entry, error) {
+	bytes, err := os.ReadFile(filepath.Join(walletDir, AddressBookFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	err = json.Unmarshal(bytes, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// save writes the address book to disk. Callers must hold the lock.
+func save(walletDir string, entries []Entry) error {
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(walletDir, AddressBookFile)
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
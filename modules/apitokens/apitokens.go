@@ -0,0 +1,252 @@
+package apitokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokensDir defines the directory that the api tokens are stored in
+const TokensDir = "tokens"
+
+// Scope defines what an api token is allowed to do.
+type Scope string
+
+const (
+	// ScopeReadOnly allows a token to read balances, addresses and transactions.
+	ScopeReadOnly Scope = "read-only"
+	// ScopeSpend allows a token to do everything a read-only token can and to
+	// send coins and generate addresses.
+	ScopeSpend Scope = "spend"
+	// ScopeAdmin allows a token to do everything, including unlocking wallets
+	// and managing tokens.
+	ScopeAdmin Scope = "admin"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is unknown or malformed.
+	ErrInvalidToken = errors.New("api token is not valid")
+	// ErrExpiredToken is returned when a token has expired.
+	ErrExpiredToken = errors.New("api token has expired")
+	// ErrUnknownScope is returned when a scope is not one of the known scopes.
+	ErrUnknownScope = errors.New("unknown api token scope")
+	// ErrTokenNotFound is returned when no token has the supplied ID.
+	ErrTokenNotFound = errors.New("api token was not found")
+
+	mu sync.Mutex
+)
+
+// Token describes an api token. Only the hash of the token secret is stored.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   Scope     `json:"scope"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// Expired returns true when the token has an expiration that has passed.
+func (t Token) Expired() bool {
+	return !t.Expires.IsZero() && time.Now().After(t.Expires)
+}
+
+// ParseScope converts a string to a Scope.
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeReadOnly, ScopeSpend, ScopeAdmin:
+		return Scope(s), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownScope, s)
+}
+
+// Allows returns true when the scope includes the required scope.
+func (s Scope) Allows(required Scope) bool {
+	return s.rank() >= required.rank() && required.rank() > 0
+}
+
+// rank orders the scopes so that wider scopes include narrower ones.
+func (s Scope) rank() int {
+	switch s {
+	case ScopeReadOnly:
+		return 1
+	case ScopeSpend:
+		return 2
+	case ScopeAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Create creates a new token and returns its secret. The secret is only
+// available at creation time. A ttl of zero creates a token that never expires.
+func Create(dataDir string, name string, scope Scope, ttl time.Duration) (string, Token, error) {
+	if _, err := ParseScope(string(scope)); err != nil {
+		return "", Token{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	tokens, err := load(dataDir)
+	if err != nil {
+		return "", Token{}, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Token{}, err
+	}
+	key, err := randomHex(32)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret := id + "." + key
+	token := Token{
+		ID:      id,
+		Name:    name,
+		Scope:   scope,
+		Hash:    hash(secret),
+		Created: time.Now(),
+	}
+	if ttl > 0 {
+		token.Expires = token.Created.Add(ttl)
+	}
+	tokens = append(tokens, token)
+	if err := save(dataDir, tokens); err != nil {
+		return "", Token{}, err
+	}
+	return secret, token, nil
+}
+
+// List returns all of the stored tokens.
+func List(dataDir string) ([]Token, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return load(dataDir)
+}
+
+// Revoke deletes the token with the supplied ID.
+func Revoke(dataDir string, id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	tokens, err := load(dataDir)
+	if err != nil {
+		return err
+	}
+	for i, token := range tokens {
+		if token.ID == id {
+			tokens = append(tokens[:i], tokens[i+1:]...)
+			return save(dataDir, tokens)
+		}
+	}
+	return ErrTokenNotFound
+}
+
+// Validate returns the token that matches the secret.
+func Validate(dataDir string, secret string) (Token, error) {
+	id := strings.SplitN(secret, ".", 2)[0]
+	mu.Lock()
+	defer mu.Unlock()
+	tokens, err := load(dataDir)
+	if err != nil {
+		return Token{}, err
+	}
+	for _, token := range tokens {
+		if token.ID != id {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash(secret))) != 1 {
+			return Token{}, ErrInvalidToken
+		}
+		if token.Expired() {
+			return Token{}, ErrExpiredToken
+		}
+		return token, nil
+	}
+	return Token{}, ErrInvalidToken
+}
+
+// RemoveExpired deletes all expired tokens and returns how many were deleted.
+func RemoveExpired(dataDir string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	tokens, err := load(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	var active []Token
+	for _, token := range tokens {
+		if !token.Expired() {
+			active = append(active, token)
+		}
+	}
+	removed := len(tokens) - len(active)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, save(dataDir, active)
+}
+
+// load reads the tokens from disk. Callers must hold the lock.
+func load(dataDir string) ([]Token, error) {
+	tokensFile := filepath.Join(dataDir, TokensDir, TokensDir+".json")
+	bytes, err := os.ReadFile(tokensFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tokens []Token
+	err = json.Unmarshal(bytes, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// save writes the tokens to disk. Callers must hold the lock.
+func save(dataDir string, tokens []Token) error {
+	tokensDir := filepath.Join(dataDir, TokensDir)
+	tokensFile := filepath.Join(tokensDir, TokensDir+".json")
+	_, err := os.Stat(tokensDir)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.MkdirAll(tokensDir, 0700)
+	}
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := tokensFile + ".tmp"
+	err = os.WriteFile(tmpFile, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, tokensFile)
+}
+
+// hash returns the hex encoded sha256 hash of the secret.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,248 @@
+package multisendjobs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// JobsFile is the file in a wallet directory that multisend jobs are stored
+// in.
+const JobsFile = "multisend_jobs.json"
+
+// The states of a part of a multisend job. A signed part was signed but its
+// broadcast was not recorded, so it may or may not have been sent.
+const (
+	StatePending   = "pending"
+	StateSigned    = "signed"
+	StateBroadcast = "broadcast"
+	StateFailed    = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned when the wallet has no such multisend job.
+	ErrJobNotFound = errors.New("multisend job not found")
+
+	mu sync.Mutex
+)
+
+// Output is a payment of a multisend job. Line is the line of the multisend
+// that requested it.
+type Output struct {
+	Line    int              `json:"line,omitempty"`
+	Value   types.Currency   `json:"value"`
+	Address types.UnlockHash `json:"address"`
+}
+
+// Part is a transaction of a multisend job that pays some of its outputs of
+// one coin type. The transactions of a signed part are kept until it is known
+// to be broadcast, so that it is only ever sent as it was signed.
+type Part struct {
+	FundType      string              `json:"fund_type"`
+	Outputs       []Output            `json:"outputs"`
+	State         string              `json:"state"`
+	TransactionID string              `json:"transaction_id,omitempty"`
+	Transactions  []types.Transaction `json:"transactions,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Job is a multisend and the state of each of its parts. Jobs that pay the
+// same outputs share the same key.
+type Job struct {
+	ID      string    `json:"id"`
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	Parts   []Part    `json:"parts"`
+}
+
+// jobsBook is the on-disk layout of a wallet's multisend jobs.
+type jobsBook struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// NewJob returns a job that pays the parts, which have not been sent yet.
+func NewJob(parts []Part) (Job, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Job{}, err
+	}
+	for i := range parts {
+		parts[i].State = StatePending
+	}
+	now := time.Now()
+	return Job{
+		ID:      hex.EncodeToString(b),
+		Key:     Key(parts),
+		Created: now,
+		Updated: now,
+		Parts:   parts,
+	}, nil
+}
+
+// Key hashes the coin types and outputs of the parts.
+func Key(parts []Part) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%s\n", part.FundType)
+		for _, output := range part.Outputs {
+			fmt.Fprintf(h, "%s %s\n", output.Value, output.Address)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Chunked returns true when the outputs of a coin type are split across
+// several parts.
+func (j Job) Chunked() bool {
+	seen := make(map[string]bool)
+	for _, part := range j.Parts {
+		if seen[part.FundType] {
+			return true
+		}
+		seen[part.FundType] = true
+	}
+	return false
+}
+
+// Complete returns true when every part of the job was broadcast.
+func (j Job) Complete() bool {
+	for _, part := range j.Parts {
+		if part.State != StateBroadcast {
+			return false
+		}
+	}
+	return true
+}
+
+// Unsent returns the coin types of the parts that were not broadcast.
+func (j Job) Unsent() []string {
+	var fundTypes []string
+	seen := make(map[string]bool)
+	for _, part := range j.Parts {
+		if part.State != StateBroadcast && !seen[part.FundType] {
+			seen[part.FundType] = true
+			fundTypes = append(fundTypes, part.FundType)
+		}
+	}
+	return fundTypes
+}
+
+// Sent returns the number of parts that were broadcast.
+func (j Job) Sent() int {
+	sent := 0
+	for _, part := range j.Parts {
+		if part.State == StateBroadcast {
+			sent++
+		}
+	}
+	return sent
+}
+
+// List returns the multisend jobs of the wallet directory, newest first.
+func List(walletDir string) ([]Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return nil, err
+	}
+	return book.Jobs, nil
+}
+
+// Get returns the multisend job with the ID.
+func Get(walletDir string, id string) (Job, error) {
+	jobs, err := List(walletDir)
+	if err != nil {
+		return Job{}, err
+	}
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return Job{}, ErrJobNotFound
+}
+
+// Latest returns the newest multisend job with the key.
+func Latest(walletDir string, key string) (Job, error) {
+	jobs, err := List(walletDir)
+	if err != nil {
+		return Job{}, err
+	}
+	for _, job := range jobs {
+		if job.Key == key {
+			return job, nil
+		}
+	}
+	return Job{}, ErrJobNotFound
+}
+
+// Save adds the job or replaces the job with the same ID.
+func Save(walletDir string, job Job) (Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Updated = time.Now()
+	for i := range book.Jobs {
+		if book.Jobs[i].ID == job.ID {
+			book.Jobs = append(book.Jobs[:i], book.Jobs[i+1:]...)
+			break
+		}
+	}
+	book.Jobs = append(book.Jobs, job)
+	sort.SliceStable(book.Jobs, func(i, j int) bool {
+		return book.Jobs[i].Created.After(book.Jobs[j].Created)
+	})
+	return job, save(walletDir, book)
+}
+
+// load reads the jobs from disk. Callers must hold the lock.
+func load(walletDir string) (jobsBook, error) {
+	book := jobsBook{Jobs: []Job{}}
+	bytes, err := os.ReadFile(filepath.Join(walletDir, JobsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	}
+	if err != nil {
+		return book, err
+	}
+	err = json.Unmarshal(bytes, &book)
+	if err != nil {
+		return book, err
+	}
+	if book.Jobs == nil {
+		book.Jobs = []Job{}
+	}
+	return book, nil
+}
+
+// save writes the jobs to disk. Callers must hold the lock.
+func save(walletDir string, book jobsBook) error {
+	bytes, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(walletDir, JobsFile)
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
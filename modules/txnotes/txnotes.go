@@ -0,0 +1,249 @@
+package txnotes
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NotesFile is the file in a wallet directory that transaction notes are
+// stored in.
+const NotesFile = "notes.json"
+
+var (
+	// ErrNoteNotFound is returned when the transaction has no note.
+	ErrNoteNotFound = errors.New("transaction has no note")
+	// ErrInvalidTransactionID is returned when a note is not keyed by a full
+	// transaction ID.
+	ErrInvalidTransactionID = errors.New("transaction ID must be 64 hex characters")
+
+	mu sync.Mutex
+)
+
+// Note is the note and tags attached to a transaction.
+type Note struct {
+	TransactionID string   `json:"transaction_id"`
+	Note          string   `json:"note"`
+	Tags          []string `json:"tags"`
+}
+
+// notesBook is the on-disk layout of a wallet's notes. Migrated records that
+// the notes the GUI used to keep in browser storage were imported.
+type notesBook struct {
+	Migrated bool   `json:"migrated"`
+	Notes    []Note `json:"notes"`
+}
+
+// normalize trims the note, checks its transaction ID and removes empty and
+// duplicate tags.
+func (n *Note) normalize() error {
+	n.TransactionID = strings.ToLower(strings.TrimSpace(n.TransactionID))
+	n.Note = strings.TrimSpace(n.Note)
+	if b, err := hex.DecodeString(n.TransactionID); err != nil || len(b) != 32 {
+		return ErrInvalidTransactionID
+	}
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range n.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	n.Tags = tags
+	return nil
+}
+
+// empty returns true when the note has neither text nor tags.
+func (n Note) empty() bool {
+	return n.Note == "" && len(n.Tags) == 0
+}
+
+// ParseTags splits a comma separated list of tags.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// List returns the notes of the wallet directory sorted by transaction ID.
+func List(walletDir string) ([]Note, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return nil, err
+	}
+	return book.Notes, nil
+}
+
+// ByTransaction maps the notes by their transaction IDs.
+func ByTransaction(notes []Note) map[string]Note {
+	m := make(map[string]Note)
+	for _, note := range notes {
+		m[note.TransactionID] = note
+	}
+	return m
+}
+
+// Get returns the note of the transaction.
+func Get(walletDir string, transactionID string) (Note, error) {
+	notes, err := List(walletDir)
+	if err != nil {
+		return Note{}, err
+	}
+	note, exists := ByTransaction(notes)[strings.ToLower(strings.TrimSpace(transactionID))]
+	if !exists {
+		return Note{}, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+// Set replaces the note of its transaction. A note without text or tags is
+// removed.
+func Set(walletDir string, note Note) (Note, error) {
+	if err := note.normalize(); err != nil {
+		return Note{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return Note{}, err
+	}
+	book.Notes = put(book.Notes, note)
+	return note, save(walletDir, book)
+}
+
+// Remove deletes the note of the transaction.
+func Remove(walletDir string, transactionID string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return err
+	}
+	transactionID = strings.ToLower(strings.TrimSpace(transactionID))
+	for i, note := range book.Notes {
+		if note.TransactionID == transactionID {
+			book.Notes = append(book.Notes[:i], book.Notes[i+1:]...)
+			return save(walletDir, book)
+		}
+	}
+	return ErrNoteNotFound
+}
+
+// Import adds the notes. Notes of transactions that already have one replace
+// it when overwrite is true and are skipped otherwise. It returns the number
+// of notes added or replaced.
+func Import(walletDir string, imported []Note, overwrite bool) (int, error) {
+	return importNotes(walletDir, imported, overwrite, false)
+}
+
+// Migrate imports the notes that were kept in browser storage without
+// overwriting existing notes and records that the wallet was migrated.
+func Migrate(walletDir string, imported []Note) (int, error) {
+	return importNotes(walletDir, imported, false, true)
+}
+
+// Migrated returns true when the browser storage notes of the wallet were
+// imported.
+func Migrated(walletDir string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return false, err
+	}
+	return book.Migrated, nil
+}
+
+// importNotes adds the notes and optionally marks the wallet as migrated.
+func importNotes(walletDir string, imported []Note, overwrite bool, migrated bool) (int, error) {
+	for i := range imported {
+		if err := imported[i].normalize(); err != nil {
+			return 0, err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	book, err := load(walletDir)
+	if err != nil {
+		return 0, err
+	}
+	existing := ByTransaction(book.Notes)
+	count := 0
+	for _, note := range imported {
+		if _, exists := existing[note.TransactionID]; (exists && !overwrite) || note.empty() {
+			continue
+		}
+		book.Notes = put(book.Notes, note)
+		count++
+	}
+	book.Migrated = book.Migrated || migrated
+	return count, save(walletDir, book)
+}
+
+// put replaces or adds the note, removing it when it is empty, and keeps the
+// notes sorted by transaction ID.
+func put(notes []Note, note Note) []Note {
+	for i := range notes {
+		if notes[i].TransactionID == note.TransactionID {
+			notes = append(notes[:i], notes[i+1:]...)
+			break
+		}
+	}
+	if !note.empty() {
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].TransactionID < notes[j].TransactionID
+	})
+	return notes
+}
+
+// load reads the notes from disk. Callers must hold the lock.
+func load(walletDir string) (notesBook, error) {
+	book := notesBook{Notes: []Note{}}
+	bytes, err := os.ReadFile(filepath.Join(walletDir, NotesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	}
+	if err != nil {
+		return book, err
+	}
+	err = json.Unmarshal(bytes, &book)
+	if err != nil {
+		return book, err
+	}
+	if book.Notes == nil {
+		book.Notes = []Note{}
+	}
+	return book, nil
+}
+
+// save writes the notes to disk. Callers must hold the lock.
+func save(walletDir string, book notesBook) error {
+	bytes, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(walletDir, NotesFile)
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
@@ -57,6 +57,9 @@ var privacyHTMLTemplate string
 //go:embed resources/transaction_templates/history_template.html
 var transactionsHistoryHTMLTemplate string
 
+//go:embed resources/transaction_templates/history_filter_template.html
+var transactionsHistoryFilterTemplate string
+
 //go:embed resources/transaction_templates/info_template.html
 var transactionInfoTemplate string
 
@@ -117,9 +120,75 @@ var expandedMenuForm string
 //go:embed resources/forms/explain_whale.html
 var explainWhaleForm string
 
+//go:embed resources/forms/multisend_report.html
+var multisendReportForm string
+
+//go:embed resources/forms/multisend_report_close.html
+var multisendReportCloseForm string
+
+//go:embed resources/forms/multisend_job.html
+var multisendJobForm string
+
+//go:embed resources/forms/retry_multisend.html
+var retryMultisendForm string
+
+//go:embed resources/forms/multisend_jobs.html
+var multisendJobsForm string
+
+//go:embed resources/forms/export_history.html
+var exportHistoryForm string
+
 //go:embed resources/forms/import_export_notes.html
 var importExportNotesForm string
 
+//go:embed resources/forms/api_tokens.html
+var apiTokensForm string
+
+//go:embed resources/forms/confirm_send.html
+var confirmSendForm string
+
+//go:embed resources/forms/coin_control.html
+var coinControlForm string
+
+//go:embed resources/forms/consolidate.html
+var consolidateForm string
+
+//go:embed resources/forms/consolidate_plan.html
+var consolidatePlanForm string
+
+//go:embed resources/forms/sweep_seed.html
+var sweepSeedForm string
+
+//go:embed resources/forms/manage_wallets.html
+var manageWalletsForm string
+
+//go:embed resources/forms/watch_only.html
+var watchOnlyForm string
+
+//go:embed resources/forms/offline_signing_menu.html
+var offlineSigningMenuForm string
+
+//go:embed resources/forms/export_unsigned.html
+var exportUnsignedForm string
+
+//go:embed resources/forms/broadcast_signed.html
+var broadcastSignedForm string
+
+//go:embed resources/forms/timelock_receive.html
+var timelockReceiveForm string
+
+//go:embed resources/forms/address_book.html
+var addressBookForm string
+
+//go:embed resources/forms/multisig.html
+var multisigForm string
+
+//go:embed resources/forms/multisig_transaction.html
+var multisigTransactionForm string
+
+//go:embed resources/forms/wallet_switcher.html
+var walletSwitcherForm string
+
 // Logo returns the Logo.
 func Logo() []byte {
 	return logo
@@ -205,6 +274,11 @@ func TransactionsHistoryHTMLTemplate() string {
 	return transactionsHistoryHTMLTemplate
 }
 
+// TransactionsHistoryFilterTemplate returns the transaction history filter form
+func TransactionsHistoryFilterTemplate() string {
+	return transactionsHistoryFilterTemplate
+}
+
 // TransactionInfoTemplate returns an HTML template
 func TransactionInfoTemplate() string {
 	return transactionInfoTemplate
@@ -305,7 +379,119 @@ func CollapsedMenuForm() string {
 	return collapsedMenuForm
 }
 
+// MultisendReportForm returns the multisend validation report form
+func MultisendReportForm() string {
+	return multisendReportForm
+}
+
+// MultisendReportCloseForm returns the form that closes a multisend report
+// that cannot be sent
+func MultisendReportCloseForm() string {
+	return multisendReportCloseForm
+}
+
+// MultisendJobForm returns the form that shows the parts of a multisend job
+func MultisendJobForm() string {
+	return multisendJobForm
+}
+
+// RetryMultisendForm returns the form that retries the failed parts of a
+// multisend job
+func RetryMultisendForm() string {
+	return retryMultisendForm
+}
+
+// MultisendJobsForm returns the form that lists the multisend jobs
+func MultisendJobsForm() string {
+	return multisendJobsForm
+}
+
+// ExportHistoryForm returns the transaction history export form
+func ExportHistoryForm() string {
+	return exportHistoryForm
+}
+
 // ImportExportNotesForm returns notes import and export form
 func ImportExportNotesForm() string {
 	return importExportNotesForm
 }
+
+// APITokensForm returns the api tokens form
+func APITokensForm() string {
+	return apiTokensForm
+}
+
+// WalletSwitcherForm returns the wallet switcher form
+func WalletSwitcherForm() string {
+	return walletSwitcherForm
+}
+
+// ManageWalletsForm returns the manage wallets form
+func ManageWalletsForm() string {
+	return manageWalletsForm
+}
+
+// ConfirmSendForm returns the confirm send form
+func ConfirmSendForm() string {
+	return confirmSendForm
+}
+
+// CoinControlForm returns the coin control form
+func CoinControlForm() string {
+	return coinControlForm
+}
+
+// ConsolidateForm returns the consolidate form
+func ConsolidateForm() string {
+	return consolidateForm
+}
+
+// ConsolidatePlanForm returns the consolidate plan form
+func ConsolidatePlanForm() string {
+	return consolidatePlanForm
+}
+
+// SweepSeedForm returns the sweep seed form
+func SweepSeedForm() string {
+	return sweepSeedForm
+}
+
+// WatchOnlyForm returns the watch-only wallet form
+func WatchOnlyForm() string {
+	return watchOnlyForm
+}
+
+// OfflineSigningMenuForm returns the offline signing menu buttons
+func OfflineSigningMenuForm() string {
+	return offlineSigningMenuForm
+}
+
+// ExportUnsignedForm returns the export unsigned transaction form
+func ExportUnsignedForm() string {
+	return exportUnsignedForm
+}
+
+// BroadcastSignedForm returns the broadcast signed transaction form
+func BroadcastSignedForm() string {
+	return broadcastSignedForm
+}
+
+// TimelockReceiveForm returns the timelocked addresses section of the receive form
+func TimelockReceiveForm() string {
+	return timelockReceiveForm
+}
+
+// AddressBookForm returns the address book form
+func AddressBookForm() string {
+	return addressBookForm
+}
+
+// MultisigForm returns the multisig form
+func MultisigForm() string {
+	return multisigForm
+}
+
+// MultisigTransactionForm returns the multisig transaction form
+func MultisigTransactionForm() string {
+	return multisigTransactionForm
+}
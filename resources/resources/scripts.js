@@ -59,7 +59,10 @@ function populateTxHistoryPage(json, sessionID) {
 </ul>
 `
   for (const line of txHistoryPage) {
-    const note = localStorage.getItem('note-'+line.short_transaction_id)
+    var note = line.note || ""
+    if (note === "" && json.migrate_notes) {
+      note = localStorage.getItem('note-'+line.short_transaction_id) || ""
+    }
     if (line.confirmed == "No") {
       txHistoryPageHtml = txHistoryPageHtml + `<ul class="row-gray">`
     } else {
@@ -84,12 +87,16 @@ function populateTxHistoryPage(json, sessionID) {
     ${line.confirmed}
   </li>
   <li class="col-6 center no-wrap white-underline pad-col">
-    <input type="text" onchange="localStorage.setItem('note-${line.short_transaction_id}', this.value)" value="${note!==null?note:''}">
+    <input type="text" class="note" placeholder="Note" onchange="saveNote('${sessionID}', '${line.transaction_id}', this.parentElement)" value="${escapeHTML(note)}">
+    <input type="text" class="tags" placeholder="Tags" title="Comma separated tags" onchange="saveNote('${sessionID}', '${line.transaction_id}', this.parentElement)" value="${escapeHTML((line.tags || []).join(', '))}">
   </li>
 </ul>
 `
   }
   txHistoryPageElement.innerHTML = txHistoryPageHtml
+  if (json.migrate_notes) {
+    migrateNotes(sessionID)
+  }
   var txHistoryPageCountElement = document.getElementById("tx_history_page_count")
   if (typeof(txHistoryPageCountElement) != 'undefined' && txHistoryPageCountElement != null) {
     txHistoryPageCountElement.innerHTML = json.total
@@ -108,6 +115,69 @@ function populateTxHistoryPage(json, sessionID) {
   }
   txHistoryPagesElement.innerHTML = txHistoryPagesHtml
 }
+function escapeHTML(text) {
+  var element = document.createElement("div")
+  element.innerText = text
+  return element.innerHTML.replace(/"/g, "&quot;").replace(/'/g, "&#39;")
+}
+function saveNote(sessionID, transactionID, element) {
+  var data = new FormData();
+  data.append("session_id", sessionID)
+  data.append("transaction_id", transactionID)
+  data.append("note", element.getElementsByClassName("note")[0].value)
+  data.append("tags", element.getElementsByClassName("tags")[0].value)
+  fetch("/gui/saveNote", {method: "POST", body: data})
+    .then(response => response.json())
+    .then(result => {
+      if (typeof(result.message) != 'undefined') {
+        alert(result.message)
+        return
+      }
+      localStorage.removeItem(sessionID + "_storedTxHistoryPageLines")
+    })
+    .catch(error => {
+      console.error("Error:", error);
+    })
+}
+// migrateNotes moves the notes that used to be kept in browser storage into
+// the wallet directory. Notes of other wallets are left in browser storage.
+var notesMigrating = false
+function migrateNotes(sessionID) {
+  if (notesMigrating) {
+    return
+  }
+  var notes = {}
+  var found = false
+  for (var i = 0; i < localStorage.length; i++) {
+    let key = localStorage.key(i)
+    if (key.startsWith("note-")) {
+      notes[key] = localStorage.getItem(key)
+      found = true
+    }
+  }
+  if (!found) {
+    return
+  }
+  notesMigrating = true
+  var data = new FormData();
+  data.append("session_id", sessionID)
+  data.append("notes", JSON.stringify(notes))
+  fetch("/gui/migrateNotes", {method: "POST", body: data})
+    .then(response => response.json())
+    .then(result => {
+      if (typeof(result.keys) == 'undefined') {
+        console.error("Error:", result.message);
+        return
+      }
+      for (const key of result.keys) {
+        localStorage.removeItem(key)
+      }
+      localStorage.removeItem(sessionID + "_storedTxHistoryPageLines")
+    })
+    .catch(error => {
+      console.error("Error:", error);
+    })
+}
 function refreshTxHistoryPage(sessionID) {
   var storedTxHistoryPageLinesKey = sessionID + "_storedTxHistoryPageLines"
   var storedTxHistoryPageLines = JSON.parse(localStorage.getItem(storedTxHistoryPageLinesKey) || "null");
@@ -125,7 +195,7 @@ function refreshTxHistoryPage(sessionID) {
   if (typeof(txHistoryPageElement) != 'undefined' && txHistoryPageElement != null) {
     var data = new FormData();
     data.append("session_id", sessionID)
-    fetch("/api/txHistoryPage", {method: "POST", body: data})
+    fetch("/gui/txHistoryPage", {method: "POST", body: data})
       .then(response => response.json())
       .then(result => {
         populateTxHistoryPage(result, sessionID)
@@ -216,6 +286,45 @@ function refreshBalance(sessionID) {
     setTimeout(() => {refreshBalance(sessionID);}, 50);
   }
 }
+function refreshOperation(sessionID) {
+  var operationProgress = document.getElementById("operation_progress")
+  if (typeof(operationProgress) == 'undefined' || operationProgress == null) {
+    return
+  }
+  var data = new FormData()
+  data.append("session_id", sessionID)
+  fetch("/gui/operation", {method: "POST", body: data})
+    .then(response => response.json())
+    .then(result => {
+      if (!result.running) {
+        document.getElementById("refreshForm").submit()
+        return
+      }
+      operationProgress.innerHTML = "(" + Math.floor(result.progress * 100) + "%)"
+      setTimeout(() => {refreshOperation(sessionID);}, 1000); // 1 second in milliseconds
+    })
+    .catch(error => {
+      setTimeout(() => {refreshOperation(sessionID);}, 1000); // 1 second in milliseconds
+    })
+}
+function sessionCountdown(seconds) {
+  var sessionExpiry = document.getElementById("session_expiry")
+  if (typeof(sessionExpiry) == 'undefined' || sessionExpiry == null) {
+    return
+  }
+  if (seconds < 0) {
+    sessionExpiry.style.display = "none"
+    return
+  }
+  var minutes = Math.floor(seconds / 60)
+  var remainder = seconds % 60
+  document.getElementById("session_countdown").innerHTML = minutes + ":" + (remainder < 10 ? "0" : "") + remainder
+  if (seconds === 0) {
+    window.location.href = "/"
+    return
+  }
+  setTimeout(() => {sessionCountdown(seconds - 1);}, 1000); // 1 second in milliseconds
+}
 function refreshBootstrapperProgress() {
   if (document.getElementsByClassName('bootstrapper-progress').length > 0) {
     fetch("/gui/bootstrapperProgress")
@@ -317,6 +426,10 @@ function newWalletSeed() {
 function addressFromSeed(seed) {
   return wasmAddressFromSeed(seed)
 }
+// signs the unsigned transaction file with the seed
+function signTransaction(seed, unsignedTransaction) {
+  return wasmSignTransaction(seed, unsignedTransaction)
+}
 refreshBootstrapperProgress()
 refreshConsensusBuilderProgress()
 
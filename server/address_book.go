@@ -0,0 +1,456 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/webwallet/modules/addressbook"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// APIAddressBook lists the entries of the active wallet's address book.
+type APIAddressBook struct {
+	Entries []addressbook.Entry `json:"entries"`
+}
+
+// APIImported is the number of address book entries or notes an import
+// added or replaced.
+type APIImported struct {
+	Imported int `json:"imported"`
+}
+
+// sessionWalletDir returns the directory of the session's active wallet,
+// which holds its address book, transaction notes and multisend jobs.
+func sessionWalletDir(sessionID string) (string, error) {
+	session, err := getSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if session.name == "" {
+		return "", errors.New("no wallet is open")
+	}
+	return walletPath(session.name, false), nil
+}
+
+// validateEntriesHelper checks that the address of every entry is valid.
+func validateEntriesHelper(entries []addressbook.Entry) error {
+	for _, entry := range entries {
+		if _, err := scanAddress(strings.TrimSpace(entry.Address)); err != nil {
+			return fmt.Errorf("address of %s is not valid", entry.Name)
+		}
+	}
+	return nil
+}
+
+// resolveDestination returns the address of the address book entry named
+// dest when dest is not an address itself.
+func resolveDestination(sessionID string, dest string) string {
+	if _, err := scanAddress(strings.TrimSpace(dest)); err == nil {
+		return dest
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		return dest
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		return dest
+	}
+	if entry, exists := addressbook.Lookup(entries, dest); exists {
+		return entry.Address
+	}
+	return dest
+}
+
+// resolveDestinationLines resolves the destination column of multispend
+// lines.
+func resolveDestinationLines(sessionID string, lines [][]string) [][]string {
+	for _, line := range lines {
+		if len(line) > 1 {
+			line[1] = resolveDestination(sessionID, line[1])
+		}
+	}
+	return lines
+}
+
+// addressBookOptionsHelper returns the datalist options that autocomplete a
+// destination from the address book.
+func addressBookOptionsHelper(sessionID string) string {
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		return ""
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		return ""
+	}
+	options := ""
+	for _, entry := range entries {
+		options += fmt.Sprintf("<option value='%s' label='%s' data-coin-type='%s'></option>\n", html.EscapeString(entry.Address), html.EscapeString(entry.Name), entry.CoinType)
+	}
+	return options
+}
+
+// coinTypeOptionsHelper returns the coin type options with the supplied one
+// selected.
+func coinTypeOptionsHelper(selected string) string {
+	options := ""
+	for _, coinType := range []string{"SCP", "SPF-A", "SPF-B"} {
+		attr := ""
+		if coinType == selected {
+			attr = " selected"
+		}
+		options += fmt.Sprintf("<option value='%s'%s>%s</option>\n", coinType, attr, coinType)
+	}
+	return options
+}
+
+// importEntriesHelper reads CSV or JSON entries, validates their addresses
+// and imports them.
+func importEntriesHelper(dir string, b []byte, format string, overwrite bool) (int, error) {
+	var entries []addressbook.Entry
+	if format == "" && strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		format = "json"
+	}
+	if format == "json" {
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return 0, fmt.Errorf("unable to read address book: %v", err)
+		}
+	} else {
+		var err error
+		entries, err = addressbook.ReadCSV(bytes.NewReader(b))
+		if err != nil {
+			return 0, fmt.Errorf("unable to read address book: %v", err)
+		}
+	}
+	if err := validateEntriesHelper(entries); err != nil {
+		return 0, err
+	}
+	return addressbook.Import(dir, entries, overwrite)
+}
+
+// writeAddressBookExport writes the address book as a downloadable CSV or
+// JSON file.
+func writeAddressBookExport(w http.ResponseWriter, entries []addressbook.Entry, format string) {
+	var b []byte
+	if format == "json" {
+		if entries == nil {
+			entries = []addressbook.Entry{}
+		}
+		b, _ = json.MarshalIndent(entries, "", "  ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-disposition", "attachment;filename=addressbook.json")
+	} else {
+		var buf bytes.Buffer
+		addressbook.WriteCSV(&buf, entries)
+		b = buf.Bytes()
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-disposition", "attachment;filename=addressbook.csv")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+func addressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to open address book: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	var rows string
+	var editing addressbook.Entry
+	for _, entry := range entries {
+		if entry.ID == req.FormValue("edit") {
+			editing = entry
+		}
+		actions := fmt.Sprintf(`<form class="inline-block" action="/gui/addressBook?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="edit" value="%s">
+      <button class="small-button" type="submit">Edit</button>
+    </form>
+    <form class="inline-block" action="/gui/deleteAddressBookEntry?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="entry_id" value="%s">
+      <button class="small-button" type="submit">Delete</button>
+    </form>`, entry.ID, entry.ID)
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class=\"center no-wrap\">%s</td></tr>\n",
+			html.EscapeString(entry.Name), html.EscapeString(entry.Address), entry.CoinType, html.EscapeString(entry.Notes), actions)
+	}
+	if rows == "" {
+		rows = "<tr><td colspan='5'>The address book is empty.</td></tr>"
+	}
+	form := resources.AddressBookForm()
+	form = strings.Replace(form, "&ADDRESS_BOOK_ROWS;", rows, -1)
+	form = strings.Replace(form, "&ENTRY_ID;", editing.ID, -1)
+	form = strings.Replace(form, "&ENTRY_NAME;", html.EscapeString(editing.Name), -1)
+	form = strings.Replace(form, "&ENTRY_ADDRESS;", html.EscapeString(editing.Address), -1)
+	form = strings.Replace(form, "&ENTRY_NOTES;", html.EscapeString(editing.Notes), -1)
+	form = strings.Replace(form, "&COIN_TYPE_OPTIONS;", coinTypeOptionsHelper(editing.CoinType), -1)
+	writeForm(w, "ADDRESS BOOK", form, sessionID)
+}
+
+func saveAddressBookEntryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to save address book entry: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	entry := addressbook.Entry{
+		ID:       req.FormValue("entry_id"),
+		Name:     req.FormValue("name"),
+		Address:  req.FormValue("address"),
+		Notes:    req.FormValue("notes"),
+		CoinType: req.FormValue("coin_type"),
+	}
+	err = validateEntriesHelper([]addressbook.Entry{entry})
+	if err == nil && entry.ID == "" {
+		_, err = addressbook.Add(dir, entry)
+	} else if err == nil {
+		_, err = addressbook.Update(dir, entry)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	req.Form.Del("edit")
+	addressBookHandler(w, req, nil)
+}
+
+func deleteAddressBookEntryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to delete address book entry: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	if err := addressbook.Remove(dir, req.FormValue("entry_id")); err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	addressBookHandler(w, req, nil)
+}
+
+func exportAddressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to export address book: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeAddressBookExport(w, entries, req.FormValue("format"))
+}
+
+func importAddressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to import address book: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload address book file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload address book file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	if _, err := importEntriesHelper(dir, b, "", req.FormValue("overwrite") == "true"); err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	addressBookHandler(w, req, nil)
+}
+
+// apiAddressBookDir returns the address book directory of the request's
+// session, writing an error when no wallet is open.
+func apiAddressBookDir(w http.ResponseWriter, req *http.Request) (string, bool) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return "", false
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unable to open address book: %v", err))
+		return "", false
+	}
+	return dir, true
+}
+
+// apiAddressBookError writes an address book error with the status that
+// matches it.
+func apiAddressBookError(w http.ResponseWriter, msgPrefix string, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, addressbook.ErrEntryNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, addressbook.ErrDuplicateName) {
+		status = http.StatusConflict
+	}
+	writeJSONError(w, status, fmt.Sprintf("%s%v", msgPrefix, err))
+}
+
+func apiAddressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to open address book: %v", err))
+		return
+	}
+	if entries == nil {
+		entries = []addressbook.Entry{}
+	}
+	writeJSON(w, http.StatusOK, APIAddressBook{Entries: entries})
+}
+
+func apiAddAddressBookEntryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	var entry addressbook.Entry
+	if !apiDecodeParams(w, req, &entry) {
+		return
+	}
+	err := validateEntriesHelper([]addressbook.Entry{entry})
+	if err == nil {
+		entry, err = addressbook.Add(dir, entry)
+	}
+	if err != nil {
+		apiAddressBookError(w, "Unable to save address book entry: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func apiUpdateAddressBookEntryHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	var entry addressbook.Entry
+	if !apiDecodeParams(w, req, &entry) {
+		return
+	}
+	entry.ID = ps.ByName("id")
+	err := validateEntriesHelper([]addressbook.Entry{entry})
+	if err == nil {
+		entry, err = addressbook.Update(dir, entry)
+	}
+	if err != nil {
+		apiAddressBookError(w, "Unable to save address book entry: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func apiDeleteAddressBookEntryHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	if err := addressbook.Remove(dir, ps.ByName("id")); err != nil {
+		apiAddressBookError(w, "Unable to delete address book entry: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiExportAddressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	entries, err := addressbook.List(dir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to export address book: %v", err))
+		return
+	}
+	writeAddressBookExport(w, entries, req.URL.Query().Get("format"))
+}
+
+func apiImportAddressBookHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dir, ok := apiAddressBookDir(w, req)
+	if !ok {
+		return
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to import address book: %v", err))
+		return
+	}
+	query := req.URL.Query()
+	count, err := importEntriesHelper(dir, b, query.Get("format"), query.Get("overwrite") == "true")
+	if err != nil {
+		apiAddressBookError(w, "Unable to import address book: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APIImported{Imported: count})
+}
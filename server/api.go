@@ -0,0 +1,540 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	mnemonics "gitlab.com/NebulousLabs/entropy-mnemonics"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+type (
+	// APIError is the JSON body returned when an api call fails.
+	APIError struct {
+		Message string `json:"message"`
+	}
+
+	// APISession is returned by api calls that attach a wallet to a new session.
+	APISession struct {
+		SessionID string `json:"session_id"`
+		Seed      string `json:"seed,omitempty"`
+	}
+
+	// APIBalances lists the balances of the wallet in hastings and funds.
+	APIBalances struct {
+		ScpBalance             types.Currency    `json:"scp_balance"`
+		ScpClaimBalance        types.Currency    `json:"scp_claim_balance"`
+		ScpUnconfirmedIncoming types.Currency    `json:"scp_unconfirmed_incoming"`
+		ScpUnconfirmedOutgoing types.Currency    `json:"scp_unconfirmed_outgoing"`
+		SpfaBalance            types.Currency    `json:"spfa_balance"`
+		SpfbBalance            types.Currency    `json:"spfb_balance"`
+		SpfbClaimBalance       types.Currency    `json:"spfb_claim_balance"`
+		SpfbUnclaimedBalance   types.Currency    `json:"spfb_unclaimed_balance"`
+		ScpHeldBalance         types.Currency    `json:"scp_held_balance"`
+		SpfaHeldBalance        types.Currency    `json:"spfa_held_balance"`
+		SpfbHeldBalance        types.Currency    `json:"spfb_held_balance"`
+		BlockHeight            types.BlockHeight `json:"block_height"`
+	}
+
+	// APIAddresses lists wallet addresses.
+	APIAddresses struct {
+		Addresses []types.UnlockHash `json:"addresses"`
+	}
+
+	// APITransactionIDs lists the IDs of broadcast transactions.
+	APITransactionIDs struct {
+		TransactionIDs []types.TransactionID `json:"transaction_ids"`
+	}
+
+	// APITransaction is a wallet transaction along with its summary.
+	APITransaction struct {
+		Transaction modules.ProcessedTransaction `json:"transaction"`
+		Summary     SummarizedTransaction        `json:"summary"`
+	}
+
+	// apiWalletParams are the parameters used to unlock, initialize or
+	// restore a wallet.
+	apiWalletParams struct {
+		WalletName string `json:"wallet_name"`
+		Password   string `json:"password"`
+		Seed       string `json:"seed"`
+	}
+
+	// apiChangeLockParams are the parameters used to change the wallet password.
+	apiChangeLockParams struct {
+		OriginalPassword string `json:"original_password"`
+		NewPassword      string `json:"new_password"`
+	}
+
+	// apiSendParams describe a single send. Amount is denominated in SCP for
+	// the SCP coin type and in whole funds for SPF-A and SPF-B.
+	// Unlock is an optional block height or date before which the output
+	// cannot be spent, in which case Destination is the recipient's public key.
+	// FeeLevel is low, normal, high or custom and defaults to normal.
+	// FeePerByte is the fee per byte of the custom level.
+	apiSendParams struct {
+		Amount      string `json:"amount"`
+		Destination string `json:"destination"`
+		Unlock      string `json:"unlock"`
+		CoinType    string `json:"coin_type"`
+		FeeLevel    string `json:"fee_level"`
+		FeePerByte  string `json:"fee_per_byte"`
+	}
+
+	// apiMultisendParams describe a multisend. Amounts carry their unit
+	// suffix the same way the multisend CSV does, e.g. 1230SCP or 10SPF-B.
+	// The fee is chosen the same way as for a single send. Outputs that an
+	// earlier multisend already paid are only paid again when Resend is true.
+	apiMultisendParams struct {
+		Outputs []struct {
+			Amount      string `json:"amount"`
+			Destination string `json:"destination"`
+		} `json:"outputs"`
+		FeeLevel        string `json:"fee_level"`
+		FeePerByte      string `json:"fee_per_byte"`
+		AllowDuplicates bool   `json:"allow_duplicates"`
+		Resend          bool   `json:"resend"`
+	}
+)
+
+// writeJSON writes the object to the response as JSON with the status code.
+func writeJSON(w http.ResponseWriter, statusCode int, obj interface{}) {
+	encjson, err := json.Marshal(obj)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		encjson, _ = json.Marshal(APIError{Message: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(encjson)))
+	w.WriteHeader(statusCode)
+	w.Write(encjson)
+}
+
+// writeJSONError writes an APIError to the response with the status code.
+func writeJSONError(w http.ResponseWriter, statusCode int, msg string) {
+	fmt.Println(msg)
+	writeJSON(w, statusCode, APIError{Message: msg})
+}
+
+// apiSessionID returns the session ID supplied in the X-Session-ID header or
+// the session_id query parameter.
+func apiSessionID(req *http.Request) string {
+	sessionID := req.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		sessionID = req.URL.Query().Get("session_id")
+	}
+	return sessionID
+}
+
+// apiSessionOrNew returns the request's session ID when it exists so that
+// another wallet can be opened in it, otherwise it adds a new session and
+// returns true.
+func apiSessionOrNew(req *http.Request) (string, bool) {
+	sessionID := apiSessionID(req)
+	if sessionID != "" && sessionIDExists(sessionID) {
+		return sessionID, false
+	}
+	return addSessionID(), true
+}
+
+// apiDecodeParams decodes the JSON request body into the params.
+func apiDecodeParams(w http.ResponseWriter, req *http.Request, params interface{}) bool {
+	err := json.NewDecoder(req.Body).Decode(params)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to decode request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// apiWallet returns the wallet that is attached to the request's session.
+// When unlocked is true the wallet must also be unlocked.
+func apiWallet(w http.ResponseWriter, req *http.Request, unlocked bool) (string, modules.Wallet, bool) {
+	sessionID := apiSessionID(req)
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		writeJSONError(w, http.StatusUnauthorized, "Session ID does not exist.")
+		return "", nil, false
+	}
+	touchSession(sessionID)
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return "", nil, false
+	}
+	if !unlocked {
+		return sessionID, wallet, true
+	}
+	isUnlocked, err := wallet.Unlocked()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+	if !isUnlocked {
+		writeJSONError(w, http.StatusForbidden, "Wallet is locked.")
+		return "", nil, false
+	}
+	return sessionID, wallet, true
+}
+
+func apiUnlockWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var params apiWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if params.WalletName == "" {
+		params.WalletName = "wallet"
+	}
+	sessionID, added := apiSessionOrNew(req)
+	wallet, err := existingWallet(params.WalletName, sessionID)
+	if err != nil {
+		if added {
+			discardSession(sessionID)
+		}
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unable to unlock wallet: %v", err))
+		return
+	}
+	err = unlockWallet(wallet, params.Password)
+	if err != nil {
+		if added {
+			discardSession(sessionID)
+		} else {
+			closeActiveWallet(sessionID)
+		}
+		statusCode := http.StatusBadRequest
+		if errors.Is(err, errInvalidPassword) {
+			statusCode = http.StatusUnauthorized
+		}
+		writeJSONError(w, statusCode, fmt.Sprintf("Unable to unlock wallet: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APISession{SessionID: sessionID})
+}
+
+func apiLockWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	err := wallet.Lock()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to lock wallet: %v", err))
+		return
+	}
+	err = closeActiveWallet(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to close wallet: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiInitializeSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to initialize new wallet seed: "
+	var params apiWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if params.WalletName == "" {
+		params.WalletName = "wallet"
+	}
+	if len(params.Password) < 8 {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"Password must be at least eight characters long.")
+		return
+	}
+	sessionID, added := apiSessionOrNew(req)
+	wallet, err := newWallet(params.WalletName, sessionID)
+	if err != nil {
+		if added {
+			discardSession(sessionID)
+		}
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	encryptionKey := crypto.NewWalletKey(crypto.HashObject(params.Password))
+	seed, err := wallet.Encrypt(encryptionKey)
+	if err != nil {
+		discardNewWallet(params.WalletName, added, sessionID)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	err = unlockWallet(wallet, params.Password)
+	if err != nil {
+		discardNewWallet(params.WalletName, added, sessionID)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	seedStr, err := modules.SeedToString(seed, mnemonics.English)
+	if err != nil {
+		discardNewWallet(params.WalletName, added, sessionID)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APISession{SessionID: sessionID, Seed: seedStr})
+}
+
+func apiRestoreSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to restore wallet from seed: "
+	var params apiWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if params.WalletName == "" {
+		params.WalletName = "wallet"
+	}
+	if len(params.Password) < 8 {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"Password must be at least eight characters long.")
+		return
+	}
+	seed, err := modules.StringToSeed(params.Seed, "english")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	if !n.ConsensusSet.Synced() {
+		writeJSONError(w, http.StatusServiceUnavailable, msgPrefix+"Consensus set is not synced.")
+		return
+	}
+	sessionID, added := apiSessionOrNew(req)
+	wallet, err := newWallet(params.WalletName, sessionID)
+	if err != nil {
+		if added {
+			discardSession(sessionID)
+		}
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	encryptionKey := crypto.NewWalletKey(crypto.HashObject(params.Password))
+	err = wallet.InitFromSeed(encryptionKey, seed)
+	if err != nil {
+		discardNewWallet(params.WalletName, added, sessionID)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	err = unlockWallet(wallet, params.Password)
+	if err != nil {
+		discardNewWallet(params.WalletName, added, sessionID)
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APISession{SessionID: sessionID})
+}
+
+func apiChangeLockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to change lock: "
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	var params apiChangeLockParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if len(params.NewPassword) < 8 {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"Password must be at least eight characters long.")
+		return
+	}
+	validPass, err := isPasswordValid(wallet, params.OriginalPassword)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if !validPass {
+		writeJSONError(w, http.StatusUnauthorized, msgPrefix+"The original password is not valid.")
+		return
+	}
+	newKey := crypto.NewWalletKey(crypto.HashObject(params.NewPassword))
+	primarySeed, _, err := wallet.PrimarySeed()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	err = wallet.ChangeKeyWithSeed(primarySeed, newKey)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiBalanceHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to obtain balance: "
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	allBals, held, err := confirmedBalanceHelper(wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	scpOut, scpIn, err := wallet.UnconfirmedBalance()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	height, err := wallet.Height()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIBalances{
+		ScpBalance:             allBals.CoinBalance,
+		ScpClaimBalance:        allBals.ClaimBalance,
+		ScpUnconfirmedIncoming: scpIn,
+		ScpUnconfirmedOutgoing: scpOut,
+		SpfaBalance:            allBals.FundBalance,
+		SpfbBalance:            allBals.FundbBalance,
+		SpfbClaimBalance:       allBals.ClaimbBalance,
+		SpfbUnclaimedBalance:   allBals.UnclaimbBalance,
+		ScpHeldBalance:         held.CoinBalance,
+		SpfaHeldBalance:        held.FundBalance,
+		SpfbHeldBalance:        held.FundbBalance,
+		BlockHeight:            height,
+	})
+}
+
+func apiAddressesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to retrieve addresses: "
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	if watchOnlySession(sessionID) {
+		addresses, err := wallet.WatchAddresses()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+			return
+		}
+		writeJSON(w, http.StatusOK, APIAddresses{Addresses: addresses})
+		return
+	}
+	count := uint64(10)
+	if countStr := req.URL.Query().Get("count"); countStr != "" {
+		var err error
+		count, err = strconv.ParseUint(countStr, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+			return
+		}
+	}
+	addresses, err := wallet.LastAddresses(count)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIAddresses{Addresses: addresses})
+}
+
+func apiNewAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	uc, err := wallet.NextAddress()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to retrieve address: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIAddresses{Addresses: []types.UnlockHash{uc.UnlockHash()}})
+}
+
+func apiSendCoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to send coins: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiSendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	coinOutputs, fundAOutputs, fundBOutputs, err := sendOutputsHelper(params.Amount, resolveDestination(sessionID, params.Destination), params.Unlock, params.CoinType)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	p, err := buildSendHelper(wallet, coinOutputs, fundAOutputs, fundBOutputs, feePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	txns, err := broadcastSendHelper(wallet, p)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransactionIDs(txns))
+}
+
+func apiMultisendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to send coins: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiMultisendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	p, ok := apiMultisendJobHelper(w, sessionID, wallet, params, msgPrefix)
+	if !ok {
+		return
+	}
+	txns, err := sendJobHelper(wallet, p, sessionID)
+	writeMultisendJobResult(w, p, txns, err, msgPrefix)
+}
+
+func apiTransactionHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var msgPrefix = "Unable to retrieve the transaction: "
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	var transactionID types.TransactionID
+	jsonID := "\"" + strings.ToLower(ps.ByName("id")) + "\""
+	err := transactionID.UnmarshalJSON([]byte(jsonID))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"Unable to parse transaction ID.")
+		return
+	}
+	txn, found, err := wallet.Transaction(transactionID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	if !found {
+		writeJSONError(w, http.StatusNotFound, msgPrefix+"Transaction was not found.")
+		return
+	}
+	sts, err := ComputeSummarizedTransactions([]modules.ProcessedTransaction{txn}, n.ConsensusSet.Height(), wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	if len(sts) == 0 {
+		writeJSONError(w, http.StatusNotFound, msgPrefix+"Transaction could not be summarized for the wallet.")
+		return
+	}
+	writeJSON(w, http.StatusOK, APITransaction{Transaction: txn, Summary: sts[0]})
+}
+
+// apiTransactionIDs collects the IDs of the transactions.
+func apiTransactionIDs(txns []types.Transaction) APITransactionIDs {
+	ids := APITransactionIDs{TransactionIDs: []types.TransactionID{}}
+	for _, txn := range txns {
+		ids.TransactionIDs = append(ids.TransactionIDs, txn.ID())
+	}
+	return ids
+}
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// txnInputSize is the estimated size in bytes of a signed input.
+const txnInputSize = 300
+
+type (
+	// SpendableOutput is a confirmed wallet output that can fund a send.
+	SpendableOutput struct {
+		ID                 types.OutputID    `json:"id"`
+		FundType           string            `json:"fund_type"`
+		Value              types.Currency    `json:"value"`
+		Address            types.UnlockHash  `json:"address"`
+		ConfirmationHeight types.BlockHeight `json:"confirmation_height"`
+	}
+
+	// APISpendableOutputs lists the wallet's spendable outputs.
+	APISpendableOutputs struct {
+		Outputs []SpendableOutput `json:"outputs"`
+	}
+
+	// apiCoinControlParams describe a send funded by the supplied outputs.
+	// Change is returned to ChangeAddress.
+	apiCoinControlParams struct {
+		Inputs        []types.OutputID `json:"inputs"`
+		Amount        string           `json:"amount"`
+		Destination   string           `json:"destination"`
+		Unlock        string           `json:"unlock"`
+		CoinType      string           `json:"coin_type"`
+		ChangeAddress string           `json:"change_address"`
+		FeeLevel      string           `json:"fee_level"`
+		FeePerByte    string           `json:"fee_per_byte"`
+	}
+)
+
+// manualTxnSize estimates the size in bytes of a manual send with the supplied
+// number of inputs and outputs, allowing for an SCP and a fund change output.
+func manualTxnSize(inputs int, outputs int) uint64 {
+	return uint64(coinTxnBaseSize + txnInputSize*inputs + txnOutputSize*(outputs+2))
+}
+
+// spendableOutputsHelper lists the wallet's confirmed SCP, SPF-A and SPF-B
+// outputs that are not spent by a pending transaction, largest first.
+func spendableOutputsHelper(wallet modules.Wallet) ([]SpendableOutput, error) {
+	return walletOutputsHelper(wallet, false)
+}
+
+// walletOutputsHelper lists the wallet's confirmed outputs that are not spent
+// by a pending transaction, largest first. It lists the outputs of the
+// watched addresses when watchOnly is true and those of the wallet's own keys
+// otherwise.
+func walletOutputsHelper(wallet modules.Wallet, watchOnly bool) ([]SpendableOutput, error) {
+	unspent, err := wallet.UnspentOutputs()
+	if err != nil {
+		return nil, err
+	}
+	outputs := []SpendableOutput{}
+	for _, output := range unspent {
+		if output.IsWatchOnly != watchOnly || output.ConfirmationHeight == types.BlockHeight(math.MaxUint64) {
+			continue
+		}
+		fundType := "SCP"
+		if output.FundType == types.SpecifierSiafundOutput {
+			fundType = "SPF-A"
+			isB, err := n.ConsensusSet.IsSiafundBOutput(types.SiafundOutputID(output.ID))
+			if err != nil {
+				return nil, err
+			}
+			if isB {
+				fundType = "SPF-B"
+			}
+		}
+		outputs = append(outputs, SpendableOutput{
+			ID:                 output.ID,
+			FundType:           fundType,
+			Value:              output.Value,
+			Address:            output.UnlockHash,
+			ConfirmationHeight: output.ConfirmationHeight,
+		})
+	}
+	sort.SliceStable(outputs, func(i, j int) bool {
+		if outputs[i].FundType != outputs[j].FundType {
+			return outputs[i].FundType < outputs[j].FundType
+		}
+		return outputs[i].Value.Cmp(outputs[j].Value) > 0
+	})
+	return outputs, nil
+}
+
+// confirmedBalanceHelper returns the wallet's confirmed balance without the
+// held outputs, which are returned on their own. Held outputs are the watched
+// outputs the wallet cannot spend alone, those of timelocked addresses that
+// have not unlocked yet and those of multisig addresses, which the wallet
+// otherwise counts in its confirmed balance.
+func confirmedBalanceHelper(wallet modules.Wallet) (modules.ConfirmedBalance, modules.ConfirmedBalance, error) {
+	var held modules.ConfirmedBalance
+	bals, err := wallet.ConfirmedBalance()
+	if err != nil {
+		return bals, held, err
+	}
+	watched, err := walletOutputsHelper(wallet, true)
+	if err != nil {
+		return bals, held, err
+	}
+	height := n.ConsensusSet.Height()
+	for _, output := range watched {
+		uc, err := wallet.UnlockConditions(output.Address)
+		if err != nil || (uc.Timelock <= height && !isMultisig(uc)) {
+			continue
+		}
+		switch output.FundType {
+		case "SCP":
+			held.CoinBalance = held.CoinBalance.Add(output.Value)
+		case "SPF-A":
+			held.FundBalance = held.FundBalance.Add(output.Value)
+		case "SPF-B":
+			held.FundbBalance = held.FundbBalance.Add(output.Value)
+		}
+	}
+	subtract := func(balance, held types.Currency) types.Currency {
+		if balance.Cmp(held) <= 0 {
+			return types.ZeroCurrency
+		}
+		return balance.Sub(held)
+	}
+	bals.CoinBalance = subtract(bals.CoinBalance, held.CoinBalance)
+	bals.FundBalance = subtract(bals.FundBalance, held.FundBalance)
+	bals.FundbBalance = subtract(bals.FundbBalance, held.FundbBalance)
+	return bals, held, nil
+}
+
+// buildCoinControlHelper builds a send that spends exactly the selected
+// outputs and returns any change to the change address. The inputs carry
+// empty signatures that are filled in when the send is confirmed.
+func buildCoinControlHelper(wallet modules.Wallet, inputIDs []types.OutputID, coinOutputs []types.SiacoinOutput, fundOutputs []types.SiafundOutput, fundType string, changeAddress types.UnlockHash, feePerByte types.Currency) (*pendingSend, error) {
+	if !n.ConsensusSet.Synced() {
+		return nil, errors.New("cannot build transaction until fully synced")
+	}
+	if len(inputIDs) == 0 {
+		return nil, errors.New("no outputs were selected")
+	}
+	spendable, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[types.OutputID]SpendableOutput)
+	for _, output := range spendable {
+		byID[output.ID] = output
+	}
+	height := n.ConsensusSet.Height()
+	builder, err := wallet.StartTransaction()
+	if err != nil {
+		return nil, err
+	}
+	coinFund := types.ZeroCurrency
+	fundFund := types.ZeroCurrency
+	inputFundType := ""
+	selected := make(map[types.OutputID]bool)
+	for _, id := range inputIDs {
+		output, ok := byID[id]
+		if !ok || selected[id] {
+			builder.Drop()
+			return nil, fmt.Errorf("output %v is not spendable", id)
+		}
+		selected[id] = true
+		uc, err := wallet.UnlockConditions(output.Address)
+		if err != nil {
+			builder.Drop()
+			return nil, err
+		}
+		if uc.Timelock > height {
+			builder.Drop()
+			return nil, fmt.Errorf("output %v is timelocked until height %v", id, uc.Timelock)
+		}
+		if output.FundType == "SCP" {
+			builder.AddSiacoinInput(types.SiacoinInput{ParentID: types.SiacoinOutputID(id), UnlockConditions: uc})
+			coinFund = coinFund.Add(output.Value)
+		} else {
+			if inputFundType != "" && inputFundType != output.FundType {
+				builder.Drop()
+				return nil, errors.New("cannot spend both SPF-A and SPF-B in one transaction")
+			}
+			inputFundType = output.FundType
+			builder.AddSiafundInput(types.SiafundInput{ParentID: types.SiafundOutputID(id), UnlockConditions: uc, ClaimUnlockHash: changeAddress})
+			fundFund = fundFund.Add(output.Value)
+		}
+		builder.AddTransactionSignature(types.TransactionSignature{
+			ParentID:       crypto.Hash(id),
+			CoveredFields:  types.CoveredFields{WholeTransaction: true},
+			PublicKeyIndex: 0,
+		})
+	}
+	if len(fundOutputs) != 0 && fundType != inputFundType {
+		builder.Drop()
+		return nil, fmt.Errorf("no %s outputs were selected", fundType)
+	}
+	fee := feePerByte.Mul64(manualTxnSize(len(inputIDs), len(coinOutputs)+len(fundOutputs)))
+	builder.AddMinerFee(fee)
+	coinCost := fee
+	for _, output := range coinOutputs {
+		builder.AddSiacoinOutput(output)
+		coinCost = coinCost.Add(output.Value)
+	}
+	fundCost := types.ZeroCurrency
+	for _, output := range fundOutputs {
+		builder.AddSiafundOutput(output)
+		fundCost = fundCost.Add(output.Value)
+	}
+	if coinFund.Cmp(coinCost) < 0 {
+		builder.Drop()
+		return nil, fmt.Errorf("the selected SCP outputs do not cover the amount and the miner fee of %s", fmtPreviewValue("SCP", fee))
+	}
+	if fundFund.Cmp(fundCost) < 0 {
+		builder.Drop()
+		return nil, fmt.Errorf("the selected %s outputs do not cover the amount", fundType)
+	}
+	if change := coinFund.Sub(coinCost); !change.IsZero() {
+		builder.AddSiacoinOutput(types.SiacoinOutput{Value: change, UnlockHash: changeAddress})
+	}
+	if change := fundFund.Sub(fundCost); !change.IsZero() {
+		builder.AddSiafundOutput(types.SiafundOutput{Value: change, UnlockHash: changeAddress})
+	}
+	if inputFundType == "" {
+		inputFundType = "SCP"
+	}
+	p := &pendingSend{
+		builders:  []modules.TransactionBuilder{builder},
+		fundTypes: []string{inputFundType},
+		signer: func(txn *types.Transaction) error {
+			return wallet.SignTransaction(txn, nil)
+		},
+		changeAddress: changeAddress,
+	}
+	p.preview, err = previewHelper(wallet, p)
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	p.preview.FeePerByte = feePerByte
+	return p, nil
+}
+
+// coinControlSendHelper parses a coin control send and builds it.
+func coinControlSendHelper(wallet modules.Wallet, inputIDs []types.OutputID, amount string, destination string, unlock string, coinType string, changeAddress string, feeLevel string, customFee string) (*pendingSend, error) {
+	change, err := scanAddress(changeAddress)
+	if err != nil {
+		return nil, errors.New("change address is not valid")
+	}
+	coinOutputs, fundAOutputs, fundBOutputs, err := sendOutputsHelper(amount, destination, unlock, coinType)
+	if err != nil {
+		return nil, err
+	}
+	fundOutputs := append(fundAOutputs, fundBOutputs...)
+	feePerByte, err := feePerByteHelper(feeLevel, customFee)
+	if err != nil {
+		return nil, err
+	}
+	return buildCoinControlHelper(wallet, inputIDs, coinOutputs, fundOutputs, coinType, change, feePerByte)
+}
+
+// spendableRowsHelper returns the table rows of the coin control form.
+func spendableRowsHelper(outputs []SpendableOutput) string {
+	rows := ""
+	for _, output := range outputs {
+		rows += fmt.Sprintf("<tr><td><input type='checkbox' name='output' value='%s'></td><td>%s</td><td>%s</td><td>%d</td></tr>\n", output.ID, fmtPreviewValue(output.FundType, output.Value), output.Address, output.ConfirmationHeight)
+	}
+	if rows == "" {
+		rows = "<tr><td colspan='4'>The wallet has no confirmed outputs to spend.</td></tr>"
+	}
+	return rows
+}
+
+func coinControlFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to list outputs: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	outputs, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	form := resources.CoinControlForm()
+	form = strings.Replace(form, "&SPENDABLE_ROWS;", spendableRowsHelper(outputs), -1)
+	form = strings.Replace(form, "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	writeForm(w, "COIN CONTROL", form, sessionID)
+}
+
+func coinControlSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to send coins: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	err = req.ParseForm()
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	var inputIDs []types.OutputID
+	for _, value := range req.Form["output"] {
+		var id types.OutputID
+		if err := (*crypto.Hash)(&id).LoadString(value); err != nil {
+			msg := fmt.Sprintf("%s%v", msgPrefix, err)
+			writeError(w, msg, sessionID)
+			return
+		}
+		inputIDs = append(inputIDs, id)
+	}
+	p, err := coinControlSendHelper(wallet, inputIDs, req.FormValue("amount"), req.FormValue("destination"), req.FormValue("unlock"), req.FormValue("coin_type"), req.FormValue("change_address"), req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	setPendingSend(p, sessionID)
+	writeSendPreview(w, p.preview, "", sessionID)
+}
+
+func apiSpendableOutputsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	outputs, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to list outputs: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APISpendableOutputs{Outputs: outputs})
+}
+
+func apiPreviewCoinControlHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to build transaction: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiCoinControlParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	p, err := coinControlSendHelper(wallet, params.Inputs, params.Amount, params.Destination, params.Unlock, params.CoinType, params.ChangeAddress, params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	setPendingSend(p, sessionID)
+	writeJSON(w, http.StatusOK, p.preview)
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// consolidationBatchInputs is the number of outputs swept by each batch. It
+// keeps every batch well below the transaction pool's size limit.
+const consolidationBatchInputs = 80
+
+type (
+	// ConsolidationBatch is a transaction that sweeps outputs into the
+	// consolidation address.
+	ConsolidationBatch struct {
+		Inputs []types.OutputID `json:"inputs"`
+		Value  types.Currency   `json:"value"`
+		Fee    types.Currency   `json:"fee"`
+	}
+
+	// ConsolidationPlan proposes the batches that sweep the wallet's SCP
+	// outputs within the fee budget. Dust counts the outputs worth less than
+	// the fee of spending them, alone or in a batch, and Deferred the outputs
+	// left for a later run because their batches would exceed the budget.
+	ConsolidationPlan struct {
+		Outputs    int                  `json:"outputs"`
+		Dust       int                  `json:"dust"`
+		Deferred   int                  `json:"deferred"`
+		Batches    []ConsolidationBatch `json:"batches"`
+		TotalFee   types.Currency       `json:"total_fee"`
+		FeePerByte types.Currency       `json:"fee_per_byte"`
+		FeeBudget  types.Currency       `json:"fee_budget"`
+
+		walletName string
+	}
+
+	// apiConsolidateParams are the parameters used to run the consolidation
+	// plan.
+	apiConsolidateParams struct {
+		Password string `json:"password"`
+	}
+)
+
+var (
+	// errNoConsolidationPlan is returned when a consolidation is started
+	// before its plan was proposed.
+	errNoConsolidationPlan = errors.New("no consolidation plan was proposed, plan the consolidation first")
+
+	// errConsolidationChanged is returned when the outputs of a proposed
+	// plan changed before it was run.
+	errConsolidationChanged = errors.New("the wallet's outputs changed since the consolidation was planned, plan it again")
+)
+
+// planConsolidationHelper proposes batches that sweep the wallet's SCP outputs,
+// smallest first, until the fee budget is spent.
+func planConsolidationHelper(wallet modules.Wallet, feeLevel string, customFee string, feeBudget string) (ConsolidationPlan, error) {
+	var plan ConsolidationPlan
+	var err error
+	plan.FeePerByte, err = feePerByteHelper(feeLevel, customFee)
+	if err != nil {
+		return plan, err
+	}
+	plan.FeeBudget, err = NewCurrencyStr(strings.TrimSpace(feeBudget) + "SCP")
+	if err != nil || plan.FeeBudget.IsZero() {
+		return plan, errors.New("a fee budget in SCP must be provided")
+	}
+	spendable, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		return plan, err
+	}
+	var outputs []SpendableOutput
+	inputFee := plan.FeePerByte.Mul64(txnInputSize)
+	for _, output := range spendable {
+		if output.FundType != "SCP" {
+			continue
+		}
+		plan.Outputs++
+		if output.Value.Cmp(inputFee) <= 0 {
+			plan.Dust++
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	sort.SliceStable(outputs, func(i, j int) bool { return outputs[i].Value.Cmp(outputs[j].Value) < 0 })
+	for start := 0; start < len(outputs); start += consolidationBatchInputs {
+		end := start + consolidationBatchInputs
+		if end > len(outputs) {
+			end = len(outputs)
+		}
+		if end-start < 2 {
+			break
+		}
+		batch := ConsolidationBatch{Fee: plan.FeePerByte.Mul64(manualTxnSize(end-start, 0))}
+		for _, output := range outputs[start:end] {
+			batch.Inputs = append(batch.Inputs, output.ID)
+			batch.Value = batch.Value.Add(output.Value)
+		}
+		// The outputs are sorted smallest first, so a batch that does not
+		// cover its fee is made of dust as a whole.
+		if batch.Value.Cmp(batch.Fee) <= 0 {
+			plan.Dust += end - start
+			continue
+		}
+		if plan.TotalFee.Add(batch.Fee).Cmp(plan.FeeBudget) > 0 {
+			plan.Deferred = len(outputs) - start
+			break
+		}
+		plan.Batches = append(plan.Batches, batch)
+		plan.TotalFee = plan.TotalFee.Add(batch.Fee)
+	}
+	return plan, nil
+}
+
+// setConsolidationPlan keeps the plan proposed to the session's active
+// wallet, so that the consolidation runs exactly the batches that were shown.
+func setConsolidationPlan(plan ConsolidationPlan, sessionID string) {
+	store.Update(sessionID, func(session *Session) {
+		plan.walletName = session.name
+		session.consolidation = &plan
+	})
+}
+
+// consolidationPlanHelper returns the plan last proposed to the session's
+// active wallet.
+func consolidationPlanHelper(sessionID string) (ConsolidationPlan, error) {
+	session, err := getSession(sessionID)
+	if err != nil {
+		return ConsolidationPlan{}, err
+	}
+	if session.consolidation == nil || session.consolidation.walletName != session.name {
+		return ConsolidationPlan{}, errNoConsolidationPlan
+	}
+	return *session.consolidation, nil
+}
+
+// checkConsolidationHelper returns an error when an input of the plan was
+// spent or its batch no longer adds up to the planned value.
+func checkConsolidationHelper(wallet modules.Wallet, plan ConsolidationPlan) error {
+	spendable, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		return err
+	}
+	values := make(map[types.OutputID]types.Currency)
+	for _, output := range spendable {
+		if output.FundType == "SCP" {
+			values[output.ID] = output.Value
+		}
+	}
+	for _, batch := range plan.Batches {
+		total := types.ZeroCurrency
+		for _, id := range batch.Inputs {
+			value, ok := values[id]
+			if !ok {
+				return errConsolidationChanged
+			}
+			total = total.Add(value)
+		}
+		if !total.Equals(batch.Value) {
+			return errConsolidationChanged
+		}
+	}
+	return nil
+}
+
+// startConsolidationHelper checks the password and that the inputs of the
+// session's plan are unchanged, and starts sweeping the batches of the plan
+// in the background.
+func startConsolidationHelper(wallet modules.Wallet, password string, sessionID string) (ConsolidationPlan, error) {
+	plan, err := consolidationPlanHelper(sessionID)
+	if err != nil {
+		return plan, err
+	}
+	if len(plan.Batches) == 0 {
+		return plan, errors.New("there are no outputs to consolidate within the fee budget")
+	}
+	if operationRunning(sessionID) {
+		return plan, errors.New("another operation is running")
+	}
+	valid, err := isPasswordValid(wallet, password)
+	if err != nil {
+		return plan, err
+	}
+	if !valid {
+		return plan, errInvalidPassword
+	}
+	if err := checkConsolidationHelper(wallet, plan); err != nil {
+		return plan, err
+	}
+	store.Update(sessionID, func(session *Session) {
+		session.consolidation = nil
+	})
+	startOperation(OperationConsolidating, sessionID)
+	go consolidateHelper(wallet, plan, sessionID)
+	return plan, nil
+}
+
+// consolidateHelper sweeps each batch of the plan into one fresh address,
+// broadcasting the batches one by one.
+func consolidateHelper(wallet modules.Wallet, plan ConsolidationPlan, sessionID string) {
+	uc, err := wallet.NextAddress()
+	if err != nil {
+		finishOperation(OperationConsolidating, err, sessionID)
+		return
+	}
+	for i, batch := range plan.Batches {
+		p, err := buildCoinControlHelper(wallet, batch.Inputs, nil, nil, "SCP", uc.UnlockHash(), plan.FeePerByte)
+		if err == nil {
+			_, err = broadcastSendHelper(wallet, p)
+		}
+		if err != nil {
+			finishOperation(OperationConsolidating, fmt.Errorf("batch %d of %d failed: %v", i+1, len(plan.Batches), err), sessionID)
+			return
+		}
+		setOperationProgress(OperationConsolidating, float64(i+1)/float64(len(plan.Batches)), sessionID)
+	}
+	finishOperation(OperationConsolidating, nil, sessionID)
+}
+
+// consolidationRowsHelper returns the table rows of the plan's batches.
+func consolidationRowsHelper(plan ConsolidationPlan) string {
+	rows := ""
+	for i, batch := range plan.Batches {
+		rows += fmt.Sprintf("<tr><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>\n", i+1, len(batch.Inputs), fmtPreviewValue("SCP", batch.Value), fmtPreviewValue("SCP", batch.Fee))
+	}
+	return rows
+}
+
+func consolidateFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to consolidate outputs: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	spendable, err := spendableOutputsHelper(wallet)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	count := 0
+	for _, output := range spendable {
+		if output.FundType == "SCP" {
+			count++
+		}
+	}
+	form := resources.ConsolidateForm()
+	form = strings.Replace(form, "&OUTPUT_COUNT;", fmt.Sprintf("%d", count), -1)
+	form = strings.Replace(form, "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	writeForm(w, "CONSOLIDATE OUTPUTS", form, sessionID)
+}
+
+func consolidatePlanHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to consolidate outputs: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	plan, err := planConsolidationHelper(wallet, req.FormValue("fee_level"), req.FormValue("fee_per_byte"), req.FormValue("fee_budget"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	setConsolidationPlan(plan, sessionID)
+	form := resources.ConsolidatePlanForm()
+	form = strings.Replace(form, "&OUTPUT_COUNT;", fmt.Sprintf("%d", plan.Outputs), -1)
+	form = strings.Replace(form, "&DUST_COUNT;", fmt.Sprintf("%d", plan.Dust), -1)
+	form = strings.Replace(form, "&DEFERRED_COUNT;", fmt.Sprintf("%d", plan.Deferred), -1)
+	form = strings.Replace(form, "&BATCH_ROWS;", consolidationRowsHelper(plan), -1)
+	form = strings.Replace(form, "&TOTAL_FEE;", fmtPreviewValue("SCP", plan.TotalFee), -1)
+	writeForm(w, "CONSOLIDATE OUTPUTS", form, sessionID)
+}
+
+func consolidateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to consolidate outputs: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	_, err = startConsolidationHelper(wallet, req.FormValue("password"), sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
+	form := resources.ScanningWalletForm()
+	writeForm(w, title, form, sessionID)
+}
+
+func apiConsolidationPlanHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	query := req.URL.Query()
+	plan, err := planConsolidationHelper(wallet, query.Get("fee_level"), query.Get("fee_per_byte"), query.Get("fee_budget"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to plan consolidation: %v", err))
+		return
+	}
+	setConsolidationPlan(plan, sessionID)
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func apiConsolidateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to consolidate outputs: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiConsolidateParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	plan, err := startConsolidationHelper(wallet, params.Password, sessionID)
+	if errors.Is(err, errInvalidPassword) {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if errors.Is(err, errNoConsolidationPlan) || errors.Is(err, errConsolidationChanged) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, plan)
+}
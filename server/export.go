@@ -0,0 +1,457 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/modules/txnotes"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// exportFormats are the formats the transaction history can be exported in.
+var exportFormats = []string{"csv", "json", "ofx", "qif", "yearly"}
+
+// exportParams selects the transactions and the format of a history export.
+type exportParams struct {
+	format    string
+	filter    historyFilter
+	addresses bool
+	notes     bool
+}
+
+// APIExportedTransaction is a transaction of a JSON history export. SCP
+// amounts are exact decimal strings and are also given in hastings. The fee
+// is positive.
+type APIExportedTransaction struct {
+	TxnID          string            `json:"txn_id"`
+	Type           string            `json:"type"`
+	Confirmed      bool              `json:"confirmed"`
+	Height         types.BlockHeight `json:"height"`
+	Time           string            `json:"time"`
+	Timestamp      int64             `json:"timestamp"`
+	Scp            string            `json:"scp"`
+	ScpHastings    string            `json:"scp_hastings"`
+	ScpFee         string            `json:"scp_fee"`
+	ScpFeeHastings string            `json:"scp_fee_hastings"`
+	SpfA           ExactCurrency     `json:"spfa"`
+	SpfB           ExactCurrency     `json:"spfb"`
+	Counterparties []string          `json:"counterparties,omitempty"`
+	Note           string            `json:"note,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+}
+
+// APIHistoryExport is a JSON history export.
+type APIHistoryExport struct {
+	From         string                   `json:"from,omitempty"`
+	To           string                   `json:"to,omitempty"`
+	Transactions []APIExportedTransaction `json:"transactions"`
+}
+
+// historyYear is a line of the yearly report.
+type historyYear struct {
+	year         int
+	count        int
+	scpIncoming  ExactCurrency
+	scpOutgoing  ExactCurrency
+	scpFees      ExactCurrency
+	spfAIncoming ExactCurrency
+	spfAOutgoing ExactCurrency
+	spfBIncoming ExactCurrency
+	spfBOutgoing ExactCurrency
+}
+
+// parseExportBool parses a flag given as a query parameter or a checkbox.
+func parseExportBool(value string) bool {
+	return value == "true" || value == "on" || value == "1"
+}
+
+// parseExportParams parses the format, date range and options of an export.
+func parseExportParams(values url.Values) (exportParams, error) {
+	params := exportParams{
+		format:    strings.ToLower(strings.TrimSpace(values.Get("format"))),
+		filter:    historyFilter{sort: "oldest"},
+		addresses: parseExportBool(values.Get("addresses")),
+		notes:     parseExportBool(values.Get("notes")),
+	}
+	if params.format == "" {
+		params.format = "csv"
+	}
+	valid := false
+	for _, format := range exportFormats {
+		valid = valid || params.format == format
+	}
+	if !valid {
+		return params, fmt.Errorf("%s is not an export format, use one of %s", params.format, strings.Join(exportFormats, ", "))
+	}
+	var err error
+	if v := strings.TrimSpace(values.Get("from")); v != "" {
+		if params.filter.from, err = parseHistoryDate(v, false); err != nil {
+			return params, err
+		}
+	}
+	if v := strings.TrimSpace(values.Get("to")); v != "" {
+		if params.filter.to, err = parseHistoryDate(v, true); err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+// exportHelper returns the wallet's transactions in the export's date range,
+// oldest first.
+func exportHelper(wallet modules.Wallet, params exportParams) ([]SummarizedTransaction, error) {
+	return historyHelper(wallet, map[string]txnotes.Note{}, params.filter)
+}
+
+// confirmedOnly returns the confirmed transactions.
+func confirmedOnly(sts []SummarizedTransaction) []SummarizedTransaction {
+	var confirmed []SummarizedTransaction
+	for _, st := range sts {
+		if st.Confirmed == _stConfirmedStr {
+			confirmed = append(confirmed, st)
+		}
+	}
+	return confirmed
+}
+
+// exportCsv writes a CSV line per transaction with exact amounts.
+func exportCsv(sts []SummarizedTransaction, notes map[string]txnotes.Note, params exportParams) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	header := []string{"Transaction ID", "Type", "Confirmed", "Height", "DateTime", "Amount SCP", "Amount Hastings", "Amount SPF-A", "Amount SPF-B", "Fee SCP", "Fee Hastings"}
+	if params.addresses {
+		header = append(header, "Counterparties")
+	}
+	if params.notes {
+		header = append(header, "Note", "Tags")
+	}
+	cw.Write(header)
+	for _, st := range sts {
+		fee := st.ScpFee.Neg()
+		line := []string{st.TxnID, st.Type, st.Confirmed, strconv.FormatUint(uint64(st.Height), 10), st.Time, st.Scp.String(), st.Scp.Format("H"), st.SpfA.String(), st.SpfB.String(), fee.String(), fee.Format("H")}
+		if params.addresses {
+			line = append(line, strings.Join(st.Counterparties, " "))
+		}
+		if params.notes {
+			note := transactionNote(notes, st.TxnID)
+			line = append(line, note.Note, strings.Join(note.Tags, ", "))
+		}
+		cw.Write(line)
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// exportJSON writes the transactions with exact amounts as JSON.
+func exportJSON(sts []SummarizedTransaction, notes map[string]txnotes.Note, params exportParams) ([]byte, error) {
+	export := APIHistoryExport{Transactions: []APIExportedTransaction{}}
+	if params.filter.from != nil {
+		export.From = params.filter.from.Format(time.RFC3339)
+	}
+	if params.filter.to != nil {
+		export.To = params.filter.to.Format(time.RFC3339)
+	}
+	for _, st := range sts {
+		fee := st.ScpFee.Neg()
+		txn := APIExportedTransaction{
+			TxnID:          st.TxnID,
+			Type:           st.Type,
+			Confirmed:      st.Confirmed == _stConfirmedStr,
+			Height:         st.Height,
+			Time:           st.Time,
+			Timestamp:      st.Timestamp,
+			Scp:            st.Scp.String(),
+			ScpHastings:    st.Scp.Format("H"),
+			ScpFee:         fee.String(),
+			ScpFeeHastings: fee.Format("H"),
+			SpfA:           st.SpfA,
+			SpfB:           st.SpfB,
+		}
+		if params.addresses {
+			txn.Counterparties = st.Counterparties
+		}
+		if params.notes {
+			note := transactionNote(notes, st.TxnID)
+			txn.Note = note.Note
+			txn.Tags = note.Tags
+		}
+		export.Transactions = append(export.Transactions, txn)
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// ledgerEntry is an SCP amount of a transaction as booked by accounting
+// software. A transaction's fee is an entry of its own.
+type ledgerEntry struct {
+	id     string
+	time   time.Time
+	amount ExactCurrency
+	payee  string
+	memo   string
+	fee    bool
+}
+
+// ledgerHelper returns the ledger entries of the confirmed transactions that
+// moved SCP.
+func ledgerHelper(sts []SummarizedTransaction, notes map[string]txnotes.Note, params exportParams) []ledgerEntry {
+	var entries []ledgerEntry
+	for _, st := range confirmedOnly(sts) {
+		t := time.Unix(st.Timestamp, 0)
+		var payee, memo string
+		if params.addresses && len(st.Counterparties) > 0 {
+			payee = st.Counterparties[0]
+		}
+		if params.notes {
+			note := transactionNote(notes, st.TxnID)
+			memo = note.Note
+			if len(note.Tags) > 0 {
+				memo = strings.TrimSpace(memo + " [" + strings.Join(note.Tags, ", ") + "]")
+			}
+		}
+		if memo == "" {
+			memo = st.Type
+		}
+		if !st.Scp.IsZero() {
+			entries = append(entries, ledgerEntry{id: st.TxnID, time: t, amount: st.Scp, payee: payee, memo: memo})
+		}
+		if !st.ScpFee.IsZero() {
+			entries = append(entries, ledgerEntry{id: st.TxnID + "-FEE", time: t, amount: st.ScpFee, payee: "Miner fee", memo: "Fee of " + st.TxnID, fee: true})
+		}
+	}
+	return entries
+}
+
+// xmlEscape escapes text for an XML element.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// exportOfx writes the ledger entries as an OFX 2 bank statement in SCP.
+func exportOfx(wallet modules.Wallet, sts []SummarizedTransaction, notes map[string]txnotes.Note, params exportParams) ([]byte, error) {
+	bals, err := wallet.ConfirmedBalance()
+	if err != nil {
+		return nil, err
+	}
+	const ofxTime = "20060102150405"
+	now := time.Now()
+	start, end := time.Unix(0, 0), now
+	if len(sts) > 0 {
+		start = time.Unix(sts[0].Timestamp, 0)
+	}
+	if params.filter.from != nil {
+		start = *params.filter.from
+	}
+	if params.filter.to != nil && params.filter.to.Before(now) {
+		end = *params.filter.to
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	buf.WriteString(`<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	buf.WriteString("<OFX>\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	fmt.Fprintf(&buf, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", now.Format(ofxTime))
+	buf.WriteString("<BANKMSGSRSV1><STMTTRNRS><TRNUID>0</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n<STMTRS>\n")
+	buf.WriteString("<CURDEF>SCP</CURDEF>\n<BANKACCTFROM><BANKID>SCPRIME</BANKID><ACCTID>WALLET</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n")
+	fmt.Fprintf(&buf, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", start.Format(ofxTime), end.Format(ofxTime))
+	for _, entry := range ledgerHelper(sts, notes, params) {
+		trnType := "CREDIT"
+		if entry.amount.Sign() < 0 {
+			trnType = "DEBIT"
+		}
+		if entry.fee {
+			trnType = "FEE"
+		}
+		fmt.Fprintf(&buf, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID>", trnType, entry.time.Format(ofxTime), entry.amount.String(), entry.id)
+		if entry.payee != "" {
+			fmt.Fprintf(&buf, "<NAME>%s</NAME>", xmlEscape(entry.payee))
+		}
+		fmt.Fprintf(&buf, "<MEMO>%s</MEMO></STMTTRN>\n", xmlEscape(entry.memo))
+	}
+	buf.WriteString("</BANKTRANLIST>\n")
+	fmt.Fprintf(&buf, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", NewExactCurrency(bals.CoinBalance).String(), now.Format(ofxTime))
+	buf.WriteString("</STMTRS>\n</STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n")
+	return buf.Bytes(), nil
+}
+
+// exportQif writes the ledger entries as a QIF bank account in SCP.
+func exportQif(sts []SummarizedTransaction, notes map[string]txnotes.Note, params exportParams) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!Type:Bank\n")
+	for _, entry := range ledgerHelper(sts, notes, params) {
+		fmt.Fprintf(&buf, "D%s\nT%s\nN%s\n", entry.time.Format("01/02/2006"), entry.amount.String(), entry.id)
+		if entry.payee != "" {
+			fmt.Fprintf(&buf, "P%s\n", entry.payee)
+		}
+		fmt.Fprintf(&buf, "M%s\n^\n", strings.ReplaceAll(entry.memo, "\n", " "))
+	}
+	return buf.Bytes()
+}
+
+// yearlyHelper sums the confirmed transactions per calendar year.
+func yearlyHelper(sts []SummarizedTransaction) []historyYear {
+	years := make(map[int]*historyYear)
+	for _, st := range confirmedOnly(sts) {
+		year := time.Unix(st.Timestamp, 0).Year()
+		y, exists := years[year]
+		if !exists {
+			y = &historyYear{year: year}
+			years[year] = y
+		}
+		y.count++
+		if st.Scp.Sign() > 0 {
+			y.scpIncoming = y.scpIncoming.Add(st.Scp)
+		} else {
+			y.scpOutgoing = y.scpOutgoing.Sub(st.Scp)
+		}
+		y.scpFees = y.scpFees.Sub(st.ScpFee)
+		if st.SpfA.Sign() > 0 {
+			y.spfAIncoming = y.spfAIncoming.Add(st.SpfA)
+		} else {
+			y.spfAOutgoing = y.spfAOutgoing.Sub(st.SpfA)
+		}
+		if st.SpfB.Sign() > 0 {
+			y.spfBIncoming = y.spfBIncoming.Add(st.SpfB)
+		} else {
+			y.spfBOutgoing = y.spfBOutgoing.Sub(st.SpfB)
+		}
+	}
+	var report []historyYear
+	for _, y := range years {
+		report = append(report, *y)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].year < report[j].year
+	})
+	return report
+}
+
+// exportYearly writes the yearly report as CSV.
+func exportYearly(sts []SummarizedTransaction) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"Year", "Transactions", "Incoming SCP", "Outgoing SCP", "Fees SCP", "Net SCP", "Incoming SPF-A", "Outgoing SPF-A", "Incoming SPF-B", "Outgoing SPF-B"})
+	for _, y := range yearlyHelper(sts) {
+		net := y.scpIncoming.Sub(y.scpOutgoing).Sub(y.scpFees)
+		cw.Write([]string{
+			strconv.Itoa(y.year),
+			strconv.Itoa(y.count),
+			y.scpIncoming.String(),
+			y.scpOutgoing.String(),
+			y.scpFees.String(),
+			net.String(),
+			y.spfAIncoming.String(),
+			y.spfAOutgoing.String(),
+			y.spfBIncoming.String(),
+			y.spfBOutgoing.String(),
+		})
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// exportHistoryHelper renders the export and returns it with its content type
+// and file name.
+func exportHistoryHelper(wallet modules.Wallet, notes map[string]txnotes.Note, params exportParams) ([]byte, string, string, error) {
+	sts, err := exportHelper(wallet, params)
+	if err != nil {
+		return nil, "", "", err
+	}
+	switch params.format {
+	case "json":
+		b, err := exportJSON(sts, notes, params)
+		return b, "application/json", "history.json", err
+	case "ofx":
+		b, err := exportOfx(wallet, sts, notes, params)
+		return b, "application/x-ofx", "history.ofx", err
+	case "qif":
+		return exportQif(sts, notes, params), "application/qif", "history.qif", nil
+	case "yearly":
+		b, err := exportYearly(sts)
+		return b, "text/csv", "history-yearly.csv", err
+	default:
+		b, err := exportCsv(sts, notes, params)
+		return b, "text/csv", "history.csv", err
+	}
+}
+
+// writeExport writes the export as a file download.
+func writeExport(w http.ResponseWriter, b []byte, contentType string, fileName string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-disposition", "attachment;filename="+fileName)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+func exportHistoryFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	writeForm(w, "EXPORT HISTORY", resources.ExportHistoryForm(), sessionID)
+}
+
+func exportHistoryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to export transaction history: "
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	params, err := parseExportParams(req.Form)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	b, contentType, fileName, err := exportHistoryHelper(wallet, notesHelper(sessionID), params)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeExport(w, b, contentType, fileName)
+}
+
+func apiExportHistoryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to export transaction history: "
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	params, err := parseExportParams(req.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	b, contentType, fileName, err := exportHistoryHelper(wallet, notesHelper(sessionID), params)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeExport(w, b, contentType, fileName)
+}
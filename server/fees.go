@@ -0,0 +1,246 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// Fee levels offered for sends.
+const (
+	// FeeLevelLow pays the minimum recommended fee, which has a strong chance
+	// of being accepted within 10 blocks.
+	FeeLevelLow = "low"
+	// FeeLevelNormal pays the average of the minimum and maximum recommended
+	// fees, which has a moderate chance of being accepted within one block.
+	FeeLevelNormal = "normal"
+	// FeeLevelHigh pays the maximum recommended fee, which targets being
+	// accepted immediately.
+	FeeLevelHigh = "high"
+	// FeeLevelCustom pays a fee per byte supplied by the user.
+	FeeLevelCustom = "custom"
+)
+
+// Estimated transaction sizes in bytes. The base and output sizes are the
+// ones the wallet estimates its batch transactions with. The wallet leaves out
+// the inputs, so the fee also pays txnInputSize for each input a transaction
+// spends.
+const (
+	coinTxnBaseSize = 1000
+	fundTxnBaseSize = 690
+	txnOutputSize   = 60
+)
+
+// Fee multipliers of batch transactions, the same as the wallet's. Coin
+// outputs pay twice the fee per byte so that sends to many outputs are not
+// rejected, and fund outputs five times so that miners select them.
+const (
+	coinFeeMultiplier = 2
+	fundFeeMultiplier = 5
+)
+
+// maxFundingAttempts is the number of times a batch transaction is funded
+// again when the inputs it spends need a larger fee than was estimated.
+const maxFundingAttempts = 5
+
+type (
+	// FeeEstimate is the fee per byte of a fee level and the total fee it
+	// costs to send a single SCP output.
+	FeeEstimate struct {
+		Level      string         `json:"level"`
+		FeePerByte types.Currency `json:"fee_per_byte"`
+		SendFee    types.Currency `json:"send_fee"`
+	}
+
+	// APIFeeEstimates lists the transaction pool's fee estimation and the fee
+	// levels derived from it.
+	APIFeeEstimates struct {
+		MinFeePerByte types.Currency `json:"min_fee_per_byte"`
+		MaxFeePerByte types.Currency `json:"max_fee_per_byte"`
+		Levels        []FeeEstimate  `json:"levels"`
+	}
+)
+
+// feeEstimatesHelper derives the low, normal and high fee levels from the
+// transaction pool's fee estimation.
+func feeEstimatesHelper() APIFeeEstimates {
+	minFee, maxFee := n.TransactionPool.FeeEstimation()
+	estimates := APIFeeEstimates{MinFeePerByte: minFee, MaxFeePerByte: maxFee}
+	perByte := map[string]types.Currency{
+		FeeLevelLow:    minFee,
+		FeeLevelNormal: minFee.Add(maxFee).Div64(2),
+		FeeLevelHigh:   maxFee,
+	}
+	for _, level := range []string{FeeLevelLow, FeeLevelNormal, FeeLevelHigh} {
+		estimates.Levels = append(estimates.Levels, FeeEstimate{
+			Level:      level,
+			FeePerByte: perByte[level],
+			SendFee:    batchFeeHelper(1, 0, 1, perByte[level]),
+		})
+	}
+	return estimates
+}
+
+// feePerByteHelper returns the fee per byte of the fee level. The normal level
+// is used when no level is supplied. A custom fee carries a unit suffix, e.g.
+// 100nS, and is read as hastings when it has none.
+func feePerByteHelper(level string, custom string) (types.Currency, error) {
+	if level == "" {
+		level = FeeLevelNormal
+	}
+	if level == FeeLevelCustom {
+		custom = strings.TrimSpace(custom)
+		if custom == "" {
+			return types.ZeroCurrency, errors.New("a custom fee per byte must be provided")
+		}
+		if strings.Trim(custom, "0123456789") == "" {
+			custom += "H"
+		}
+		feePerByte, err := NewCurrencyStr(custom)
+		if err != nil {
+			return types.ZeroCurrency, err
+		}
+		if feePerByte.IsZero() {
+			return types.ZeroCurrency, errors.New("the custom fee per byte must be greater than zero")
+		}
+		minFee, _ := n.TransactionPool.FeeEstimation()
+		if feePerByte.Cmp(minFee) < 0 {
+			return types.ZeroCurrency, fmt.Errorf("the custom fee per byte must be at least the transaction pool's minimum of %v H", minFee)
+		}
+		return feePerByte, nil
+	}
+	for _, estimate := range feeEstimatesHelper().Levels {
+		if estimate.Level == level {
+			return estimate.FeePerByte, nil
+		}
+	}
+	return types.ZeroCurrency, fmt.Errorf("fee level %s is not valid", level)
+}
+
+// feeOptionsHelper returns the fee level options of the send forms along with
+// the fee each level costs for a single SCP send.
+func feeOptionsHelper() string {
+	options := ""
+	labels := map[string]string{FeeLevelLow: "Low", FeeLevelNormal: "Normal", FeeLevelHigh: "High"}
+	for _, estimate := range feeEstimatesHelper().Levels {
+		selected := ""
+		if estimate.Level == FeeLevelNormal {
+			selected = " selected"
+		}
+		options += fmt.Sprintf("<option value='%s'%s>%s (%s H/byte, about %s per send)</option>", estimate.Level, selected, labels[estimate.Level], estimate.FeePerByte, fmtPreviewValue("SCP", estimate.SendFee))
+	}
+	options += fmt.Sprintf("<option value='%s'>Custom</option>", FeeLevelCustom)
+	return options
+}
+
+// batchFeeHelper returns the fee of a batch transaction with the number of
+// coin and fund outputs that spends the number of inputs.
+func batchFeeHelper(coinOutputs int, fundOutputs int, inputs int, feePerByte types.Currency) types.Currency {
+	fee := feePerByte.Mul64(txnInputSize * uint64(inputs))
+	if coinOutputs != 0 {
+		size := coinTxnBaseSize + txnOutputSize*uint64(coinOutputs)
+		fee = fee.Add(feePerByte.Mul64(coinFeeMultiplier * size))
+	}
+	if fundOutputs != 0 {
+		size := fundTxnBaseSize + txnOutputSize*uint64(fundOutputs)
+		fee = fee.Add(feePerByte.Mul64(fundFeeMultiplier * size))
+	}
+	return fee
+}
+
+// buildBatchHelper funds a transaction with the outputs of a single fund type
+// and a miner fee of feePerByte times its estimated size. It funds the same
+// way the wallet's batch transactions do, so a send spends as few inputs as
+// possible. When the transaction spends more inputs than its fee allowed for,
+// it is funded again with a fee for those inputs.
+func buildBatchHelper(wallet modules.Wallet, coinOutputs []types.SiacoinOutput, fundOutputs []types.SiafundOutput, spfb bool, feePerByte types.Currency) (modules.TransactionBuilder, error) {
+	if !n.ConsensusSet.Synced() {
+		return nil, errors.New("cannot build transaction until fully synced")
+	}
+	unlocked, err := wallet.Unlocked()
+	if err != nil {
+		return nil, err
+	}
+	if !unlocked {
+		return nil, modules.ErrLockedWallet
+	}
+	inputs := 1
+	for attempt := 1; ; attempt++ {
+		fee := batchFeeHelper(len(coinOutputs), len(fundOutputs), inputs, feePerByte)
+		builder, err := fundBatchHelper(wallet, coinOutputs, fundOutputs, spfb, fee)
+		if err != nil {
+			return nil, err
+		}
+		spent := spentInputsHelper(builder)
+		if spent <= inputs || attempt == maxFundingAttempts {
+			return builder, nil
+		}
+		builder.Drop()
+		inputs = spent
+	}
+}
+
+// spentInputsHelper returns the number of wallet outputs a transaction
+// spends. The wallet spends its outputs in parent transactions that create
+// the exact amounts the transaction spends, so those are counted when there
+// are parents.
+func spentInputsHelper(builder modules.TransactionBuilder) int {
+	txn, parents := builder.View()
+	if len(parents) == 0 {
+		return len(txn.SiacoinInputs) + len(txn.SiafundInputs)
+	}
+	spent := 0
+	for _, parent := range parents {
+		spent += len(parent.SiacoinInputs) + len(parent.SiafundInputs)
+	}
+	return spent
+}
+
+// fundBatchHelper funds a transaction that pays the outputs and the fee.
+func fundBatchHelper(wallet modules.Wallet, coinOutputs []types.SiacoinOutput, fundOutputs []types.SiafundOutput, spfb bool, fee types.Currency) (_ modules.TransactionBuilder, err error) {
+	builder, err := wallet.StartTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			builder.Drop()
+		}
+	}()
+	builder.AddMinerFee(fee)
+	totalCoinCost := fee
+	for _, output := range coinOutputs {
+		totalCoinCost = totalCoinCost.Add(output.Value)
+	}
+	err = builder.FundSiacoins(totalCoinCost)
+	if err != nil {
+		return nil, fmt.Errorf("not enough SCP to fund transaction: %w", err)
+	}
+	for _, output := range coinOutputs {
+		builder.AddSiacoinOutput(output)
+	}
+	if len(fundOutputs) != 0 {
+		totalFundCost := types.ZeroCurrency
+		for _, output := range fundOutputs {
+			totalFundCost = totalFundCost.Add(output.Value)
+		}
+		err = builder.FundSiafunds(totalFundCost, spfb)
+		if err != nil {
+			return nil, fmt.Errorf("not enough SPF to fund transaction: %w", err)
+		}
+		for _, output := range fundOutputs {
+			builder.AddSiafundOutput(output)
+		}
+	}
+	return builder, nil
+}
+
+func apiFeesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, feeEstimatesHelper())
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/node"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// feeTestConsensusSet is a consensus set that is always synced.
+type feeTestConsensusSet struct {
+	modules.ConsensusSet
+}
+
+func (cs *feeTestConsensusSet) Synced() bool {
+	return true
+}
+
+// feeTestWallet is an unlocked wallet whose outputs are all worth
+// outputValue, so funding an amount spends as many outputs as it takes to
+// cover it.
+type feeTestWallet struct {
+	modules.Wallet
+	outputValue types.Currency
+	builders    []*feeTestBuilder
+}
+
+func (w *feeTestWallet) Unlocked() (bool, error) {
+	return true, nil
+}
+
+func (w *feeTestWallet) StartTransaction() (modules.TransactionBuilder, error) {
+	tb := &feeTestBuilder{wallet: w}
+	w.builders = append(w.builders, tb)
+	return tb, nil
+}
+
+// feeTestBuilder funds transactions the way the wallet does, spending the
+// wallet's outputs in a parent transaction and a single input of the exact
+// amount in the transaction itself.
+type feeTestBuilder struct {
+	modules.TransactionBuilder
+	wallet  *feeTestWallet
+	txn     types.Transaction
+	parents []types.Transaction
+	dropped bool
+}
+
+func (tb *feeTestBuilder) fund(amount types.Currency) types.Transaction {
+	var parent types.Transaction
+	for funded := types.ZeroCurrency; funded.Cmp(amount) < 0; funded = funded.Add(tb.wallet.outputValue) {
+		parent.SiacoinInputs = append(parent.SiacoinInputs, types.SiacoinInput{})
+	}
+	return parent
+}
+
+func (tb *feeTestBuilder) FundSiacoins(amount types.Currency) error {
+	tb.parents = append(tb.parents, tb.fund(amount))
+	tb.txn.SiacoinInputs = append(tb.txn.SiacoinInputs, types.SiacoinInput{})
+	return nil
+}
+
+func (tb *feeTestBuilder) AddMinerFee(fee types.Currency) uint64 {
+	tb.txn.MinerFees = append(tb.txn.MinerFees, fee)
+	return uint64(len(tb.txn.MinerFees) - 1)
+}
+
+func (tb *feeTestBuilder) AddSiacoinOutput(output types.SiacoinOutput) uint64 {
+	tb.txn.SiacoinOutputs = append(tb.txn.SiacoinOutputs, output)
+	return uint64(len(tb.txn.SiacoinOutputs) - 1)
+}
+
+func (tb *feeTestBuilder) View() (types.Transaction, []types.Transaction) {
+	return tb.txn, tb.parents
+}
+
+func (tb *feeTestBuilder) Drop() {
+	tb.dropped = true
+}
+
+// TestBuildBatchInputFee checks that a batch funded by many small outputs
+// pays a fee for every output it spends.
+func TestBuildBatchInputFee(t *testing.T) {
+	oldNode := n
+	n = &node.Node{ConsensusSet: &feeTestConsensusSet{}}
+	t.Cleanup(func() { n = oldNode })
+
+	feePerByte := types.NewCurrency64(10)
+	w := &feeTestWallet{outputValue: types.NewCurrency64(100000)}
+	outputs := []types.SiacoinOutput{{Value: types.NewCurrency64(1000000)}}
+	builder, err := buildBatchHelper(w, outputs, nil, false, feePerByte)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.builders) < 2 {
+		t.Fatal("expected the batch to be funded again for its inputs")
+	}
+	for _, tb := range w.builders[:len(w.builders)-1] {
+		if !tb.dropped {
+			t.Fatal("expected the underpaid batches to be dropped")
+		}
+	}
+	txn, parents := builder.View()
+	spent := len(parents[0].SiacoinInputs)
+	if spent <= 1 {
+		t.Fatalf("expected the batch to spend many outputs, spent %d", spent)
+	}
+	if want := batchFeeHelper(1, 0, spent, feePerByte); txn.MinerFees[0].Cmp(want) < 0 {
+		t.Fatalf("batch spending %d outputs pays %v, expected at least %v", spent, txn.MinerFees[0], want)
+	}
+}
@@ -3,13 +3,12 @@ package server
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
-	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -153,58 +152,6 @@ func deleteConsensusFormHandler(w http.ResponseWriter, req *http.Request, _ http
 	writeStaticHTML(w, resources.DeleteConsensusForm(), "")
 }
 
-func transactionHistoryCsvExport(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	msgPrefix := "Unable to export transaction history: "
-	sessionID := req.FormValue("session_id")
-	if sessionID == "" {
-		msg := fmt.Sprintf("%s%v", msgPrefix, "Session ID was not supplied.")
-		writeError(w, msg, "")
-		return
-	} else if !sessionIDExists(sessionID) {
-		msg := fmt.Sprintf("%s%v", msgPrefix, "Session ID does not exist.")
-		writeError(w, msg, "")
-		return
-	}
-	wallet, err := getWallet(sessionID)
-	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	history, err := transctionHistoryCsvExportHelper(wallet)
-	if err != nil {
-		history = "failed"
-	}
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-disposition", "attachment;filename=history.csv")
-	w.Header().Set("Content-Length", strconv.Itoa(len(history))) //len(dec)
-	w.Write([]byte(history))
-}
-
-func transctionHistoryCsvExportHelper(wallet modules.Wallet) (string, error) {
-	csv := `"Transaction ID","Type","Amount SCP","Amount SPF-A","Amount SPF-B","Fee SCP", "Confirmed","DateTime"` + "\n"
-	heightMin := 0
-	confirmedTxns, err := wallet.Transactions(types.BlockHeight(heightMin), n.ConsensusSet.Height())
-	if err != nil {
-		return "", err
-	}
-	unconfirmedTxns, err := wallet.UnconfirmedTransactions()
-	if err != nil {
-		return "", err
-	}
-	sts, err := ComputeSummarizedTransactions(append(confirmedTxns, unconfirmedTxns...), n.ConsensusSet.Height(), wallet)
-	if err != nil {
-		return "", err
-	}
-	for _, txn := range sts {
-		// Format transaction type
-		if txn.Type != "SETUP" {
-			csv = csv + fmt.Sprintf(`"%s","%s","%f","%f","%f","%f","%s","%s"`, txn.TxnID, txn.Type, txn.Scp, txn.SpfA, txn.SpfB, txn.ScpFee, txn.Confirmed, txn.Time) + "\n"
-		}
-	}
-	return csv, nil
-}
-
 func privacyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	sessionID := req.FormValue("session_id")
 	html := resources.WalletHTMLTemplate()
@@ -233,8 +180,14 @@ func alertSendCoinsHandler(w http.ResponseWriter, req *http.Request, _ httproute
 		msg := "Session ID does not exist."
 		writeError(w, msg, "")
 	}
+	if watchOnlySession(sessionID) {
+		msg := fmt.Sprintf("Unable to send coins: %v", errWatchOnly)
+		writeError(w, msg, sessionID)
+		return
+	}
 	title := "SEND"
-	form := resources.SendCoinsForm()
+	form := strings.Replace(resources.SendCoinsForm(), "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	form = strings.Replace(form, "&ADDRESS_BOOK_OPTIONS;", addressBookOptionsHelper(sessionID), -1)
 	writeForm(w, title, form, sessionID)
 }
 
@@ -258,6 +211,16 @@ func alertReceiveCoinsHandler(w http.ResponseWriter, req *http.Request, _ httpro
 		writeError(w, msg, sessionID)
 		return
 	}
+	if watchOnlySession(sessionID) {
+		addresses, err := wallet.WatchAddresses()
+		if err != nil {
+			msg := fmt.Sprintf("%s%v", msgPrefix, err)
+			writeError(w, msg, sessionID)
+			return
+		}
+		writeReceiveAddresses(w, addresses, types.UnlockHash{}, "", sessionID)
+		return
+	}
 	addresses, err := wallet.LastAddresses(10)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
@@ -287,10 +250,24 @@ func alertReceiveCoinsHandler(w http.ResponseWriter, req *http.Request, _ httpro
 		writeError(w, msg, sessionID)
 		return
 	}
+	timelocked, err := timelockedAddressesHelper(wallet)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	timelock := resources.TimelockReceiveForm()
+	timelock = strings.Replace(timelock, "&TIMELOCKED_ROWS;", timelockedRowsHelper(timelocked), -1)
+	writeReceiveAddresses(w, addresses, newAddr.UnlockHash(), timelock, sessionID)
+}
+
+// writeReceiveAddresses writes the receive form listing the addresses, with
+// the new address in bold, followed by the timelock section.
+func writeReceiveAddresses(w http.ResponseWriter, addresses []types.UnlockHash, newAddr types.UnlockHash, timelock string, sessionID string) {
 	var sAddresses string
 	for _, v := range addresses {
 		tdClass := ""
-		if v.String() == newAddr.UnlockHash().String() {
+		if v.String() == newAddr.String() {
 			tdClass = " class=\"bold\""
 		}
 		sAddresses += fmt.Sprintf("<tr><td%s>%s</td><td class=\"center\"><button class=\"small-button copyButton\">Copy</button></td></tr>\n", tdClass, strings.ToUpper(v.String()))
@@ -298,6 +275,7 @@ func alertReceiveCoinsHandler(w http.ResponseWriter, req *http.Request, _ httpro
 	title := "RECEIVE"
 	formHTML := resources.ReceiveCoinsForm()
 	formHTML = strings.Replace(formHTML, "&ADDRESSES;", sAddresses, -1)
+	formHTML = strings.Replace(formHTML, "&TIMELOCK;", timelock, -1)
 	writeForm(w, title, formHTML, sessionID)
 }
 
@@ -314,7 +292,7 @@ func alertRecoverSeedHandler(w http.ResponseWriter, req *http.Request, _ httprou
 		guiHandler(w, req, nil)
 		return
 	}
-	wallet, err := getWallet(sessionID)
+	wallet, err := getSpendingWallet(sessionID)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		writeError(w, msg, sessionID)
@@ -358,7 +336,22 @@ func alertRestoreFromSeedHandler(w http.ResponseWriter, req *http.Request, _ htt
 }
 
 func unlockWalletFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeStaticHTML(w, resources.UnlockWalletForm(), "")
+	sessionID := req.FormValue("session_id")
+	if !sessionIDExists(sessionID) {
+		sessionID = ""
+	}
+	options := ""
+	wallets, err := listWallets(sessionID)
+	if err != nil {
+		fmt.Printf("Unable to list wallets: %v\n", err)
+	}
+	for _, wallet := range wallets {
+		if !wallet.Open {
+			options = options + fmt.Sprintf("<option value='%s'>", html.EscapeString(wallet.Name))
+		}
+	}
+	form := strings.Replace(resources.UnlockWalletForm(), "&WALLET_OPTIONS;", options, -1)
+	writeStaticHTML(w, form, sessionID)
 }
 
 func changeLockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -480,6 +473,7 @@ func initializeSeedHandler(w http.ResponseWriter, req *http.Request, _ httproute
 		writeError(w, msg, "")
 		return
 	}
+	startOperation(OperationInitializing, sessionID)
 	go initializeSeedHelper(newPassword, sessionID)
 	title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 	form := resources.ScanningWalletForm()
@@ -516,7 +510,11 @@ func lockWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Pa
 		return
 	}
 	wallet.Lock()
-	closeWallet(sessionID)
+	closeActiveWallet(sessionID)
+	if _, err := getWallet(sessionID); err == nil {
+		guiHandler(w, req, nil)
+		return
+	}
 	redirect(w, req, nil)
 }
 
@@ -578,6 +576,7 @@ func restoreSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.P
 		writeError(w, msg, "")
 		return
 	}
+	startOperation(OperationRestoring, sessionID)
 	go restoreSeedHelper(newPassword, seed, sessionID)
 	title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 	form := resources.ScanningWalletForm()
@@ -596,7 +595,7 @@ func sendCoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Par
 		guiHandler(w, req, nil)
 		return
 	}
-	wallet, err := getWallet(sessionID)
+	wallet, err := getSpendingWallet(sessionID)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		writeError(w, msg, "")
@@ -613,81 +612,75 @@ func sendCoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Par
 		writeError(w, msg, "")
 		return
 	}
-	// Verify destination address was supplied.
-	dest, err := scanAddress(req.FormValue("destination"))
+	coinOutputs, fundAOutputs, fundBOutputs, err := sendOutputsHelper(req.FormValue("amount"), resolveDestination(sessionID, req.FormValue("destination")), req.FormValue("unlock"), req.FormValue("coin_type"))
 	if err != nil {
-		msg := msgPrefix + "Destination is not valid."
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		writeError(w, msg, sessionID)
 		return
 	}
-	coinType := req.FormValue("coin_type")
-	if coinType == "SCP" {
-		amount, err := NewCurrencyStr(req.FormValue("amount") + "SCP")
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-		_, err = wallet.SendSiacoins(amount, dest)
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-	} else if coinType == "SPF-A" {
-		amount, err := NewCurrencyStr(req.FormValue("amount") + "SPF")
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-		_, err = wallet.SendSiafunds(amount, dest)
+	feePerByte, err := feePerByteHelper(req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	p, err := buildSendHelper(wallet, coinOutputs, fundAOutputs, fundBOutputs, feePerByte)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	setPendingSend(p, sessionID)
+	writeSendPreview(w, p.preview, "", sessionID)
+}
+
+// sendOutputsHelper parses a single send into an SCP, SPF-A or SPF-B output.
+// With an unlock height or date the output pays to the timelocked address of
+// the recipient's public key.
+func sendOutputsHelper(amount string, destination string, unlock string, coinType string) ([]types.SiacoinOutput, []types.SiafundOutput, []types.SiafundOutput, error) {
+	// Verify destination address was supplied.
+	dest, err := destinationHelper(destination, unlock)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	switch coinType {
+	case "SCP":
+		value, err := NewCurrencyStr(amount + "SCP")
 		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
+			return nil, nil, nil, err
 		}
-	} else if coinType == "SPF-B" {
-		amount, err := NewCurrencyStr(req.FormValue("amount") + "SPF")
+		return []types.SiacoinOutput{{Value: value, UnlockHash: dest}}, nil, nil, nil
+	case "SPF-A":
+		value, err := NewCurrencyStr(amount + "SPF")
 		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
+			return nil, nil, nil, err
 		}
-		_, err = wallet.SendSiafundbs(amount, dest)
+		return nil, []types.SiafundOutput{{Value: value, UnlockHash: dest}}, nil, nil
+	case "SPF-B":
+		value, err := NewCurrencyStr(amount + "SPF")
 		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
+			return nil, nil, nil, err
 		}
-	} else {
-		msg := msgPrefix + "Coin type was not supplied."
-		writeError(w, msg, sessionID)
-		return
+		return nil, nil, []types.SiafundOutput{{Value: value, UnlockHash: dest}}, nil
 	}
-	guiHandler(w, req, nil)
+	return nil, nil, nil, errors.New("coin type was not supplied")
 }
 
-func unlockWalletHelper(wallet modules.Wallet, password string, sessionID string) {
-	var msgPrefix = "Unable to unlock wallet: "
+// errInvalidPassword is returned when none of the keys derived from a
+// password unlock the wallet.
+var errInvalidPassword = errors.New("password is not valid")
+
+// unlockWallet tries every encryption key that can be derived from the
+// password and returns an error when none of them unlock the wallet.
+func unlockWallet(wallet modules.Wallet, password string) error {
 	if password == "" {
-		msg := "A password must be provided."
-		setAlert(msgPrefix+msg, sessionID)
-		if status == "Scanning" {
-			status = ""
-		}
-		return
+		return errors.New("a password must be provided")
 	}
 	potentialKeys, _ := encryptionKeys(password)
 	for _, key := range potentialKeys {
 		unlocked, err := wallet.Unlocked()
 		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			setAlert(msg, sessionID)
-			if status == "Scanning" {
-				status = ""
-			}
-			return
+			return err
 		}
 		if !unlocked {
 			wallet.Unlock(key)
@@ -695,18 +688,30 @@ func unlockWalletHelper(wallet modules.Wallet, password string, sessionID string
 	}
 	unlocked, err := wallet.Unlocked()
 	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		setAlert(msg, sessionID)
-		if status == "Scanning" {
-			status = ""
-		}
-		return
+		return err
 	}
 	if !unlocked {
-		msg := msgPrefix + "Password is not valid."
+		return errInvalidPassword
+	}
+	return nil
+}
+
+// unlockWalletHelper unlocks the wallet and closes it again when the unlock
+// fails. A session that was added for the unlock is discarded along with it.
+func unlockWalletHelper(wallet modules.Wallet, password string, added bool, sessionID string) error {
+	err := unlockWallet(wallet, password)
+	if err != nil && added {
+		finishOperation(OperationScanning, err, sessionID)
+		discardSession(sessionID)
+		return err
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Unable to unlock wallet: %v", err)
 		setAlert(msg, sessionID)
+		closeActiveWallet(sessionID)
 	}
-	status = ""
+	finishOperation(OperationScanning, err, sessionID)
+	return err
 }
 
 func unlockWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -720,22 +725,45 @@ func unlockWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.
 	if walletDirName == "" {
 		walletDirName = "wallet"
 	}
-	sessionID := addSessionID()
+	sessionID := req.FormValue("session_id")
+	added := false
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		sessionID = addSessionID()
+		added = true
+	}
 	wallet, err := existingWallet(walletDirName, sessionID)
 	if err != nil {
+		if added {
+			discardSession(sessionID)
+			sessionID = ""
+		}
 		msg := fmt.Sprintf("Unable to unlock wallet: %v", err)
 		writeError(w, msg, sessionID)
 		return
 	}
-	status = "Scanning"
-	go unlockWalletHelper(wallet, password, sessionID)
-	time.Sleep(300 * time.Millisecond)
-	if status != "" {
+	startOperation(OperationScanning, sessionID)
+	done := make(chan error, 1)
+	go func() {
+		done <- unlockWalletHelper(wallet, password, added, sessionID)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(300 * time.Millisecond):
 		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 		form := resources.ScanningWalletForm()
 		writeForm(w, title, form, sessionID)
 		return
 	}
+	if err != nil {
+		if added {
+			sessionID = ""
+		} else {
+			popAlert(sessionID)
+		}
+		msg := fmt.Sprintf("Unable to unlock wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
 	writeWallet(w, wallet, sessionID)
 }
 
@@ -787,7 +815,7 @@ func explorerHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Para
 		writeError(w, msg, sessionID)
 		return
 	}
-	transactionDetails, _ := transactionExplorerHelper(txn)
+	transactionDetails, _ := transactionExplorerHelper(txn, getDisplayUnit(sessionID))
 	html := resources.WalletHTMLTemplate()
 	html = strings.Replace(html, "&TRANSACTION_PORTAL;", transactionDetails, -1)
 	writeHTML(w, html, sessionID)
@@ -863,193 +891,6 @@ func buildingConsensusSetHandler(w http.ResponseWriter, req *http.Request, _ htt
 	writeStaticHTML(w, html, "")
 }
 
-func uploadMultispendCsvFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	sessionID := req.FormValue("session_id")
-	if sessionID == "" || !sessionIDExists(sessionID) {
-		msg := "Session ID does not exist."
-		writeError(w, msg, "")
-	}
-	title := "MULTISEND FROM CSV"
-	form := resources.MultiSendCoinsForm()
-	writeForm(w, title, form, sessionID)
-}
-
-func uploadMultispendCsvHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	sessionID := req.FormValue("session_id")
-	if sessionID == "" || !sessionIDExists(sessionID) {
-		msg := "Session ID does not exist."
-		writeError(w, msg, "")
-	}
-	cancel := req.FormValue("cancel")
-	var msgPrefix = "Unable to send coins: "
-	if cancel == "true" {
-		guiHandler(w, req, nil)
-		return
-	}
-	defaultUnit := req.FormValue("default_unit")
-	if defaultUnit != "SCP" && defaultUnit != "SPF-A" && defaultUnit != "SPF-B" {
-		defaultUnit = "SCP"
-	}
-
-	file, _, err := req.FormFile("file")
-	if err != nil {
-		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload multispend csv file: ", err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	lines, err := csv.NewReader(file).ReadAll()
-	err = file.Close()
-	if err != nil {
-		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Failed to close the multispend csv upload stream: ", err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	var coinOutputs []types.SiacoinOutput
-	var fundAOutputs []types.SiafundOutput
-	var fundBOutputs []types.SiafundOutput
-	for _, line := range lines {
-		if line == nil {
-			continue
-		}
-		amount := line[0]
-		if amount == "" {
-			continue
-		}
-		dest := line[1]
-		if dest == "" {
-			continue
-		}
-
-		//add default unit if there is none (verified by successful string parse into float)
-		if _, err := strconv.ParseFloat(amount, 64); err == nil {
-			amount += defaultUnit
-		}
-
-		// SPF-A and SPF-B are not recognised as currency units, so just "SPF" should be supplied
-		// and different methods called for transfer
-		value, err := types.NewCurrencyStr(
-			strings.ReplaceAll(
-				strings.ReplaceAll(amount, "SPF-A", "SPF"),
-				"SPF-B", "SPF"))
-		if err != nil {
-			msg := fmt.Sprintf("%sCould not parse amount: %s: %v", msgPrefix, amount, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-		var hash types.UnlockHash
-		if _, err := fmt.Sscan(dest, &hash); err != nil {
-			msg := fmt.Sprintf("%s%s%v", msgPrefix, "Failed to parse destination address: ", err)
-			writeError(w, msg, sessionID)
-			return
-		}
-		if strings.HasSuffix(amount, "SPF") || strings.HasSuffix(amount, "SPF-A") {
-			var output types.SiafundOutput
-			output.Value = value
-			output.UnlockHash = hash
-			fundAOutputs = append(fundAOutputs, output)
-		} else if strings.HasSuffix(amount, "SPF-B") {
-			var output types.SiafundOutput
-			output.Value = value
-			output.UnlockHash = hash
-			fundBOutputs = append(fundBOutputs, output)
-		} else {
-			var output types.SiacoinOutput
-			output.Value = value
-			output.UnlockHash = hash
-			coinOutputs = append(coinOutputs, output)
-		}
-	}
-	if len(coinOutputs) == 0 && len(fundAOutputs) == 0 && len(fundBOutputs) == 0 {
-		msg := fmt.Sprintf("%s%s%v", msgPrefix, "No ScPrime outputs were supplied: ", err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	wallet, err := getWallet(sessionID)
-	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	unlocked, err := wallet.Unlocked()
-	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	if !unlocked {
-		msg := msgPrefix + "Wallet is locked."
-		writeError(w, msg, sessionID)
-		return
-	}
-	// Mock the transaction to verify that the wallet is able to fund all transactions.
-	// SPF-A and SPF-B cannot be sent in same transaction
-	txnBuilder, err := wallet.BuildUnsignedBatchTransaction(coinOutputs, fundAOutputs, nil)
-	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	txnBuilder.Drop()
-	// test SCP+SPF-B
-	txnBuilder, err = wallet.BuildUnsignedBatchTransaction(coinOutputs, nil, fundBOutputs)
-	if err != nil {
-		msg := fmt.Sprintf("%s%v", msgPrefix, err)
-		writeError(w, msg, sessionID)
-		return
-	}
-	txnBuilder.Drop()
-	// Send the transactions
-	if len(coinOutputs) != 0 {
-		_, err = wallet.SendBatchTransaction(coinOutputs, nil, nil)
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-	}
-	if len(fundAOutputs) != 0 {
-		_, err = wallet.SendBatchTransaction(nil, fundAOutputs, nil)
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-	}
-	if len(fundBOutputs) != 0 {
-		_, err = wallet.SendBatchTransaction(nil, nil, fundBOutputs)
-		if err != nil {
-			msg := fmt.Sprintf("%s%v", msgPrefix, err)
-			writeError(w, msg, sessionID)
-			return
-		}
-	}
-	guiHandler(w, req, nil)
-}
-
-func importExportNotesFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	sessionID := req.FormValue("session_id")
-	if sessionID == "" || !sessionIDExists(sessionID) {
-		msg := "Session ID does not exist."
-		writeError(w, msg, "")
-	}
-	title := "IMPORT / EXPORT NOTES"
-	form := resources.ImportExportNotesForm()
-	writeForm(w, title, form, sessionID)
-}
-
-func importExportNotesCancelHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	sessionID := req.FormValue("session_id")
-	if sessionID == "" || !sessionIDExists(sessionID) {
-		msg := "Session ID does not exist."
-		writeError(w, msg, "")
-	}
-	cancel := req.FormValue("cancel")
-	if cancel == "true" {
-		guiHandler(w, req, nil)
-		return
-	}
-}
-
 func uploadConsensusSetFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	writeStaticHTML(w, resources.ConsensusSetUploadingHTML(), "")
 }
@@ -1120,6 +961,32 @@ func collapseMenuHandler(w http.ResponseWriter, req *http.Request, _ httprouter.
 	writeHTML(w, getCachedPage(sessionID), sessionID)
 }
 
+func setDisplayUnitHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	unit := req.FormValue("display_unit")
+	if _, ok := displayUnitExponent(unit); !ok {
+		msg := fmt.Sprintf("Unable to set display unit: %s is not a unit, use one of %s", unit, strings.Join(DisplayUnits, ", "))
+		writeError(w, msg, sessionID)
+		return
+	}
+	setDisplayUnit(unit, sessionID)
+	guiHandler(w, req, nil)
+}
+
+func extendSessionHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	touchSession(sessionID)
+	guiHandler(w, req, nil)
+}
+
 func scanningHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	sessionID := req.FormValue("session_id")
 	if sessionID == "" || !sessionIDExists(sessionID) {
@@ -1133,18 +1000,22 @@ func scanningHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Para
 		return
 	}
 	height, _, _ := blockHeightHelper(sessionID)
-	if height == "0" && status != "" {
+	if height == "0" && operationRunning(sessionID) {
 		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 		form := resources.ScanningWalletForm()
 		writeForm(w, title, form, sessionID)
 		return
 	}
-	if status != "" {
+	if operationRunning(sessionID) {
 		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 		form := resources.ScanningWalletForm()
 		writeForm(w, title, form, sessionID)
 		return
 	}
+	if p, ok := sweptPendingSend(sessionID); ok {
+		writeSendPreview(w, p.preview, p.summary, sessionID)
+		return
+	}
 	guiHandler(w, req, nil)
 }
 
@@ -1181,13 +1052,13 @@ func guiHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 		return
 	}
 	height, _, _ := blockHeightHelper(sessionID)
-	if height == "0" && status != "" {
+	if height == "0" && operationRunning(sessionID) {
 		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 		form := resources.ScanningWalletForm()
 		writeForm(w, title, form, sessionID)
 		return
 	}
-	if status != "" {
+	if operationRunning(sessionID) {
 		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
 		form := resources.ScanningWalletForm()
 		writeForm(w, title, form, sessionID)
@@ -1203,13 +1074,18 @@ func guiHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 		writeWallet(w, wallet, sessionID)
 		return
 	}
-	closeWallet(sessionID)
+	closeActiveWallet(sessionID)
+	if _, err := getWallet(sessionID); err == nil {
+		guiHandler(w, req, nil)
+		return
+	}
 	redirect(w, req, nil)
 }
 
 func writeWallet(w http.ResponseWriter, wallet modules.Wallet, sessionID string) {
 	html := resources.WalletHTMLTemplate()
 	html = strings.Replace(html, "&TRANSACTION_PORTAL;", resources.TransactionsHistoryHTMLTemplate(), -1)
+	html = strings.Replace(html, "&TX_HISTORY_FILTER;", historyFilterFormHelper(sessionID), -1)
 	writeHTML(w, html, sessionID)
 }
 
@@ -1262,11 +1138,17 @@ func writeHTML(w http.ResponseWriter, html string, sessionID string) {
 		return
 	}
 	cachedPage(html, sessionID)
+	touchSession(sessionID)
+	html = strings.Replace(html, "&SESSION_EXPIRES;", fmt.Sprintf("%d", int(sessionExpiresIn(sessionID).Seconds())), -1)
 	html = strings.Replace(html, "&WEB_WALLET_VERSION;", build.Version, -1)
 	html = strings.Replace(html, "&SPD_VERSION;", spdBuild.Version, -1)
-	session, _ := getSession(sessionID)
-	if session != nil {
-		html = strings.Replace(html, "&SESSION_NAME;", session.name, -1)
+	session, err := getSession(sessionID)
+	if err == nil {
+		name := session.name
+		if watchOnlySession(sessionID) {
+			name += " (watch-only)"
+		}
+		html = strings.Replace(html, "&SESSION_NAME;", name, -1)
 	}
 	fmtHeight, fmtStatus, fmtStatCo := blockHeightHelper(sessionID)
 	html = strings.Replace(html, "&STATUS_COLOR;", fmtStatCo, -1)
@@ -1278,15 +1160,40 @@ func writeHTML(w http.ResponseWriter, html string, sessionID string) {
 	html = strings.Replace(html, "&SPFA_BALANCE;", fmtSpfaBal, -1)
 	html = strings.Replace(html, "&SPFB_BALANCE;", fmtSpfbBal, -1)
 	html = strings.Replace(html, "&SCP_CLAIM_BALANCE;", fmtClmBal, -1)
+	html = strings.Replace(html, "&DISPLAY_UNIT;", getDisplayUnit(sessionID), -1)
+	html = strings.Replace(html, "&DISPLAY_UNIT_OPTIONS;", displayUnitOptionsHelper(getDisplayUnit(sessionID)), -1)
 	html = strings.Replace(html, "&WHALE_SIZE;", fmtWhale, -1)
+	html = strings.Replace(html, "&AGGREGATE_BALANCE;", aggregateBalanceHelper(sessionID), -1)
 	if menuIsCollapsed(sessionID) {
 		html = strings.Replace(html, "&MENU;", resources.CollapsedMenuForm(), -1)
 	} else {
-		html = strings.Replace(html, "&MENU;", resources.ExpandedMenuForm(), -1)
+		menu := resources.ExpandedMenuForm()
+		offlineSigning := ""
+		if watchOnlySession(sessionID) {
+			menu = watchOnlyMenuHelper(menu)
+			offlineSigning = resources.OfflineSigningMenuForm()
+		}
+		menu = strings.Replace(menu, "&OFFLINE_SIGNING;", offlineSigning, -1)
+		html = strings.Replace(html, "&MENU;", menu, -1)
+		html = strings.Replace(html, "&WALLET_SWITCHER;", walletSwitcherHelper(sessionID), -1)
 	}
 	writeStaticHTML(w, html, sessionID)
 }
 
+// displayUnitOptionsHelper returns the options of the display unit select.
+// Units are case sensitive, so mS and MS are told apart.
+func displayUnitOptionsHelper(selected string) string {
+	options := ""
+	for _, unit := range DisplayUnits {
+		attr := ""
+		if unit == selected {
+			attr = " selected"
+		}
+		options += fmt.Sprintf("<option value='%s'%s>%s</option>\n", unit, attr, unit)
+	}
+	return options
+}
+
 func whaleHelper(scpBal float64) string {
 	if scpBal < 50 {
 		return "🦐"
@@ -1339,8 +1246,9 @@ func balancesHelper(sessionID string) (string, string, string, string, string, s
 	if err != nil {
 		fmt.Printf("Unable to determine if wallet is unlocked: %v", err)
 	}
+	unit := getDisplayUnit(sessionID)
 	if unlocked {
-		allBals, err := wallet.ConfirmedBalance()
+		allBals, _, err := confirmedBalanceHelper(wallet)
 		if err != nil {
 			fmt.Printf("Unable to obtain confirmed balance: %v", err)
 		} else {
@@ -1350,22 +1258,18 @@ func balancesHelper(sessionID string) (string, string, string, string, string, s
 			// fundbBBal := allBals.FundbBalance
 			claimBal := allBals.ClaimBalance
 			// claimbBal := allBals.ClaimbBalance
-			scpBalFloat, _ := new(big.Rat).SetFrac(scpBal.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-			scpClaimBalFloat, _ := new(big.Rat).SetFrac(claimBal.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-			fmtScpBal = fmt.Sprintf("%15.4f", scpBalFloat)
+			fmtScpBal = NewExactCurrency(scpBal).Format(unit)
 			fmtSpfaBal = fmt.Sprintf("%s", fundABal)
 			fmtSpfbBal = fmt.Sprintf("%s", fundBBal)
-			fmtClmBal = fmt.Sprintf("%15.4f", scpClaimBalFloat)
-			fmtWhale = whaleHelper(scpBalFloat)
+			fmtClmBal = NewExactCurrency(claimBal).Format(unit)
+			fmtWhale = whaleHelper(NewExactCurrency(scpBal).Float64())
 
 		}
 		scpOut, scpIn, err := wallet.UnconfirmedBalance()
 		if err != nil {
 			fmt.Printf("Unable to obtain unconfirmed balance: %v", err)
 		} else {
-			scpInFloat, _ := new(big.Rat).SetFrac(scpIn.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-			scpOutFloat, _ := new(big.Rat).SetFrac(scpOut.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-			fmtUncBal = fmt.Sprintf("%15.4f", (scpInFloat - scpOutFloat))
+			fmtUncBal = NewExactCurrency(scpIn).Sub(NewExactCurrency(scpOut)).Format(unit)
 		}
 	}
 	return fmtScpBal, fmtUncBal, fmtSpfaBal, fmtSpfbBal, fmtClmBal, fmtWhale
@@ -1383,7 +1287,7 @@ func blockHeightHelper(sessionID string) (string, string, string) {
 	} else {
 		fmtHeight = fmt.Sprintf("%d", height)
 	}
-	if status != "" {
+	if status := operationStatus(sessionID); status != "" {
 		return fmtHeight, status, "yellow"
 	}
 	rescanning, err := wallet.Rescanning()
@@ -1401,15 +1305,12 @@ func blockHeightHelper(sessionID string) (string, string, string) {
 }
 
 func initializeSeedHelper(newPassword string, sessionID string) {
-	setStatus("Initializing")
 	msgPrefix := "Unable to initialize new wallet seed: "
 	wallet, err := getWallet(sessionID)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		setAlert(msg, sessionID)
-		if status == "Initializing" {
-			status = ""
-		}
+		finishOperation(OperationInitializing, err, sessionID)
 		return
 	}
 	var encryptionKey crypto.CipherKey = crypto.NewWalletKey(crypto.HashObject(newPassword))
@@ -1417,27 +1318,24 @@ func initializeSeedHelper(newPassword string, sessionID string) {
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		setAlert(msg, sessionID)
-		if status == "Initializing" {
-			status = ""
-		}
+		finishOperation(OperationInitializing, err, sessionID)
 		return
 	}
+	setOperationProgress(OperationInitializing, 0.5, sessionID)
 	potentialKeys, _ := encryptionKeys(newPassword)
 	for _, key := range potentialKeys {
 		unlocked, err := wallet.Unlocked()
 		if err != nil {
 			msg := fmt.Sprintf("%s%v", msgPrefix, err)
 			setAlert(msg, sessionID)
-			if status == "Initializing" {
-				status = ""
-			}
+			finishOperation(OperationInitializing, err, sessionID)
 			return
 		}
 		if !unlocked {
 			wallet.Unlock(key)
 		}
 	}
-	setStatus("")
+	finishOperation(OperationInitializing, nil, sessionID)
 }
 
 func isPasswordValid(wallet modules.Wallet, password string) (bool, error) {
@@ -1457,7 +1355,6 @@ func isPasswordValid(wallet modules.Wallet, password string) (bool, error) {
 }
 
 func restoreSeedHelper(newPassword string, seed modules.Seed, sessionID string) {
-	setStatus("Restoring")
 	for !n.ConsensusSet.Synced() {
 		time.Sleep(25 * time.Millisecond)
 	}
@@ -1466,9 +1363,7 @@ func restoreSeedHelper(newPassword string, seed modules.Seed, sessionID string)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		setAlert(msg, sessionID)
-		if status == "Restoring" {
-			status = ""
-		}
+		finishOperation(OperationRestoring, err, sessionID)
 		return
 	}
 	var encryptionKey crypto.CipherKey = crypto.NewWalletKey(crypto.HashObject(newPassword))
@@ -1476,9 +1371,7 @@ func restoreSeedHelper(newPassword string, seed modules.Seed, sessionID string)
 	if err != nil {
 		msg := fmt.Sprintf("%s%v", msgPrefix, err)
 		setAlert(msg, sessionID)
-		if status == "Restoring" {
-			status = ""
-		}
+		finishOperation(OperationRestoring, err, sessionID)
 		return
 	}
 	potentialKeys, _ := encryptionKeys(newPassword)
@@ -1487,19 +1380,26 @@ func restoreSeedHelper(newPassword string, seed modules.Seed, sessionID string)
 		if err != nil {
 			msg := fmt.Sprintf("%s%v", msgPrefix, err)
 			setAlert(msg, sessionID)
-			if status == "Restoring" {
-				status = ""
-			}
+			finishOperation(OperationRestoring, err, sessionID)
 			return
 		}
 		if !unlocked {
 			wallet.Unlock(key)
 		}
 	}
-	setStatus("")
+	finishOperation(OperationRestoring, nil, sessionID)
 }
 
-func transactionExplorerHelper(txn modules.ProcessedTransaction) (string, error) {
+// explorerValueHelper formats the value of an input or output, showing SCP in
+// the display unit and SPF as whole funds.
+func explorerValueHelper(fundType types.Specifier, value types.Currency, unit string) string {
+	if fundType == types.SpecifierSiafundInput || fundType == types.SpecifierSiafundOutput {
+		return NewExactFunds(value).HumanString(unit)
+	}
+	return NewExactCurrency(value).HumanString(unit)
+}
+
+func transactionExplorerHelper(txn modules.ProcessedTransaction, unit string) (string, error) {
 	unixTime, _ := strconv.ParseInt(fmt.Sprintf("%v", txn.ConfirmationTimestamp), 10, 64)
 	fmtTime := strings.ToUpper(time.Unix(unixTime, 0).Format("2006-01-02 15:04"))
 	fmtTxnID := strings.ToUpper(fmt.Sprintf("%v", txn.TransactionID))
@@ -1512,7 +1412,7 @@ func transactionExplorerHelper(txn modules.ProcessedTransaction) (string, error)
 	html = strings.Replace(html, "&TXN_BLOCK;", fmtTxnBlock, -1)
 	inputs := ""
 	for _, input := range txn.Inputs {
-		fmtValue := strings.ToUpper(fmt.Sprintf("%v", input.Value))
+		fmtValue := explorerValueHelper(input.FundType, input.Value, unit)
 		fmtAddress := strings.ToUpper(fmt.Sprintf("%v", input.RelatedAddress))
 		fmtFundType := strings.ToUpper(strings.Replace(fmt.Sprintf("%v", input.FundType), "_", " ", -1))
 		fmtFundType = strings.Replace(fmtFundType, "SIACOIN", "SCP", -1)
@@ -1526,7 +1426,7 @@ func transactionExplorerHelper(txn modules.ProcessedTransaction) (string, error)
 	html = strings.Replace(html, "&TXN_INPUTS;", inputs, -1)
 	outputs := ""
 	for _, output := range txn.Outputs {
-		fmtValue := strings.ToUpper(fmt.Sprintf("%v", output.Value))
+		fmtValue := explorerValueHelper(output.FundType, output.Value, unit)
 		fmtAddress := strings.ToUpper(fmt.Sprintf("%v", output.RelatedAddress))
 		fmtFundType := strings.ToUpper(strings.Replace(fmt.Sprintf("%v", output.FundType), "_", " ", -1))
 		fmtFundType = strings.Replace(fmtFundType, "SIACOIN", "SCP", -1)
@@ -1545,6 +1445,7 @@ type TransactionHistoryPage struct {
 	TransactionHistoryLines []TransactionHistoryLine `json:"lines"`
 	Current                 int                      `json:"current"`
 	Total                   int                      `json:"total"`
+	MigrateNotes            bool                     `json:"migrate_notes"`
 }
 
 type TransactionHistoryLine struct {
@@ -1554,7 +1455,9 @@ type TransactionHistoryLine struct {
 	Time               string `json:"time"`
 	Amount             string `json:"amount"`
 	Fee                string `json:"fee"`
-	Confirmed          string `json:"confirmed"`
+	Confirmed          string   `json:"confirmed"`
+	Note               string   `json:"note"`
+	Tags               []string `json:"tags"`
 }
 
 func transactionHistoryJson(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -1576,77 +1479,63 @@ func transactionHistoryJson(w http.ResponseWriter, req *http.Request, _ httprout
 		w.Write([]byte(fmt.Sprintf(msgPrefix+"%v", err)))
 		return
 	}
-	page := getTxHistoryPage(sessionID)
-	pageSize := 20
-	pageMin := (page - 1) * pageSize
-	pageMax := page * pageSize
-	count := 0
-	heightMin := 0
-	confirmedTxns, err := wallet.Transactions(types.BlockHeight(heightMin), n.ConsensusSet.Height())
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf(msgPrefix+"%v", err)))
-		return
-	}
-	unconfirmedTxns, err := wallet.UnconfirmedTransactions()
+	filter, err := parseHistoryFilter(historyFilterValues(sessionID, req))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(fmt.Sprintf(msgPrefix+"%v", err)))
 		return
 	}
-	sts, err := ComputeSummarizedTransactions(append(confirmedTxns, unconfirmedTxns...), n.ConsensusSet.Height(), wallet)
+	notes := notesHelper(sessionID)
+	sts, err := historyHelper(wallet, notes, filter)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(fmt.Sprintf(msgPrefix+"%v", err)))
 		return
 	}
+	page, current, pages := historyPage(sts, filter)
+	unit := getDisplayUnit(sessionID)
 	lines := []TransactionHistoryLine{}
-	// iterate in reverse
-	for i := len(sts) - 1; i >= 0; i-- {
-		txn := sts[i]
-		// Format transaction type
-		isSetup := txn.Type == "SETUP" && txn.Scp == 0 && txn.SpfA == 0 && txn.SpfB == 0
-		if !isSetup {
-			count++
-			if count >= pageMin && count < pageMax {
-				var amountArr []string
-				if txn.Scp != 0 {
-					amountArr = append(amountArr, strings.TrimRight(strings.TrimRight(fmt.Sprintf("%15.4f", txn.Scp), "0"), ".")+" SCP")
-				}
-				if txn.SpfA != 0 {
-					postfix := "SPF-A"
-					if txn.Confirmed == _stUnconfirmedStr { // in case of unconfirmed we just show SPF
-						postfix = "SPF"
-					}
-					amountArr = append(amountArr, fmt.Sprintf("%14v %s", txn.SpfA, postfix))
-				}
-				if txn.SpfB != 0 {
-					amountArr = append(amountArr, fmt.Sprintf("%14v SPF-B", txn.SpfB))
-				}
-				fmtAmount := strings.Join(amountArr, "; ")
-				if fmtAmount == "" {
-					fmtAmount = "0 SCP/SPF"
-				}
-				var fmtFee string
-				if txn.ScpFee != 0 {
-					fmtFee = fmt.Sprintf("%f SCP fee", txn.ScpFee)
-				}
-				line := TransactionHistoryLine{}
-				line.TransactionID = txn.TxnID
-				line.ShortTransactionID = txn.TxnID[0:16] + "..." + txn.TxnID[len(txn.TxnID)-16:]
-				line.Type = txn.Type
-				line.Time = txn.Time
-				line.Amount = fmtAmount
-				line.Fee = fmtFee
-				line.Confirmed = txn.Confirmed
-				lines = append(lines, line)
+	for _, txn := range page {
+		var amountArr []string
+		if !txn.Scp.IsZero() {
+			amountArr = append(amountArr, txn.Scp.HumanString(unit))
+		}
+		if !txn.SpfA.IsZero() {
+			postfix := "SPF-A"
+			if txn.Confirmed == _stUnconfirmedStr { // in case of unconfirmed we just show SPF
+				postfix = "SPF"
 			}
+			amountArr = append(amountArr, fmt.Sprintf("%s %s", txn.SpfA, postfix))
+		}
+		if !txn.SpfB.IsZero() {
+			amountArr = append(amountArr, fmt.Sprintf("%s SPF-B", txn.SpfB))
+		}
+		fmtAmount := strings.Join(amountArr, "; ")
+		if fmtAmount == "" {
+			fmtAmount = "0 SCP/SPF"
 		}
+		var fmtFee string
+		if !txn.ScpFee.IsZero() {
+			fmtFee = txn.ScpFee.HumanString(unit) + " fee"
+		}
+		line := TransactionHistoryLine{}
+		line.TransactionID = txn.TxnID
+		line.ShortTransactionID = shortTransactionID(txn.TxnID)
+		line.Type = txn.Type
+		line.Time = txn.Time
+		line.Amount = fmtAmount
+		line.Fee = fmtFee
+		line.Confirmed = txn.Confirmed
+		note := transactionNote(notes, txn.TxnID)
+		line.Note = note.Note
+		line.Tags = note.Tags
+		lines = append(lines, line)
 	}
 	txHistoryPage := TransactionHistoryPage{}
 	txHistoryPage.TransactionHistoryLines = lines
-	txHistoryPage.Current = page
-	txHistoryPage.Total = (count / pageSize) + 1
+	txHistoryPage.Current = current
+	txHistoryPage.Total = pages
+	txHistoryPage.MigrateNotes = !notesMigratedHelper(sessionID)
 	json, err := json.Marshal(txHistoryPage)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -1668,6 +1557,21 @@ func scanAddress(addrStr string) (addr types.UnlockHash, err error) {
 	return addr, nil
 }
 
+// scanPublicKey scans an ed25519 types.SiaPublicKey from a string.
+func scanPublicKey(pkStr string) (types.SiaPublicKey, error) {
+	var spk types.SiaPublicKey
+	if !strings.HasPrefix(strings.ToLower(pkStr), types.SignatureEd25519.String()+":") {
+		return spk, errors.New("not an ed25519 public key")
+	}
+	if err := spk.LoadString(strings.ToLower(pkStr)); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	if len(spk.Key) != crypto.PublicKeySize {
+		return types.SiaPublicKey{}, errors.New("wrong public key size")
+	}
+	return spk, nil
+}
+
 // encryptionKeys enumerates the possible encryption keys that can be derived
 // from an input string.
 // copied from "gitlab.com/scpcorp/ScPrime/node/wallet.go"
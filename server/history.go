@@ -0,0 +1,438 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/modules/txnotes"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+const (
+	// defaultHistoryPageSize is the number of transactions on a history page
+	// when the caller does not choose one.
+	defaultHistoryPageSize = 20
+	// maxHistoryPageSize is the largest history page a caller can ask for.
+	maxHistoryPageSize = 1000
+)
+
+// historyFilterKeys are the query parameters that filter, sort and page the
+// transaction history.
+var historyFilterKeys = []string{"from", "to", "min_height", "max_height", "type", "coin", "direction", "min_amount", "max_amount", "confirmed", "search", "sort", "page", "page_size"}
+
+// historyDateLayouts are the accepted formats of the from and to dates.
+var historyDateLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339}
+
+// historySorts are the sort orders of the transaction history.
+var historySorts = []string{"newest", "oldest", "largest", "smallest"}
+
+// historyPageSizes are the page sizes offered by the GUI.
+var historyPageSizes = []string{"20", "50", "100", "500"}
+
+// APIHistoryTransaction is a summarized transaction with its note and tags.
+type APIHistoryTransaction struct {
+	SummarizedTransaction
+	Note string   `json:"note"`
+	Tags []string `json:"tags"`
+}
+
+// APITransactionHistory is a page of the transactions that match a filter.
+type APITransactionHistory struct {
+	Transactions []APIHistoryTransaction `json:"transactions"`
+	Page         int                     `json:"page"`
+	PageSize     int                     `json:"page_size"`
+	Pages        int                     `json:"pages"`
+	Count        int                     `json:"count"`
+}
+
+// historyFilter selects, sorts and pages the transaction history. Nil bounds
+// are not checked.
+type historyFilter struct {
+	from      *time.Time
+	to        *time.Time
+	minHeight *types.BlockHeight
+	maxHeight *types.BlockHeight
+	txType    string
+	coin      string
+	direction string
+	minAmount *big.Rat
+	maxAmount *big.Rat
+	confirmed string
+	search    string
+	sort      string
+	page      int
+	pageSize  int
+}
+
+// parseHistoryDate parses a from or to date. A to date without a time
+// includes the whole day.
+func parseHistoryDate(value string, endOfDay bool) (*time.Time, error) {
+	for _, layout := range historyDateLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if endOfDay && layout == historyDateLayouts[0] {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return &t, nil
+	}
+	return nil, fmt.Errorf("%s is not a date, use YYYY-MM-DD", value)
+}
+
+// parseHistoryHeight parses a block height bound.
+func parseHistoryHeight(value string) (*types.BlockHeight, error) {
+	height, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a block height", value)
+	}
+	bh := types.BlockHeight(height)
+	return &bh, nil
+}
+
+// parseHistoryAmount parses an amount bound in SCP or SPF.
+func parseHistoryAmount(value string) (*big.Rat, error) {
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("%s is not an amount", value)
+	}
+	return amount, nil
+}
+
+// parseHistoryFilter reads the history filter from the query parameters.
+// Empty parameters are ignored.
+func parseHistoryFilter(values url.Values) (historyFilter, error) {
+	filter := historyFilter{sort: "newest", page: 1, pageSize: defaultHistoryPageSize}
+	var err error
+	get := func(key string) string {
+		return strings.TrimSpace(values.Get(key))
+	}
+	if v := get("from"); v != "" {
+		if filter.from, err = parseHistoryDate(v, false); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("to"); v != "" {
+		if filter.to, err = parseHistoryDate(v, true); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("min_height"); v != "" {
+		if filter.minHeight, err = parseHistoryHeight(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("max_height"); v != "" {
+		if filter.maxHeight, err = parseHistoryHeight(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("min_amount"); v != "" {
+		if filter.minAmount, err = parseHistoryAmount(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("max_amount"); v != "" {
+		if filter.maxAmount, err = parseHistoryAmount(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("type"); v != "" {
+		filter.txType = strings.ToUpper(strings.Replace(v, "_", " ", -1))
+	}
+	switch v := strings.ToUpper(get("coin")); v {
+	case "", "SCP", "SPF-A", "SPF-B":
+		filter.coin = v
+	default:
+		return filter, fmt.Errorf("coin must be SCP, SPF-A or SPF-B")
+	}
+	switch v := strings.ToLower(get("direction")); v {
+	case "", "in", "out":
+		filter.direction = v
+	default:
+		return filter, fmt.Errorf("direction must be in or out")
+	}
+	switch v := strings.ToLower(get("confirmed")); v {
+	case "":
+	case "yes", "true":
+		filter.confirmed = _stConfirmedStr
+	case "no", "false":
+		filter.confirmed = _stUnconfirmedStr
+	default:
+		return filter, fmt.Errorf("confirmed must be yes or no")
+	}
+	filter.search = strings.ToLower(get("search"))
+	if v := strings.ToLower(get("sort")); v != "" {
+		filter.sort = ""
+		for _, s := range historySorts {
+			if v == s {
+				filter.sort = s
+			}
+		}
+		if filter.sort == "" {
+			return filter, fmt.Errorf("sort must be one of %s", strings.Join(historySorts, ", "))
+		}
+	}
+	if v := get("page"); v != "" {
+		if filter.page, err = strconv.Atoi(v); err != nil || filter.page < 1 {
+			return filter, fmt.Errorf("%s is not a page number", v)
+		}
+	}
+	if v := get("page_size"); v != "" {
+		if filter.pageSize, err = strconv.Atoi(v); err != nil || filter.pageSize < 1 || filter.pageSize > maxHistoryPageSize {
+			return filter, fmt.Errorf("page size must be between 1 and %d", maxHistoryPageSize)
+		}
+	}
+	return filter, nil
+}
+
+// historyAmount returns the amount of the coin the transaction moved, or of
+// the first of SCP, SPF-A and SPF-B it moved when coin is empty.
+func historyAmount(st SummarizedTransaction, coin string) ExactCurrency {
+	switch coin {
+	case "SCP":
+		return st.Scp
+	case "SPF-A":
+		return st.SpfA
+	case "SPF-B":
+		return st.SpfB
+	}
+	for _, amount := range []ExactCurrency{st.Scp, st.SpfA, st.SpfB} {
+		if !amount.IsZero() {
+			return amount
+		}
+	}
+	return st.Scp
+}
+
+// matches returns true when the transaction and its note pass the filter.
+// Unconfirmed transactions are above every height bound.
+func (f historyFilter) matches(st SummarizedTransaction, note txnotes.Note) bool {
+	if f.txType != "" && st.Type != f.txType {
+		return false
+	}
+	if f.confirmed != "" && st.Confirmed != f.confirmed {
+		return false
+	}
+	if st.Confirmed == _stConfirmedStr {
+		if (f.minHeight != nil && st.Height < *f.minHeight) || (f.maxHeight != nil && st.Height > *f.maxHeight) {
+			return false
+		}
+	} else if f.maxHeight != nil {
+		return false
+	}
+	if f.from != nil || f.to != nil {
+		// Unconfirmed transactions are dated now.
+		t := time.Now()
+		if st.Confirmed == _stConfirmedStr {
+			t = time.Unix(st.Timestamp, 0)
+		}
+		if (f.from != nil && t.Before(*f.from)) || (f.to != nil && t.After(*f.to)) {
+			return false
+		}
+	}
+	amount := historyAmount(st, f.coin)
+	if f.coin != "" && amount.IsZero() {
+		return false
+	}
+	if (f.direction == "in" && amount.Sign() <= 0) || (f.direction == "out" && amount.Sign() >= 0) {
+		return false
+	}
+	abs := amount.Abs().Rat()
+	if (f.minAmount != nil && abs.Cmp(f.minAmount) < 0) || (f.maxAmount != nil && abs.Cmp(f.maxAmount) > 0) {
+		return false
+	}
+	if f.search != "" {
+		fields := append([]string{st.TxnID, note.Note}, st.Addresses...)
+		fields = append(fields, note.Tags...)
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), f.search) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// historyHelper returns the wallet's transactions that pass the filter in the
+// filter's sort order, reading the confirmed ones from the wallet's history
+// cache. Setup transactions that move nothing are left out.
+func historyHelper(wallet modules.Wallet, notes map[string]txnotes.Note, filter historyFilter) ([]SummarizedTransaction, error) {
+	sts, err := cachedHistoryHelper(wallet)
+	if err != nil {
+		return nil, err
+	}
+	var matches []SummarizedTransaction
+	// iterate in reverse so the newest transaction comes first
+	for i := len(sts) - 1; i >= 0; i-- {
+		st := sts[i]
+		isSetup := st.Type == "SETUP" && st.Scp.IsZero() && st.SpfA.IsZero() && st.SpfB.IsZero()
+		if !isSetup && filter.matches(st, transactionNote(notes, st.TxnID)) {
+			matches = append(matches, st)
+		}
+	}
+	switch filter.sort {
+	case "oldest":
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	case "largest", "smallest":
+		sort.SliceStable(matches, func(i, j int) bool {
+			c := historyAmount(matches[i], filter.coin).Abs().Rat().Cmp(historyAmount(matches[j], filter.coin).Abs().Rat())
+			if filter.sort == "largest" {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+	return matches, nil
+}
+
+// historyPage returns the filter's page of the transactions, the page number
+// after clamping it to the last page and the number of pages.
+func historyPage(sts []SummarizedTransaction, filter historyFilter) ([]SummarizedTransaction, int, int) {
+	pages := (len(sts) + filter.pageSize - 1) / filter.pageSize
+	if pages == 0 {
+		pages = 1
+	}
+	page := filter.page
+	if page > pages {
+		page = pages
+	}
+	start := (page - 1) * filter.pageSize
+	end := start + filter.pageSize
+	if end > len(sts) {
+		end = len(sts)
+	}
+	return sts[start:end], page, pages
+}
+
+// historyFilterValues merges the session's stored history filter with the
+// filter parameters of the request, which take precedence.
+func historyFilterValues(sessionID string, req *http.Request) url.Values {
+	values, _ := url.ParseQuery(getTxHistoryFilter(sessionID))
+	if values.Get("page") == "" {
+		values.Set("page", strconv.Itoa(getTxHistoryPage(sessionID)))
+	}
+	for _, key := range historyFilterKeys {
+		if v := req.FormValue(key); v != "" {
+			values.Set(key, v)
+		}
+	}
+	return values
+}
+
+// selectOptionsHelper returns select options with the supplied value
+// selected. labels are shown in place of the values when supplied.
+func selectOptionsHelper(values []string, labels []string, selected string) string {
+	options := ""
+	for i, value := range values {
+		label := value
+		if i < len(labels) {
+			label = labels[i]
+		}
+		attr := ""
+		if strings.EqualFold(value, selected) {
+			attr = " selected"
+		}
+		options += fmt.Sprintf("<option value='%s'%s>%s</option>\n", html.EscapeString(value), attr, html.EscapeString(label))
+	}
+	return options
+}
+
+// historyFilterFormHelper returns the history filter form filled in with the
+// session's stored filter.
+func historyFilterFormHelper(sessionID string) string {
+	values, _ := url.ParseQuery(getTxHistoryFilter(sessionID))
+	txTypes := []string{""}
+	for t := modules.TXTypeSetup; t <= modules.TXTypeMixed; t++ {
+		txTypes = append(txTypes, strings.ToUpper(strings.Replace(t.String(), "_", " ", -1)))
+	}
+	pageSize := values.Get("page_size")
+	if pageSize == "" {
+		pageSize = strconv.Itoa(defaultHistoryPageSize)
+	}
+	form := resources.TransactionsHistoryFilterTemplate()
+	if len(values) != 0 {
+		form = strings.Replace(form, "&FILTER_OPEN;", "open", -1)
+	}
+	form = strings.Replace(form, "&FILTER_OPEN;", "", -1)
+	for _, key := range []string{"from", "to", "min_height", "max_height", "min_amount", "max_amount", "search"} {
+		form = strings.Replace(form, "&FILTER_"+strings.ToUpper(key)+";", html.EscapeString(values.Get(key)), -1)
+	}
+	form = strings.Replace(form, "&FILTER_TYPE_OPTIONS;", selectOptionsHelper(txTypes, []string{"All"}, values.Get("type")), -1)
+	form = strings.Replace(form, "&FILTER_COIN_OPTIONS;", selectOptionsHelper([]string{"", "SCP", "SPF-A", "SPF-B"}, []string{"All"}, values.Get("coin")), -1)
+	form = strings.Replace(form, "&FILTER_DIRECTION_OPTIONS;", selectOptionsHelper([]string{"", "in", "out"}, []string{"All", "Incoming", "Outgoing"}, values.Get("direction")), -1)
+	form = strings.Replace(form, "&FILTER_CONFIRMED_OPTIONS;", selectOptionsHelper([]string{"", "yes", "no"}, []string{"All", "Yes", "No"}, values.Get("confirmed")), -1)
+	form = strings.Replace(form, "&FILTER_SORT_OPTIONS;", selectOptionsHelper(historySorts, []string{"Newest first", "Oldest first", "Largest first", "Smallest first"}, values.Get("sort")), -1)
+	form = strings.Replace(form, "&FILTER_PAGE_SIZE_OPTIONS;", selectOptionsHelper(historyPageSizes, nil, pageSize), -1)
+	return form
+}
+
+func setTxHistoryFilterHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	values := url.Values{}
+	if req.FormValue("clear") != "true" {
+		for _, key := range historyFilterKeys {
+			if v := strings.TrimSpace(req.FormValue(key)); v != "" && key != "page" {
+				values.Set(key, v)
+			}
+		}
+	}
+	if _, err := parseHistoryFilter(values); err != nil {
+		msg := fmt.Sprintf("Unable to filter transaction history: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	setTxHistoryFilter(values.Encode(), sessionID)
+	setTxHistoryPage(1, sessionID)
+	guiHandler(w, req, nil)
+}
+
+func apiTransactionHistoryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to retrieve the transaction history: "
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	filter, err := parseHistoryFilter(req.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	notes := notesHelper(sessionID)
+	sts, err := historyHelper(wallet, notes, filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	page, current, pages := historyPage(sts, filter)
+	history := APITransactionHistory{
+		Transactions: []APIHistoryTransaction{},
+		Page:         current,
+		PageSize:     filter.pageSize,
+		Pages:        pages,
+		Count:        len(sts),
+	}
+	for _, st := range page {
+		note := transactionNote(notes, st.TxnID)
+		history.Transactions = append(history.Transactions, APIHistoryTransaction{SummarizedTransaction: st, Note: note.Note, Tags: note.Tags})
+	}
+	writeJSON(w, http.StatusOK, history)
+}
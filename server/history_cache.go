@@ -0,0 +1,247 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// historyCacheDepth is the number of latest blocks whose transactions are
+// summarized on every request instead of cached, so that short reorgs never
+// leave reverted transactions in a cache.
+const historyCacheDepth = types.BlockHeight(10)
+
+var (
+	historyCachesMu sync.Mutex
+	historyCaches   = make(map[modules.Wallet]*historyCache)
+)
+
+// historyCache holds the summaries of a wallet's confirmed transactions up to
+// the height the wallet had processed at the last update, so that history
+// requests only summarize the transactions of new blocks.
+type historyCache struct {
+	mu      sync.Mutex
+	primed  bool
+	height  types.BlockHeight
+	entries []historyEntry
+
+	// reverted is the lowest height of the blocks reverted since the last
+	// update when hasReverted is true. It is guarded by historyCachesMu
+	// rather than mu, because the consensus set sets it while holding its
+	// own lock and mu is held while the consensus set is called.
+	reverted    types.BlockHeight
+	hasReverted bool
+}
+
+// historyEntry is a cached transaction summary. Transactions that form or
+// revise file contracts also keep their processed transaction, because their
+// value depends on later revisions and on the current height.
+type historyEntry struct {
+	summary  SummarizedTransaction
+	contract *modules.ProcessedTransaction
+}
+
+// historyCacheSubscriber marks the blocks that a consensus change reverts,
+// so that the caches forget only the summaries of those blocks. The applied
+// blocks are summarized by the next update once the wallet processed them.
+type historyCacheSubscriber struct{}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber.
+func (historyCacheSubscriber) ProcessConsensusChange(cc modules.ConsensusChange) {
+	reverted := types.BlockHeight(len(cc.RevertedBlocks))
+	if reverted == 0 {
+		return
+	}
+	revertHistoryCaches(cc.OldHeight - reverted + 1)
+}
+
+// subscribeHistoryCaches subscribes the history caches to consensus changes.
+func subscribeHistoryCaches() {
+	if n == nil || n.ConsensusSet == nil {
+		return
+	}
+	err := n.ConsensusSet.ConsensusSetSubscribe(&historyCacheSubscriber{}, modules.ConsensusChangeRecent, nil)
+	if err != nil {
+		fmt.Printf("Unable to subscribe transaction history cache: %v\n", err)
+	}
+}
+
+// historyCacheFor returns the wallet's history cache.
+func historyCacheFor(wallet modules.Wallet) *historyCache {
+	historyCachesMu.Lock()
+	defer historyCachesMu.Unlock()
+	cache, exists := historyCaches[wallet]
+	if !exists {
+		cache = &historyCache{}
+		historyCaches[wallet] = cache
+	}
+	return cache
+}
+
+// dropHistoryCache forgets the wallet's cached summaries. It is called when
+// the wallet is closed and after it rescans the blockchain.
+func dropHistoryCache(wallet modules.Wallet) {
+	historyCachesMu.Lock()
+	defer historyCachesMu.Unlock()
+	delete(historyCaches, wallet)
+}
+
+// revertHistoryCaches marks the blocks from the height up as reverted in the
+// cache of every wallet.
+func revertHistoryCaches(height types.BlockHeight) {
+	historyCachesMu.Lock()
+	defer historyCachesMu.Unlock()
+	for _, cache := range historyCaches {
+		if !cache.hasReverted || height < cache.reverted {
+			cache.reverted = height
+			cache.hasReverted = true
+		}
+	}
+}
+
+// takeReverted returns and clears the lowest reverted height.
+func (c *historyCache) takeReverted() (types.BlockHeight, bool) {
+	historyCachesMu.Lock()
+	defer historyCachesMu.Unlock()
+	height, reverted := c.reverted, c.hasReverted
+	c.reverted, c.hasReverted = 0, false
+	return height, reverted
+}
+
+// revert forgets the summaries of the transactions confirmed at or above the
+// height. Callers must hold the lock.
+func (c *historyCache) revert(height types.BlockHeight) {
+	if !c.primed || height > c.height {
+		return
+	}
+	i := sort.Search(len(c.entries), func(i int) bool {
+		return c.entries[i].summary.Height >= height
+	})
+	c.entries = c.entries[:i]
+	if height == 0 {
+		c.primed = false
+		return
+	}
+	c.height = height - 1
+}
+
+// isContractTransaction returns true when the value of the transaction
+// depends on the other contract transactions of the wallet.
+func isContractTransaction(pt modules.ProcessedTransaction) bool {
+	return len(pt.Transaction.FileContracts) > 0 || len(pt.Transaction.FileContractRevisions) > 0
+}
+
+// next returns the height of the first block whose transactions are not
+// cached.
+func (c *historyCache) next() types.BlockHeight {
+	if !c.primed {
+		return 0
+	}
+	return c.height + 1
+}
+
+// update caches the summaries of the transactions of the blocks the wallet
+// processed since the last update, leaving out the latest historyCacheDepth
+// blocks. It returns the wallet's height. Callers must hold the lock.
+func (c *historyCache) update(wallet modules.Wallet) (types.BlockHeight, error) {
+	height, err := wallet.Height()
+	if err != nil {
+		return 0, err
+	}
+	if reverted, ok := c.takeReverted(); ok {
+		c.revert(reverted)
+	}
+	// The wallet's height drops while it rescans the blockchain.
+	if c.primed && height < c.height {
+		c.primed = false
+		c.entries = nil
+	}
+	if height < historyCacheDepth {
+		return height, nil
+	}
+	settled := height - historyCacheDepth
+	start := c.next()
+	if start > settled {
+		return height, nil
+	}
+	pts, err := wallet.Transactions(start, settled)
+	if err != nil {
+		return 0, err
+	}
+	sts, err := ComputeSummarizedTransactions(pts, n.ConsensusSet.Height(), wallet)
+	if err != nil {
+		return 0, err
+	}
+	for i, pt := range pts {
+		entry := historyEntry{summary: sts[i]}
+		if isContractTransaction(pt) {
+			entry.contract = &pts[i]
+		}
+		c.entries = append(c.entries, entry)
+	}
+	c.height = settled
+	c.primed = true
+	return height, nil
+}
+
+// confirmed returns the summaries of the wallet's confirmed transactions in
+// the wallet's order. Only the contract transactions and the transactions of
+// blocks that are not cached are summarized.
+func (c *historyCache) confirmed(wallet modules.Wallet) ([]SummarizedTransaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	height, err := c.update(wallet)
+	if err != nil {
+		return nil, err
+	}
+	sts := make([]SummarizedTransaction, len(c.entries))
+	var pts []modules.ProcessedTransaction
+	var indexes []int
+	for i, entry := range c.entries {
+		sts[i] = entry.summary
+		if entry.contract != nil {
+			pts = append(pts, *entry.contract)
+			indexes = append(indexes, i)
+		}
+	}
+	var recent []modules.ProcessedTransaction
+	if start := c.next(); start <= height {
+		recent, err = wallet.Transactions(start, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(pts) == 0 && len(recent) == 0 {
+		return sts, nil
+	}
+	computed, err := ComputeSummarizedTransactions(append(pts, recent...), n.ConsensusSet.Height(), wallet)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		sts[i] = computed[j]
+	}
+	return append(sts, computed[len(indexes):]...), nil
+}
+
+// cachedHistoryHelper returns the summaries of the wallet's confirmed
+// transactions from its history cache followed by those of its unconfirmed
+// transactions.
+func cachedHistoryHelper(wallet modules.Wallet) ([]SummarizedTransaction, error) {
+	sts, err := historyCacheFor(wallet).confirmed(wallet)
+	if err != nil {
+		return nil, err
+	}
+	unconfirmedTxns, err := wallet.UnconfirmedTransactions()
+	if err != nil {
+		return nil, err
+	}
+	unconfirmedSts, err := ComputeSummarizedTransactions(unconfirmedTxns, n.ConsensusSet.Height(), wallet)
+	if err != nil {
+		return nil, err
+	}
+	return append(sts, unconfirmedSts...), nil
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"sort"
+	"testing"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/node"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// historyTestConsensusSet is a consensus set that only reports its height.
+type historyTestConsensusSet struct {
+	modules.ConsensusSet
+	height types.BlockHeight
+}
+
+func (cs *historyTestConsensusSet) Height() types.BlockHeight {
+	return cs.height
+}
+
+// historyTestWallet is a wallet that only reports its height and confirmed
+// transactions, one for every block.
+type historyTestWallet struct {
+	modules.Wallet
+	pts []modules.ProcessedTransaction
+}
+
+func (w *historyTestWallet) Height() (types.BlockHeight, error) {
+	if len(w.pts) == 0 {
+		return 0, nil
+	}
+	return w.pts[len(w.pts)-1].ConfirmationHeight, nil
+}
+
+func (w *historyTestWallet) Transactions(start, end types.BlockHeight) ([]modules.ProcessedTransaction, error) {
+	i := sort.Search(len(w.pts), func(i int) bool {
+		return w.pts[i].ConfirmationHeight >= start
+	})
+	j := sort.Search(len(w.pts), func(j int) bool {
+		return w.pts[j].ConfirmationHeight > end
+	})
+	return w.pts[i:j], nil
+}
+
+func (w *historyTestWallet) UnconfirmedTransactions() ([]modules.ProcessedTransaction, error) {
+	return nil, nil
+}
+
+// addBlock confirms a transaction that pays the wallet value at the next
+// height.
+func (w *historyTestWallet) addBlock(value uint64) {
+	height, _ := w.Height()
+	height++
+	var id types.TransactionID
+	id[0], id[1], id[2], id[3] = byte(height), byte(height>>8), byte(height>>16), byte(value)
+	w.pts = append(w.pts, modules.ProcessedTransaction{
+		TransactionID:         id,
+		ConfirmationHeight:    height,
+		ConfirmationTimestamp: types.Timestamp(1600000000 + uint64(height)*600),
+		Outputs: []modules.ProcessedOutput{{
+			FundType:       types.SpecifierSiacoinOutput,
+			WalletAddress:  true,
+			RelatedAddress: types.UnlockHash{1},
+			Value:          types.NewCurrency64(value),
+		}},
+		TxType: modules.TXTypeSCPMove,
+	})
+	n.ConsensusSet.(*historyTestConsensusSet).height = height
+}
+
+// newHistoryTestWallet returns a wallet with a transaction in each of the
+// blocks and attaches a node that reports their height.
+func newHistoryTestWallet(t testing.TB, blocks int) *historyTestWallet {
+	t.Helper()
+	oldNode := n
+	n = &node.Node{ConsensusSet: &historyTestConsensusSet{}}
+	t.Cleanup(func() { n = oldNode })
+	w := &historyTestWallet{}
+	for i := 0; i < blocks; i++ {
+		w.addBlock(1)
+	}
+	t.Cleanup(func() { dropHistoryCache(w) })
+	return w
+}
+
+func TestHistoryCacheRevert(t *testing.T) {
+	w := newHistoryTestWallet(t, 100)
+	sts, err := cachedHistoryHelper(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sts) != 100 {
+		t.Fatalf("expected 100 transactions, got %d", len(sts))
+	}
+	cache := historyCacheFor(w)
+	if cache.height != 100-historyCacheDepth {
+		t.Fatalf("expected the cache to end at %d, got %d", 100-historyCacheDepth, cache.height)
+	}
+
+	// Replace the last 20 blocks with blocks that pay 2 H each.
+	historyCacheSubscriber{}.ProcessConsensusChange(modules.ConsensusChange{
+		RevertedBlocks: make([]types.Block, 20),
+		AppliedBlocks:  make([]types.Block, 20),
+		OldHeight:      100,
+		NewHeight:      100,
+	})
+	w.pts = w.pts[:80]
+	for i := 0; i < 20; i++ {
+		w.addBlock(2)
+	}
+	sts, err = cachedHistoryHelper(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sts) != 100 {
+		t.Fatalf("expected 100 transactions, got %d", len(sts))
+	}
+	for i, st := range sts {
+		want := types.NewCurrency64(1)
+		if i >= 80 {
+			want = types.NewCurrency64(2)
+		}
+		got, err := st.Scp.Currency()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equals(want) {
+			t.Fatalf("transaction %d at height %d pays %v, expected %v", i, st.Height, got, want)
+		}
+	}
+	if len(cache.entries) != int(100-historyCacheDepth) {
+		t.Fatalf("expected %d cached transactions, got %d", 100-historyCacheDepth, len(cache.entries))
+	}
+}
+
+// BenchmarkHistory50k measures the history of a wallet with 50,000
+// transactions, summarizing all of them on every request and using the cache
+// as a new block arrives between requests.
+func BenchmarkHistory50k(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		w := newHistoryTestWallet(b, 50000)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pts, err := w.Transactions(0, n.ConsensusSet.Height())
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := ComputeSummarizedTransactions(pts, n.ConsensusSet.Height(), w); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		w := newHistoryTestWallet(b, 50000)
+		if _, err := cachedHistoryHelper(w); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			w.addBlock(1)
+			if _, err := cachedHistoryHelper(w); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/modules/multisendjobs"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// The statuses of a multisend row.
+const (
+	multisendRowOK        = "ok"
+	multisendRowBlank     = "blank"
+	multisendRowHeader    = "header"
+	multisendRowInvalid   = "invalid"
+	multisendRowDuplicate = "duplicate"
+)
+
+// maxReportedRowErrors is the number of invalid rows listed in the error of a
+// multisend that cannot be sent.
+const maxReportedRowErrors = 3
+
+// errNoMultisendOutputs is returned when a multisend has no rows to send.
+var errNoMultisendOutputs = errors.New("no ScPrime outputs were supplied")
+
+type (
+	// MultisendRow is a line of a multisend with the amount, unit and address
+	// parsed from it. Blank and header rows are skipped, and duplicate rows
+	// pay the same amount of the same coin to an address as an earlier row.
+	MultisendRow struct {
+		Line        int            `json:"line"`
+		Status      string         `json:"status"`
+		Amount      string         `json:"amount"`
+		Destination string         `json:"destination"`
+		Value       types.Currency `json:"value"`
+		Unit        string         `json:"unit,omitempty"`
+		Address     string         `json:"address,omitempty"`
+		Error       string         `json:"error,omitempty"`
+
+		address types.UnlockHash
+	}
+
+	// MultisendReport is the validation report of a multisend. The estimated
+	// fee is the fee of the transactions built by a dry run that funds them
+	// without signing or broadcasting them, or of their estimated sizes when
+	// the rows are split across several transactions of each coin type.
+	// Transactions is the number of transactions that pay the rows. A
+	// multisend that pays the same outputs as an earlier job resumes it, and
+	// only sends the transactions that were not already sent.
+	MultisendReport struct {
+		Rows         []MultisendRow `json:"rows"`
+		Valid        int            `json:"valid"`
+		Invalid      int            `json:"invalid"`
+		Duplicates   int            `json:"duplicates"`
+		Skipped      int            `json:"skipped"`
+		TotalScp     types.Currency `json:"total_scp"`
+		TotalSpfa    types.Currency `json:"total_spfa"`
+		TotalSpfb    types.Currency `json:"total_spfb"`
+		EstimatedFee types.Currency `json:"estimated_fee"`
+		Sendable     bool           `json:"sendable"`
+		DryRunError  string         `json:"dry_run_error,omitempty"`
+		Transactions int            `json:"transactions"`
+		JobID        string         `json:"job_id,omitempty"`
+		AlreadySent  []string       `json:"already_sent,omitempty"`
+
+		allowDuplicates bool
+	}
+)
+
+// parseMultisendAmount parses an amount with a unit suffix, or in the default
+// unit when it has none, and returns its value and coin type.
+func parseMultisendAmount(amount string, defaultUnit string) (types.Currency, string, error) {
+	amount = strings.TrimSpace(amount)
+	//add default unit if there is none (verified by successful string parse into float)
+	if _, err := strconv.ParseFloat(amount, 64); err == nil {
+		amount += defaultUnit
+	}
+	unit := "SCP"
+	if strings.HasSuffix(amount, "SPF") || strings.HasSuffix(amount, "SPF-A") {
+		unit = "SPF-A"
+	} else if strings.HasSuffix(amount, "SPF-B") {
+		unit = "SPF-B"
+	}
+	// SPF-A and SPF-B are not recognised as currency units, so just "SPF" should be supplied
+	// and different methods called for transfer
+	value, err := types.NewCurrencyStr(
+		strings.ReplaceAll(
+			strings.ReplaceAll(amount, "SPF-A", "SPF"),
+			"SPF-B", "SPF"))
+	if err != nil {
+		return types.Currency{}, "", fmt.Errorf("could not parse amount: %s: %v", amount, err)
+	}
+	if value.IsZero() {
+		return types.Currency{}, "", fmt.Errorf("amount must be greater than zero: %s", amount)
+	}
+	return value, unit, nil
+}
+
+// validateMultisendHelper parses every line of a multisend. The first line
+// that is not blank is treated as a header when header is true and neither
+// its amount nor its destination parse. Lines must already have their
+// destinations resolved from the address book.
+func validateMultisendHelper(lines [][]string, defaultUnit string, header bool, allowDuplicates bool) MultisendReport {
+	report := MultisendReport{Rows: []MultisendRow{}, allowDuplicates: allowDuplicates}
+	seen := make(map[string]int)
+	first := true
+	for i, line := range lines {
+		row := MultisendRow{Line: i + 1}
+		if len(line) > 0 {
+			row.Amount = strings.TrimSpace(line[0])
+		}
+		if len(line) > 1 {
+			row.Destination = strings.TrimSpace(line[1])
+		}
+		value, unit, amountErr := parseMultisendAmount(row.Amount, defaultUnit)
+		address, addressErr := scanAddress(row.Destination)
+		switch {
+		case row.Amount == "" && row.Destination == "":
+			row.Status = multisendRowBlank
+		case first && header && amountErr != nil && addressErr != nil:
+			row.Status = multisendRowHeader
+		case row.Amount == "":
+			row.Status, row.Error = multisendRowInvalid, "amount is missing"
+		case row.Destination == "":
+			row.Status, row.Error = multisendRowInvalid, "destination is missing"
+		case amountErr != nil:
+			row.Status, row.Error = multisendRowInvalid, amountErr.Error()
+		case addressErr != nil:
+			row.Status, row.Error = multisendRowInvalid, fmt.Sprintf("failed to parse destination address: %s: %v", row.Destination, addressErr)
+		default:
+			row.Status = multisendRowOK
+			row.Value, row.Unit, row.Address, row.address = value, unit, address.String(), address
+			key := fmt.Sprintf("%s %s %s", unit, value, address)
+			if line, exists := seen[key]; exists {
+				row.Status, row.Error = multisendRowDuplicate, fmt.Sprintf("same payment as line %d", line)
+			} else {
+				seen[key] = row.Line
+			}
+		}
+		if row.Status != multisendRowBlank {
+			first = false
+		}
+		report.add(row)
+	}
+	report.Sendable = report.Invalid == 0 && (report.Duplicates == 0 || allowDuplicates) && report.Valid > 0
+	return report
+}
+
+// add adds the row to the report and its value to the totals when it will be
+// sent.
+func (r *MultisendReport) add(row MultisendRow) {
+	r.Rows = append(r.Rows, row)
+	switch row.Status {
+	case multisendRowBlank, multisendRowHeader:
+		r.Skipped++
+		return
+	case multisendRowInvalid:
+		r.Invalid++
+		return
+	case multisendRowDuplicate:
+		r.Duplicates++
+		if !r.allowDuplicates {
+			return
+		}
+	}
+	r.Valid++
+	switch row.Unit {
+	case "SPF-A":
+		r.TotalSpfa = r.TotalSpfa.Add(row.Value)
+	case "SPF-B":
+		r.TotalSpfb = r.TotalSpfb.Add(row.Value)
+	default:
+		r.TotalScp = r.TotalScp.Add(row.Value)
+	}
+}
+
+// sent returns true when the row is paid by the multisend.
+func (r MultisendReport) sent(row MultisendRow) bool {
+	return row.Status == multisendRowOK || (row.Status == multisendRowDuplicate && r.allowDuplicates)
+}
+
+// err describes why the multisend cannot be sent, listing its first invalid
+// rows.
+func (r MultisendReport) err() error {
+	if r.Sendable {
+		return nil
+	}
+	var problems []string
+	for _, row := range r.Rows {
+		if row.Status == multisendRowInvalid || (row.Status == multisendRowDuplicate && !r.allowDuplicates) {
+			problems = append(problems, fmt.Sprintf("line %d: %s", row.Line, row.Error))
+		}
+	}
+	if len(problems) == 0 {
+		return errNoMultisendOutputs
+	}
+	if len(problems) > maxReportedRowErrors {
+		problems = append(problems[:maxReportedRowErrors], fmt.Sprintf("and %d more", len(problems)-maxReportedRowErrors))
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// dryRunMultisendHelper funds the transactions of a sendable multisend's job
+// without signing them and records their fee in the report. A multisend that
+// cannot be funded, or that was already sent and is not resent, is marked as
+// not sendable.
+func dryRunMultisendHelper(wallet modules.Wallet, dir string, report *MultisendReport, feePerByte types.Currency, resend bool) *pendingSend {
+	if !report.Sendable {
+		return nil
+	}
+	job, err := multisendJobHelper(dir, *report, resend)
+	var p *pendingSend
+	if err == nil {
+		p, err = jobSendHelper(wallet, dir, job, feePerByte)
+	}
+	report.JobID = job.ID
+	if errors.Is(err, errMultisendSent) {
+		err = fmt.Errorf("%v by job %s; resend them to pay them a second time", err, job.ID)
+	}
+	if err != nil {
+		report.Sendable = false
+		report.DryRunError = err.Error()
+		return nil
+	}
+	for _, part := range p.job.Parts {
+		if part.State == multisendjobs.StateBroadcast {
+			report.AlreadySent = append(report.AlreadySent, part.FundType)
+		}
+	}
+	report.EstimatedFee = p.preview.MinerFee
+	report.Transactions = len(p.jobParts)
+	return p
+}
+
+// multisendRowsHelper returns the table rows of the multisend report.
+func multisendRowsHelper(report MultisendReport) string {
+	rows := ""
+	for _, row := range report.Rows {
+		amount := html.EscapeString(row.Amount)
+		if row.Unit != "" {
+			amount = fmtPreviewValue(row.Unit, row.Value)
+		}
+		address := row.Address
+		if address == "" {
+			address = html.EscapeString(row.Destination)
+		}
+		rows += fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n", row.Line, strings.ToUpper(row.Status), amount, address, html.EscapeString(row.Error))
+	}
+	return rows
+}
+
+// writeMultisendReport writes the validation report of a multisend followed
+// by the confirmation form of its pending send, if it can be sent.
+func writeMultisendReport(w http.ResponseWriter, report MultisendReport, p *pendingSend, sessionID string) {
+	summary := fmt.Sprintf("%d rows will be sent, %d are invalid, %d are duplicates and %d were skipped.", report.Valid, report.Invalid, report.Duplicates, report.Skipped)
+	if report.Duplicates > 0 && !report.allowDuplicates {
+		summary += " Duplicate rows are only sent when duplicates are allowed."
+	}
+	if report.Transactions > 1 {
+		summary += fmt.Sprintf(" They will be paid by %d transactions.", report.Transactions)
+	}
+	if p != nil && p.chunked {
+		summary += " The transactions are funded and broadcast one after another in the background; the inputs and change are chosen as each one is built."
+	}
+	if len(report.AlreadySent) > 0 {
+		summary += fmt.Sprintf(" Multisend job %s already sent %s, which will not be sent again.", report.JobID, strings.Join(report.AlreadySent, ", "))
+	}
+	if report.DryRunError != "" {
+		summary += " The transactions could not be built: " + html.EscapeString(report.DryRunError)
+	}
+	confirm := resources.MultisendReportCloseForm()
+	if p != nil {
+		confirm = sendPreviewFormHelper(p.preview, "")
+	}
+	form := resources.MultisendReportForm()
+	form = strings.Replace(form, "&REPORT_SUMMARY;", summary, -1)
+	form = strings.Replace(form, "&REPORT_ROWS;", multisendRowsHelper(report), -1)
+	form = strings.Replace(form, "&TOTAL_SCP;", fmtPreviewValue("SCP", report.TotalScp), -1)
+	form = strings.Replace(form, "&TOTAL_SPFA;", fmtPreviewValue("SPF-A", report.TotalSpfa), -1)
+	form = strings.Replace(form, "&TOTAL_SPFB;", fmtPreviewValue("SPF-B", report.TotalSpfb), -1)
+	form = strings.Replace(form, "&ESTIMATED_FEE;", fmtPreviewValue("SCP", report.EstimatedFee), -1)
+	form = strings.Replace(form, "&CONFIRM_SEND;", confirm, -1)
+	writeForm(w, "MULTISEND REPORT", form, sessionID)
+}
+
+func uploadMultispendCsvFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		msg := "Session ID does not exist."
+		writeError(w, msg, "")
+	}
+	if watchOnlySession(sessionID) {
+		msg := fmt.Sprintf("Unable to send coins: %v", errWatchOnly)
+		writeError(w, msg, sessionID)
+		return
+	}
+	title := "MULTISEND FROM CSV"
+	form := strings.Replace(resources.MultiSendCoinsForm(), "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	writeForm(w, title, form, sessionID)
+}
+
+func uploadMultispendCsvHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		msg := "Session ID does not exist."
+		writeError(w, msg, "")
+	}
+	cancel := req.FormValue("cancel")
+	var msgPrefix = "Unable to send coins: "
+	if cancel == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	defaultUnit := req.FormValue("default_unit")
+	if defaultUnit != "SCP" && defaultUnit != "SPF-A" && defaultUnit != "SPF-B" {
+		defaultUnit = "SCP"
+	}
+
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload multispend csv file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	lines, err := reader.ReadAll()
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Failed to close the multispend csv upload stream: ", closeErr)
+		writeError(w, msg, sessionID)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to read multispend csv file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	unlocked, err := wallet.Unlocked()
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	if !unlocked {
+		msg := msgPrefix + "Wallet is locked."
+		writeError(w, msg, sessionID)
+		return
+	}
+	feePerByte, err := feePerByteHelper(req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	report := validateMultisendHelper(resolveDestinationLines(sessionID, lines), defaultUnit, true, req.FormValue("allow_duplicates") == "true")
+	p := dryRunMultisendHelper(wallet, dir, &report, feePerByte, req.FormValue("resend") == "true")
+	if p != nil {
+		setPendingSend(p, sessionID)
+	} else {
+		dropPendingSend(sessionID)
+	}
+	writeMultisendReport(w, report, p, sessionID)
+}
+
+func apiValidateMultisendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to validate multisend: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiMultisendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	var lines [][]string
+	for _, output := range params.Outputs {
+		lines = append(lines, []string{output.Amount, output.Destination})
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	report := validateMultisendHelper(resolveDestinationLines(sessionID, lines), "SCP", false, params.AllowDuplicates)
+	if p := dryRunMultisendHelper(wallet, dir, &report, feePerByte, params.Resend); p != nil {
+		p.drop()
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,734 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/modules/multisendjobs"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// OperationMultisending is the operation that broadcasts the transactions of
+// a chunked multisend job.
+const OperationMultisending = "Multisending"
+
+const (
+	// multisendChunkOutputs is the number of outputs paid by each transaction
+	// of a multisend. It keeps every transaction well below the transaction
+	// pool's size limit.
+	multisendChunkOutputs = 250
+	// multisendBlockWaits is the number of new blocks a transaction of a
+	// chunked multisend waits for when it cannot be sent yet.
+	multisendBlockWaits = 3
+	// multisendBlockTimeout is how long a transaction of a chunked multisend
+	// waits for each new block.
+	multisendBlockTimeout = 30 * time.Minute
+	// multisendBlockPoll is how often the block height is checked while a
+	// transaction waits for a new block.
+	multisendBlockPoll = 10 * time.Second
+)
+
+var (
+	// errMultisendSent is returned when a multisend pays the same outputs as
+	// an earlier multisend job that was completely sent.
+	errMultisendSent = errors.New("these outputs were already paid by an earlier multisend")
+	// errMultisendStarted is returned when a multisend job changed after its
+	// send was previewed.
+	errMultisendStarted = errors.New("the multisend was sent from elsewhere after it was previewed")
+)
+
+type (
+	// APIMultisendJobs lists the multisend jobs of the active wallet.
+	APIMultisendJobs struct {
+		Jobs []multisendjobs.Job `json:"jobs"`
+	}
+
+	// APIMultisendJob is a multisend job along with the transactions that
+	// were broadcast to send it.
+	APIMultisendJob struct {
+		TransactionIDs []types.TransactionID `json:"transaction_ids"`
+		Job            multisendjobs.Job     `json:"job"`
+	}
+
+	// apiRetryMultisendParams choose the fee of a retried multisend job.
+	apiRetryMultisendParams struct {
+		FeeLevel   string `json:"fee_level"`
+		FeePerByte string `json:"fee_per_byte"`
+	}
+)
+
+// jobPartsHelper returns the parts of the job that pays the rows the
+// multisend sends. Each part pays up to multisendChunkOutputs outputs of a
+// single coin type.
+func jobPartsHelper(report MultisendReport) []multisendjobs.Part {
+	var parts []multisendjobs.Part
+	for _, fundType := range []string{"SCP", "SPF-A", "SPF-B"} {
+		var outputs []multisendjobs.Output
+		for _, row := range report.Rows {
+			if report.sent(row) && row.Unit == fundType {
+				outputs = append(outputs, multisendjobs.Output{Line: row.Line, Value: row.Value, Address: row.address})
+			}
+		}
+		for start := 0; start < len(outputs); start += multisendChunkOutputs {
+			end := start + multisendChunkOutputs
+			if end > len(outputs) {
+				end = len(outputs)
+			}
+			parts = append(parts, multisendjobs.Part{FundType: fundType, Outputs: outputs[start:end]})
+		}
+	}
+	return parts
+}
+
+// multisendJobHelper returns the job that pays the rows the multisend sends.
+// The latest job that pays the same outputs is resumed unless it was
+// completely sent, in which case a new job is only started when resend is
+// true.
+func multisendJobHelper(dir string, report MultisendReport, resend bool) (multisendjobs.Job, error) {
+	parts := jobPartsHelper(report)
+	if len(parts) == 0 {
+		return multisendjobs.Job{}, errNoMultisendOutputs
+	}
+	job, err := multisendjobs.Latest(dir, multisendjobs.Key(parts))
+	if errors.Is(err, multisendjobs.ErrJobNotFound) || (err == nil && job.Complete() && resend) {
+		return multisendjobs.NewJob(parts)
+	}
+	if err != nil {
+		return job, err
+	}
+	if job.Complete() {
+		return job, errMultisendSent
+	}
+	return job, nil
+}
+
+// knownTransactionHelper returns true when the wallet knows the transaction,
+// whether it is confirmed or not.
+func knownTransactionHelper(wallet modules.Wallet, id string) bool {
+	var txid types.TransactionID
+	if err := txid.UnmarshalJSON([]byte("\"" + id + "\"")); err != nil {
+		return false
+	}
+	_, found, err := wallet.Transaction(txid)
+	return err == nil && found
+}
+
+// resolveJobHelper settles the parts of the job that were signed but whose
+// broadcast was not recorded. Their signed transactions are broadcast again
+// rather than signed anew, so a part is never paid twice.
+func resolveJobHelper(wallet modules.Wallet, dir string, job *multisendjobs.Job) error {
+	resolved := false
+	for i := range job.Parts {
+		part := &job.Parts[i]
+		if part.State != multisendjobs.StateSigned {
+			continue
+		}
+		resolved = true
+		err := error(nil)
+		if !knownTransactionHelper(wallet, part.TransactionID) {
+			err = n.TransactionPool.AcceptTransactionSet(part.Transactions)
+		}
+		if err == nil || errors.Is(err, modules.ErrDuplicateTransactionSet) {
+			part.State, part.Error = multisendjobs.StateBroadcast, ""
+		} else {
+			part.State, part.Error = multisendjobs.StateFailed, err.Error()
+			part.TransactionID = ""
+		}
+		part.Transactions = nil
+	}
+	if !resolved {
+		return nil
+	}
+	saved, err := multisendjobs.Save(dir, *job)
+	if err != nil {
+		return err
+	}
+	*job = saved
+	return nil
+}
+
+// partOutputsHelper returns the coin or fund outputs of the job part.
+func partOutputsHelper(part multisendjobs.Part) ([]types.SiacoinOutput, []types.SiafundOutput) {
+	var coinOutputs []types.SiacoinOutput
+	var fundOutputs []types.SiafundOutput
+	for _, output := range part.Outputs {
+		if part.FundType == "SCP" {
+			coinOutputs = append(coinOutputs, types.SiacoinOutput{Value: output.Value, UnlockHash: output.Address})
+		} else {
+			fundOutputs = append(fundOutputs, types.SiafundOutput{Value: output.Value, UnlockHash: output.Address})
+		}
+	}
+	return coinOutputs, fundOutputs
+}
+
+// jobSendHelper funds a transaction for each part of the job that was not
+// broadcast, without signing or broadcasting them. A chunked job is only
+// previewed.
+func jobSendHelper(wallet modules.Wallet, dir string, job multisendjobs.Job, feePerByte types.Currency) (*pendingSend, error) {
+	err := resolveJobHelper(wallet, dir, &job)
+	if err != nil {
+		return nil, err
+	}
+	if job.Complete() {
+		return nil, errMultisendSent
+	}
+	if job.Chunked() {
+		return chunkedSendHelper(wallet, dir, job, feePerByte)
+	}
+	p := &pendingSend{job: &job, jobDir: dir}
+	for i, part := range job.Parts {
+		if part.State == multisendjobs.StateBroadcast {
+			continue
+		}
+		coinOutputs, fundOutputs := partOutputsHelper(part)
+		if err = p.add(wallet, part.FundType, coinOutputs, fundOutputs, feePerByte); err != nil {
+			p.drop()
+			return nil, err
+		}
+		p.jobParts = append(p.jobParts, i)
+	}
+	if err = p.finish(wallet, feePerByte); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// chunkedSendHelper previews the parts of a chunked job that were not
+// broadcast without funding them, estimating their fees for one input each.
+// The parts are funded one at a time as they are broadcast, so that each can
+// spend the change of the parts before it.
+func chunkedSendHelper(wallet modules.Wallet, dir string, job multisendjobs.Job, feePerByte types.Currency) (*pendingSend, error) {
+	bals, _, err := confirmedBalanceHelper(wallet)
+	if err != nil {
+		return nil, err
+	}
+	p := &pendingSend{job: &job, jobDir: dir, chunked: true}
+	p.preview = TransactionPreview{FeePerByte: feePerByte, Expires: time.Now().Add(pendingSendLifetime)}
+	spent := map[string]types.Currency{"SCP": types.ZeroCurrency, "SPF-A": types.ZeroCurrency, "SPF-B": types.ZeroCurrency}
+	for i, part := range job.Parts {
+		if part.State == multisendjobs.StateBroadcast {
+			continue
+		}
+		p.jobParts = append(p.jobParts, i)
+		p.fundTypes = append(p.fundTypes, part.FundType)
+		for _, output := range part.Outputs {
+			p.preview.Outputs = append(p.preview.Outputs, PreviewOutput{part.FundType, output.Value, output.Address})
+			spent[part.FundType] = spent[part.FundType].Add(output.Value)
+		}
+		coinOutputs, fundOutputs := partOutputsHelper(part)
+		p.preview.MinerFee = p.preview.MinerFee.Add(batchFeeHelper(len(coinOutputs), len(fundOutputs), 1, feePerByte))
+	}
+	spent["SCP"] = spent["SCP"].Add(p.preview.MinerFee)
+	if bals.CoinBalance.Cmp(spent["SCP"]) < 0 {
+		return nil, errors.New("not enough SCP to fund the multisend")
+	}
+	if bals.FundBalance.Cmp(spent["SPF-A"]) < 0 || bals.FundbBalance.Cmp(spent["SPF-B"]) < 0 {
+		return nil, errors.New("not enough SPF to fund the multisend")
+	}
+	p.preview.NewScpBalance = bals.CoinBalance.Sub(spent["SCP"])
+	p.preview.NewSpfaBalance = bals.FundBalance.Sub(spent["SPF-A"])
+	p.preview.NewSpfbBalance = bals.FundbBalance.Sub(spent["SPF-B"])
+	return p, nil
+}
+
+// sendJobHelper broadcasts the pending send of a job. The parts of a chunked
+// job are sent in the background.
+func sendJobHelper(wallet modules.Wallet, p *pendingSend, sessionID string) ([]types.Transaction, error) {
+	if !p.chunked {
+		return broadcastSendHelper(wallet, p)
+	}
+	if operationRunning(sessionID) {
+		return nil, errors.New("another operation is running")
+	}
+	startOperation(OperationMultisending, sessionID)
+	go sendChunksHelper(wallet, p, sessionID)
+	return nil, nil
+}
+
+// sendChunksHelper funds, signs and broadcasts the parts of a chunked job one
+// after another, reporting its progress on the session's operation. A part
+// that fails does not stop the parts after it.
+func sendChunksHelper(wallet modules.Wallet, p *pendingSend, sessionID string) {
+	failed := 0
+	for k, i := range p.jobParts {
+		if sendChunkHelper(wallet, p, i) != nil {
+			failed++
+		}
+		setOperationProgress(OperationMultisending, float64(k+1)/float64(len(p.jobParts)), sessionID)
+	}
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d transactions of multisend job %s failed", failed, len(p.jobParts), p.job.ID)
+	}
+	finishOperation(OperationMultisending, err, sessionID)
+}
+
+// sendChunkHelper funds, signs and broadcasts a part of a chunked job. A part
+// that cannot be funded or accepted until the parts before it are confirmed
+// is tried again after each new block, up to multisendBlockWaits times.
+func sendChunkHelper(wallet modules.Wallet, p *pendingSend, i int) error {
+	coinOutputs, fundOutputs := partOutputsHelper(p.job.Parts[i])
+	for wait := 0; ; wait++ {
+		chunk := &pendingSend{job: p.job, jobDir: p.jobDir, jobParts: []int{i}}
+		err := chunk.add(wallet, p.job.Parts[i].FundType, coinOutputs, fundOutputs, p.preview.FeePerByte)
+		if err == nil {
+			_, err = broadcastSendHelper(wallet, chunk)
+		} else {
+			chunk.recordJob(0, 1, nil, err)
+		}
+		if err == nil || wait == multisendBlockWaits {
+			return err
+		}
+		if !errors.Is(err, modules.ErrLargeTransactionSet) && !errors.Is(err, modules.ErrIncompleteTransactions) {
+			return err
+		}
+		if !waitForBlockHelper() {
+			return err
+		}
+	}
+}
+
+// waitForBlockHelper waits for a new block and returns false when none
+// arrives within multisendBlockTimeout.
+func waitForBlockHelper() bool {
+	height := n.ConsensusSet.Height()
+	deadline := time.Now().Add(multisendBlockTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(multisendBlockPoll)
+		if n.ConsensusSet.Height() > height {
+			return true
+		}
+	}
+	return false
+}
+
+// checkJob reloads the job of the pending send and fails when any of its
+// parts was sent, or a job paying the same outputs was started, after the
+// send was previewed.
+func (p *pendingSend) checkJob() error {
+	if p.job == nil {
+		return nil
+	}
+	job, err := multisendjobs.Get(p.jobDir, p.job.ID)
+	if errors.Is(err, multisendjobs.ErrJobNotFound) {
+		latest, err := multisendjobs.Latest(p.jobDir, p.job.Key)
+		if err == nil && latest.Updated.After(p.job.Created) {
+			return errMultisendStarted
+		} else if err != nil && !errors.Is(err, multisendjobs.ErrJobNotFound) {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, i := range p.jobParts {
+		if state := job.Parts[i].State; state == multisendjobs.StateSigned || state == multisendjobs.StateBroadcast {
+			return errMultisendStarted
+		}
+	}
+	*p.job = job
+	return nil
+}
+
+// recordJob records the outcome of the pending send's transactions from and
+// up to, but not including, to on the parts of its job. The parts are signed
+// when sets holds their transaction sets, failed when err is not nil and
+// broadcast otherwise.
+func (p *pendingSend) recordJob(from int, to int, sets [][]types.Transaction, err error) error {
+	if p.job == nil {
+		return nil
+	}
+	for i := from; i < to; i++ {
+		part := &p.job.Parts[p.jobParts[i]]
+		switch {
+		case sets != nil:
+			set := sets[i-from]
+			part.State, part.Error = multisendjobs.StateSigned, ""
+			part.TransactionID = set[len(set)-1].ID().String()
+			part.Transactions = set
+		case err != nil:
+			part.State, part.Error = multisendjobs.StateFailed, err.Error()
+			part.TransactionID, part.Transactions = "", nil
+		default:
+			part.State, part.Error = multisendjobs.StateBroadcast, ""
+			part.Transactions = nil
+		}
+	}
+	saved, saveErr := multisendjobs.Save(p.jobDir, *p.job)
+	if saveErr != nil {
+		return fmt.Errorf("unable to save multisend job %s: %v", p.job.ID, saveErr)
+	}
+	*p.job = saved
+	return nil
+}
+
+// jobTotalHelper returns the total value of the part's outputs.
+func jobTotalHelper(part multisendjobs.Part) types.Currency {
+	total := types.ZeroCurrency
+	for _, output := range part.Outputs {
+		total = total.Add(output.Value)
+	}
+	return total
+}
+
+// multisendJobRowsHelper returns the table rows of the job's parts.
+func multisendJobRowsHelper(job multisendjobs.Job) string {
+	rows := ""
+	for i, part := range job.Parts {
+		lines := ""
+		if len(part.Outputs) > 0 {
+			lines = fmt.Sprintf("%d-%d", part.Outputs[0].Line, part.Outputs[len(part.Outputs)-1].Line)
+		}
+		rows += fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n", i+1, part.FundType, lines, fmtPreviewValue(part.FundType, jobTotalHelper(part)), strings.ToUpper(part.State), part.TransactionID, html.EscapeString(part.Error))
+	}
+	return rows
+}
+
+// writeMultisendJob writes the state of each part of the multisend job and
+// offers to retry the parts that were not sent.
+func writeMultisendJob(w http.ResponseWriter, job multisendjobs.Job, sendErr error, sessionID string) {
+	summary := fmt.Sprintf("Multisend job %s was sent completely.", job.ID)
+	retry := ""
+	if !job.Complete() {
+		summary = fmt.Sprintf("Multisend job %s sent %d of %d transactions. %s can be retried without paying the parts that were sent again.", job.ID, job.Sent(), len(job.Parts), strings.Join(job.Unsent(), ", "))
+		retry = strings.Replace(resources.RetryMultisendForm(), "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	}
+	if sendErr != nil {
+		summary += " The send failed: " + html.EscapeString(sendErr.Error())
+	}
+	form := resources.MultisendJobForm()
+	form = strings.Replace(form, "&JOB_SUMMARY;", summary, -1)
+	form = strings.Replace(form, "&JOB_ROWS;", multisendJobRowsHelper(job), -1)
+	form = strings.Replace(form, "&RETRY_MULTISEND;", retry, -1)
+	form = strings.Replace(form, "&JOB_ID;", job.ID, -1)
+	writeForm(w, "MULTISEND JOB", form, sessionID)
+}
+
+// multisendJobsRowsHelper returns the table rows of the jobs.
+func multisendJobsRowsHelper(jobs []multisendjobs.Job) string {
+	rows := ""
+	for _, job := range jobs {
+		outputs := 0
+		for _, part := range job.Parts {
+			outputs += len(part.Outputs)
+		}
+		view := fmt.Sprintf("<form action='/gui/multisendJob?&CACHE_BUSTER;' method='post'><input type='hidden' name='session_id' value='&SESSION_ID;'><input type='hidden' name='job_id' value='%s'><button type='submit'>View</button></form>", job.ID)
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%d of %d</td><td>%s</td></tr>\n", job.Created.Format("2006-01-02 15:04"), job.ID, outputs, job.Sent(), len(job.Parts), view)
+	}
+	return rows
+}
+
+// reconciliationHelper returns a CSV file that maps every line of the
+// multisend job to the transaction that paid it.
+func reconciliationHelper(job multisendjobs.Job) ([]byte, error) {
+	type entry struct {
+		output multisendjobs.Output
+		part   int
+	}
+	var entries []entry
+	for i, part := range job.Parts {
+		for _, output := range part.Outputs {
+			entries = append(entries, entry{output, i})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].output.Line < entries[j].output.Line
+	})
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+	writer.Write([]string{"Line", "Amount", "Coin", "Address", "Part", "State", "Transaction ID"})
+	for _, e := range entries {
+		part := job.Parts[e.part]
+		amount := e.output.Value.String()
+		if part.FundType == "SCP" {
+			amount = NewExactCurrency(e.output.Value).String()
+		}
+		writer.Write([]string{strconv.Itoa(e.output.Line), amount, part.FundType, e.output.Address.String(), strconv.Itoa(e.part + 1), part.State, part.TransactionID})
+	}
+	writer.Flush()
+	return b.Bytes(), writer.Error()
+}
+
+// sessionJobHelper returns the directory of the session's active wallet and
+// its multisend job with the ID.
+func sessionJobHelper(sessionID string, id string) (string, multisendjobs.Job, error) {
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		return "", multisendjobs.Job{}, err
+	}
+	job, err := multisendjobs.Get(dir, id)
+	return dir, job, err
+}
+
+func multisendJobsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to list multisend jobs: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	jobs, err := multisendjobs.List(dir)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	form := strings.Replace(resources.MultisendJobsForm(), "&JOBS_ROWS;", multisendJobsRowsHelper(jobs), -1)
+	writeForm(w, "MULTISEND JOBS", form, sessionID)
+}
+
+func multisendJobHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	_, job, err := sessionJobHelper(sessionID, req.FormValue("job_id"))
+	if err != nil {
+		msg := fmt.Sprintf("Unable to retrieve multisend job: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeMultisendJob(w, job, nil, sessionID)
+}
+
+func multisendReconciliationHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to export the reconciliation: "
+	_, job, err := sessionJobHelper(sessionID, req.FormValue("job_id"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	b, err := reconciliationHelper(job)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeExport(w, b, "text/csv", fmt.Sprintf("multisend-%s.csv", job.ID))
+}
+
+func retryMultisendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to retry multisend: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	dir, job, err := sessionJobHelper(sessionID, req.FormValue("job_id"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	feePerByte, err := feePerByteHelper(req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	p, err := jobSendHelper(wallet, dir, job, feePerByte)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	setPendingSend(p, sessionID)
+	msg := fmt.Sprintf("Retrying %s of multisend job %s.", strings.Join(p.job.Unsent(), ", "), job.ID)
+	writeSendPreview(w, p.preview, msg, sessionID)
+}
+
+// apiMultisendJobHelper validates the multisend and funds the parts of its
+// job that were not sent. It writes the error and returns false on failure.
+func apiMultisendJobHelper(w http.ResponseWriter, sessionID string, wallet modules.Wallet, params apiMultisendParams, msgPrefix string) (*pendingSend, bool) {
+	var lines [][]string
+	for _, output := range params.Outputs {
+		lines = append(lines, []string{output.Amount, output.Destination})
+	}
+	report := validateMultisendHelper(resolveDestinationLines(sessionID, lines), "SCP", false, params.AllowDuplicates)
+	if err := report.err(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return nil, false
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return nil, false
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return nil, false
+	}
+	job, err := multisendJobHelper(dir, report, params.Resend)
+	if errors.Is(err, errMultisendSent) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v by job %s", msgPrefix, err, job.ID))
+		return nil, false
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return nil, false
+	}
+	p, err := jobSendHelper(wallet, dir, job, feePerByte)
+	if errors.Is(err, errMultisendSent) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v by job %s", msgPrefix, err, job.ID))
+		return nil, false
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return nil, false
+	}
+	return p, true
+}
+
+// writeMultisendJobResult writes the job of the broadcast pending send, or
+// the error of its broadcast along with the job's ID. A chunked job that is
+// being sent in the background is accepted without any transactions yet.
+func writeMultisendJobResult(w http.ResponseWriter, p *pendingSend, txns []types.Transaction, err error, msgPrefix string) {
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v (multisend job %s)", msgPrefix, err, p.job.ID))
+		return
+	}
+	status := http.StatusOK
+	if p.chunked {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, APIMultisendJob{
+		TransactionIDs: apiTransactionIDs(txns).TransactionIDs,
+		Job:            *p.job,
+	})
+}
+
+func apiMultisendJobsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to list multisend jobs: %v", err))
+		return
+	}
+	jobs, err := multisendjobs.List(dir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to list multisend jobs: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIMultisendJobs{Jobs: jobs})
+}
+
+func apiMultisendJobHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var msgPrefix = "Unable to retrieve multisend job: "
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	job, err := multisendjobs.Get(dir, ps.ByName("id"))
+	if errors.Is(err, multisendjobs.ErrJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func apiRetryMultisendJobHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var msgPrefix = "Unable to retry multisend: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiRetryMultisendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	job, err := multisendjobs.Get(dir, ps.ByName("id"))
+	if errors.Is(err, multisendjobs.ErrJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	p, err := jobSendHelper(wallet, dir, job, feePerByte)
+	if errors.Is(err, errMultisendSent) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	txns, err := sendJobHelper(wallet, p, sessionID)
+	writeMultisendJobResult(w, p, txns, err, msgPrefix)
+}
+
+func apiMultisendReconciliationHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var msgPrefix = "Unable to export the reconciliation: "
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	_, job, err := sessionJobHelper(sessionID, ps.ByName("id"))
+	if errors.Is(err, multisendjobs.ErrJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	b, err := reconciliationHelper(job)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeExport(w, b, "text/csv", fmt.Sprintf("multisend-%s.csv", job.ID))
+}
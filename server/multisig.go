@@ -0,0 +1,523 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+	walletutil "gitlab.com/scpcorp/webwallet/utils/wallet"
+)
+
+const (
+	// multisigKeySize is the estimated size in bytes of each public key of a
+	// multisig input beyond the first.
+	multisigKeySize = 60
+	// multisigSignatureSize is the estimated size in bytes of each signature
+	// of a multisig input beyond the first.
+	multisigSignatureSize = 140
+)
+
+type (
+	// APIPublicKey is a public key of the wallet that can be shared with
+	// co-signers, and the address of its own.
+	APIPublicKey struct {
+		PublicKey types.SiaPublicKey `json:"public_key"`
+		Address   types.UnlockHash   `json:"address"`
+	}
+
+	// APIMultisigAddress is a watched multisig address and its unlock
+	// conditions.
+	APIMultisigAddress struct {
+		Address          types.UnlockHash       `json:"address"`
+		UnlockConditions types.UnlockConditions `json:"unlock_conditions"`
+	}
+
+	// APIMultisigAddresses lists the wallet's watched multisig addresses.
+	APIMultisigAddresses struct {
+		Addresses []APIMultisigAddress `json:"addresses"`
+	}
+
+	// APIPartialTransaction is a transaction passed between co-signers along
+	// with how many signatures each of its inputs has and requires.
+	APIPartialTransaction struct {
+		Transaction walletutil.OfflineTransaction `json:"transaction"`
+		Signatures  []walletutil.SignatureCount   `json:"signatures"`
+		Complete    bool                          `json:"complete"`
+	}
+
+	// apiMultisigParams are the parameters used to create a multisig address.
+	apiMultisigParams struct {
+		PublicKeys         []string `json:"public_keys"`
+		SignaturesRequired uint64   `json:"signatures_required"`
+	}
+)
+
+// isMultisig returns true when the unlock conditions list more than one
+// public key or require more than one signature.
+func isMultisig(uc types.UnlockConditions) bool {
+	return len(uc.PublicKeys) > 1 || uc.SignaturesRequired > 1
+}
+
+// multisigInputExtraSize estimates how many bytes a multisig input adds to a
+// transaction beyond the size of a single signature input.
+func multisigInputExtraSize(uc types.UnlockConditions) uint64 {
+	if !isMultisig(uc) {
+		return 0
+	}
+	size := uint64(multisigKeySize * (len(uc.PublicKeys) - 1))
+	if uc.SignaturesRequired > 1 {
+		size += multisigSignatureSize * (uc.SignaturesRequired - 1)
+	}
+	return size
+}
+
+// partialTransaction returns the transaction with its signature counts.
+func partialTransaction(t walletutil.OfflineTransaction) APIPartialTransaction {
+	return APIPartialTransaction{
+		Transaction: t,
+		Signatures:  walletutil.SignatureCounts(t.Transaction),
+		Complete:    walletutil.CheckSigned(t.Transaction) == nil,
+	}
+}
+
+// parsePublicKeysHelper reads ed25519 public keys separated by commas, spaces
+// or new lines, keeping their order.
+func parsePublicKeysHelper(keys []string) ([]types.SiaPublicKey, error) {
+	var publicKeys []types.SiaPublicKey
+	for _, key := range keys {
+		for _, field := range strings.FieldsFunc(key, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+			spk, err := scanPublicKey(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid public key", field)
+			}
+			publicKeys = append(publicKeys, spk)
+		}
+	}
+	return publicKeys, nil
+}
+
+// publicKeyHelper returns the public key of a new address of the wallet.
+func publicKeyHelper(wallet modules.Wallet) (APIPublicKey, error) {
+	uc, err := wallet.NextAddress()
+	if err != nil {
+		return APIPublicKey{}, err
+	}
+	return APIPublicKey{PublicKey: uc.PublicKeys[0], Address: uc.UnlockHash()}, nil
+}
+
+// multisigAddressesHelper lists the watched addresses whose unlock conditions
+// are multisig.
+func multisigAddressesHelper(wallet modules.Wallet) ([]APIMultisigAddress, error) {
+	addrs, err := wallet.WatchAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var multisig []APIMultisigAddress
+	for _, addr := range addrs {
+		uc, err := wallet.UnlockConditions(addr)
+		if err != nil || !isMultisig(uc) {
+			continue
+		}
+		multisig = append(multisig, APIMultisigAddress{Address: addr, UnlockConditions: uc})
+	}
+	return multisig, nil
+}
+
+// createMultisigHelper adds the unlock conditions of a multisig address to
+// the wallet and starts watching the address in the background.
+func createMultisigHelper(wallet modules.Wallet, publicKeys []string, required string, sessionID string) (types.UnlockConditions, error) {
+	keys, err := parsePublicKeysHelper(publicKeys)
+	if err != nil {
+		return types.UnlockConditions{}, err
+	}
+	signaturesRequired, err := strconv.ParseUint(strings.TrimSpace(required), 10, 64)
+	if err != nil {
+		return types.UnlockConditions{}, errors.New("signatures required must be a whole number")
+	}
+	uc, err := walletutil.NewMultisigUnlockConditions(keys, signaturesRequired)
+	if err != nil {
+		return uc, err
+	}
+	if operationRunning(sessionID) {
+		return uc, errors.New("another operation is running")
+	}
+	if err := wallet.AddUnlockConditions(uc); err != nil {
+		return uc, err
+	}
+	startOperation(OperationWatching, sessionID)
+	go watchMultisigHelper(wallet, uc.UnlockHash(), sessionID)
+	return uc, nil
+}
+
+// watchMultisigHelper watches the multisig address and rescans the
+// blockchain for its outputs.
+func watchMultisigHelper(wallet modules.Wallet, addr types.UnlockHash, sessionID string) {
+	if err := wallet.AddWatchAddresses([]types.UnlockHash{addr}, false); err != nil {
+		setAlert(fmt.Sprintf("Unable to watch multisig address: %v", err), sessionID)
+		finishOperation(OperationWatching, err, sessionID)
+		return
+	}
+	dropHistoryCache(wallet)
+	finishOperation(OperationWatching, nil, sessionID)
+}
+
+// coSignHelper adds the signatures of the wallet's primary seed to the
+// transaction.
+func coSignHelper(wallet modules.Wallet, t *walletutil.OfflineTransaction) error {
+	seed, _, err := wallet.PrimarySeed()
+	if err != nil {
+		return err
+	}
+	_, err = t.SignWithSeed(walletutil.Seed(seed))
+	return err
+}
+
+// partialTransactionFromRequest reads the transaction uploaded with the form
+// or, when there is none, the one pasted into it. A transaction wrapped with
+// its signature counts is accepted as well.
+func partialTransactionFromRequest(req *http.Request) (walletutil.OfflineTransaction, error) {
+	text := req.FormValue("transaction")
+	file, _, err := req.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		b, err := io.ReadAll(file)
+		if err != nil {
+			return walletutil.OfflineTransaction{}, fmt.Errorf("unable to upload transaction file: %v", err)
+		}
+		text = string(b)
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return walletutil.OfflineTransaction{}, fmt.Errorf("unable to upload transaction file: %v", err)
+	}
+	return parsePartialTransaction([]byte(text))
+}
+
+// parsePartialTransaction decodes a transaction that is either bare or
+// wrapped with its signature counts.
+func parsePartialTransaction(b []byte) (walletutil.OfflineTransaction, error) {
+	var partial APIPartialTransaction
+	if err := json.Unmarshal(b, &partial); err != nil {
+		return walletutil.OfflineTransaction{}, fmt.Errorf("unable to read transaction: %v", err)
+	}
+	if len(partial.Transaction.Transaction.SiacoinInputs) != 0 || len(partial.Transaction.Transaction.SiafundInputs) != 0 {
+		return partial.Transaction, nil
+	}
+	var t walletutil.OfflineTransaction
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("unable to read transaction: %v", err)
+	}
+	if len(t.Transaction.SiacoinInputs) == 0 && len(t.Transaction.SiafundInputs) == 0 {
+		return t, errors.New("the transaction has no inputs")
+	}
+	return t, nil
+}
+
+// multisigRowsHelper renders the multisig addresses as table rows.
+func multisigRowsHelper(addrs []APIMultisigAddress) string {
+	rows := ""
+	for _, addr := range addrs {
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%d of %d</td></tr>\n", addr.Address, addr.UnlockConditions.SignaturesRequired, len(addr.UnlockConditions.PublicKeys))
+	}
+	if rows == "" {
+		rows = "<tr><td colspan='2'>The wallet watches no multisig addresses.</td></tr>"
+	}
+	return rows
+}
+
+// multisigOptionsHelper renders the multisig addresses as select options.
+func multisigOptionsHelper(addrs []APIMultisigAddress) string {
+	options := ""
+	for _, addr := range addrs {
+		options += fmt.Sprintf("<option value='%s'>%s</option>\n", addr.Address, addr.Address)
+	}
+	return options
+}
+
+// writePartialTransaction writes the transaction along with how far it is
+// from being fully signed.
+func writePartialTransaction(w http.ResponseWriter, t walletutil.OfflineTransaction, sessionID string) {
+	partial := partialTransaction(t)
+	var status []string
+	for _, count := range partial.Signatures {
+		status = append(status, fmt.Sprintf("Input %v has %d of %d signatures.", count.ParentID, count.Signed, count.Required))
+	}
+	disabled := "disabled"
+	if partial.Complete {
+		status = append(status, "The transaction is fully signed and can be broadcast.")
+		disabled = ""
+	} else {
+		status = append(status, "Pass the transaction on to the next co-signer.")
+	}
+	b, _ := json.MarshalIndent(t, "", "  ")
+	form := resources.MultisigTransactionForm()
+	form = strings.Replace(form, "&MULTISIG_STATUS;", strings.Join(status, "<br>"), -1)
+	form = strings.Replace(form, "&MULTISIG_SUMMARY;", html.EscapeString(t.Summary()), -1)
+	form = strings.Replace(form, "&MULTISIG_TRANSACTION;", html.EscapeString(string(b)), -1)
+	form = strings.Replace(form, "&BROADCAST_DISABLED;", disabled, -1)
+	writeForm(w, "MULTISIG TRANSACTION", form, sessionID)
+}
+
+func multisigFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to retrieve multisig addresses: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	addrs, err := multisigAddressesHelper(wallet)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to retrieve multisig addresses: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	form := resources.MultisigForm()
+	form = strings.Replace(form, "&MULTISIG_ROWS;", multisigRowsHelper(addrs), -1)
+	form = strings.Replace(form, "&MULTISIG_OPTIONS;", multisigOptionsHelper(addrs), -1)
+	form = strings.Replace(form, "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	writeForm(w, "MULTISIG", form, sessionID)
+}
+
+func multisigPublicKeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to share a public key: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	key, err := publicKeyHelper(wallet)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	msg := fmt.Sprintf("Share this public key with the other co-signers:<br><br>%s", key.PublicKey)
+	writeMsg(w, "PUBLIC KEY", msg, sessionID)
+}
+
+func multisigCreateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to create multisig address: "
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	uc, err := createMultisigHelper(wallet, []string{req.FormValue("public_keys")}, req.FormValue("signatures_required"), sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	msg := fmt.Sprintf("Watching %d of %d multisig address %s. The blockchain is being rescanned for its outputs.", uc.SignaturesRequired, len(uc.PublicKeys), uc.UnlockHash())
+	writeMsg(w, "MULTISIG ADDRESS", msg, sessionID)
+}
+
+func multisigDraftHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to draft multisig spend: "
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	if req.FormValue("from") == "" {
+		msg := msgPrefix + "The wallet watches no multisig addresses."
+		writeError(w, msg, sessionID)
+		return
+	}
+	t, err := offlineSendHelper(wallet, req.FormValue("from"), req.FormValue("amount"), req.FormValue("destination"), req.FormValue("unlock"), req.FormValue("coin_type"), req.FormValue("change_address"), req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writePartialTransaction(w, t, sessionID)
+}
+
+func multisigTransactionHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to process multisig transaction: "
+	t, err := partialTransactionFromRequest(req)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	switch req.FormValue("action") {
+	case "sign":
+		wallet, err := getSpendingWallet(sessionID)
+		if err == nil {
+			err = coSignHelper(wallet, &t)
+		}
+		if err != nil {
+			msg := fmt.Sprintf("%s%v", msgPrefix, err)
+			writeError(w, msg, sessionID)
+			return
+		}
+	case "download":
+		writeOfflineTransaction(w, t, "multisig-transaction.json")
+		return
+	case "broadcast":
+		wallet, err := getWallet(sessionID)
+		if err != nil {
+			msg := fmt.Sprintf("%s%v", msgPrefix, err)
+			writeError(w, msg, sessionID)
+			return
+		}
+		txn, err := broadcastOfflineHelper(wallet, t)
+		if err != nil {
+			msg := fmt.Sprintf("%s%v", msgPrefix, err)
+			writeError(w, msg, sessionID)
+			return
+		}
+		writeMsg(w, "BROADCAST", fmt.Sprintf("Broadcast transaction %v.", txn.ID()), sessionID)
+		return
+	}
+	writePartialTransaction(w, t, sessionID)
+}
+
+func apiMultisigPublicKeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	key, err := publicKeyHelper(wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to share a public key: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+func apiMultisigAddressesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	addrs, err := multisigAddressesHelper(wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to retrieve multisig addresses: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIMultisigAddresses{Addresses: addrs})
+}
+
+func apiCreateMultisigHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	var params apiMultisigParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	uc, err := createMultisigHelper(wallet, params.PublicKeys, strconv.FormatUint(params.SignaturesRequired, 10), sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to create multisig address: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, APIMultisigAddress{Address: uc.UnlockHash(), UnlockConditions: uc})
+}
+
+func apiMultisigDraftHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	var params apiOfflineSendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if params.From == "" {
+		writeJSONError(w, http.StatusBadRequest, "Unable to draft multisig spend: From address is required.")
+		return
+	}
+	t, err := offlineSendHelper(wallet, params.From, params.Amount, params.Destination, params.Unlock, params.CoinType, params.ChangeAddress, params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to draft multisig spend: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, partialTransaction(t))
+}
+
+func apiMultisigSignHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var raw json.RawMessage
+	if !apiDecodeParams(w, req, &raw) {
+		return
+	}
+	t, err := parsePartialTransaction(raw)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to sign multisig transaction: %v", err))
+		return
+	}
+	if err := coSignHelper(wallet, &t); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to sign multisig transaction: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, partialTransaction(t))
+}
+
+func apiMultisigBroadcastHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	var raw json.RawMessage
+	if !apiDecodeParams(w, req, &raw) {
+		return
+	}
+	t, err := parsePartialTransaction(raw)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to broadcast multisig transaction: %v", err))
+		return
+	}
+	txn, err := broadcastOfflineHelper(wallet, t)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to broadcast multisig transaction: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransactionIDs([]types.Transaction{txn}))
+}
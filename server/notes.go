@@ -0,0 +1,413 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"gitlab.com/scpcorp/ScPrime/modules"
+
+	"gitlab.com/scpcorp/webwallet/modules/txnotes"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// legacyNotePrefix prefixes the browser storage keys that the GUI used to
+// keep notes under, followed by the short transaction ID.
+const legacyNotePrefix = "note-"
+
+// APINotes lists the transaction notes of the active wallet.
+type APINotes struct {
+	Notes []txnotes.Note `json:"notes"`
+}
+
+// APIMigratedNotes is the number of browser storage notes that were imported
+// and the storage keys they were read from.
+type APIMigratedNotes struct {
+	Imported int      `json:"imported"`
+	Keys     []string `json:"keys"`
+}
+
+// apiNoteParams is the note and tags of a transaction.
+type apiNoteParams struct {
+	Note string   `json:"note"`
+	Tags []string `json:"tags"`
+}
+
+// shortTransactionID abbreviates the transaction ID the way the history table
+// shows it.
+func shortTransactionID(id string) string {
+	if len(id) < 32 {
+		return id
+	}
+	return id[0:16] + "..." + id[len(id)-16:]
+}
+
+// notesHelper returns the notes of the session's active wallet by transaction
+// ID. The map is empty when the notes can not be read.
+func notesHelper(sessionID string) map[string]txnotes.Note {
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		return map[string]txnotes.Note{}
+	}
+	notes, err := txnotes.List(dir)
+	if err != nil {
+		return map[string]txnotes.Note{}
+	}
+	return txnotes.ByTransaction(notes)
+}
+
+// transactionNote returns the note of the transaction, whose ID may be upper
+// case as in the summarized transactions.
+func transactionNote(notes map[string]txnotes.Note, txnID string) txnotes.Note {
+	note := notes[strings.ToLower(txnID)]
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+	return note
+}
+
+// notesMigratedHelper returns true when the browser storage notes of the
+// session's active wallet were imported or no wallet is open.
+func notesMigratedHelper(sessionID string) bool {
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		return true
+	}
+	migrated, err := txnotes.Migrated(dir)
+	return err != nil || migrated
+}
+
+// transactionIDsHelper returns the IDs of the wallet's confirmed and
+// unconfirmed transactions.
+func transactionIDsHelper(wallet modules.Wallet) ([]string, error) {
+	sts, err := cachedHistoryHelper(wallet)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, st := range sts {
+		ids = append(ids, strings.ToLower(st.TxnID))
+	}
+	return ids, nil
+}
+
+// legacyNotesHelper converts notes keyed by note-<short transaction ID> into
+// notes keyed by the full ID of the wallet's matching transaction. It returns
+// the keys that matched a transaction of the wallet.
+func legacyNotesHelper(wallet modules.Wallet, legacy map[string]string) ([]txnotes.Note, []string, error) {
+	ids, err := transactionIDsHelper(wallet)
+	if err != nil {
+		return nil, nil, err
+	}
+	fullIDs := make(map[string]string)
+	for _, id := range ids {
+		fullIDs[legacyNotePrefix+shortTransactionID(id)] = id
+	}
+	notes := []txnotes.Note{}
+	keys := []string{}
+	for key, text := range legacy {
+		// the history table showed the IDs in upper case
+		id, exists := fullIDs[strings.ToLower(key)]
+		if !exists {
+			continue
+		}
+		notes = append(notes, txnotes.Note{TransactionID: id, Note: text})
+		keys = append(keys, key)
+	}
+	return notes, keys, nil
+}
+
+// readNotesHelper reads a list of notes, or the object of note-<short
+// transaction ID> keys that the GUI used to export from browser storage.
+func readNotesHelper(wallet modules.Wallet, b []byte) ([]txnotes.Note, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		var notes []txnotes.Note
+		if err := json.Unmarshal(b, &notes); err != nil {
+			return nil, fmt.Errorf("unable to read notes: %v", err)
+		}
+		return notes, nil
+	}
+	var legacy map[string]string
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return nil, fmt.Errorf("unable to read notes: %v", err)
+	}
+	notes, _, err := legacyNotesHelper(wallet, legacy)
+	return notes, err
+}
+
+// writeNotesExport writes the notes as a downloadable JSON file.
+func writeNotesExport(w http.ResponseWriter, notes []txnotes.Note) {
+	b, _ := json.MarshalIndent(notes, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-disposition", "attachment;filename=notes.json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+func saveNoteHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		writeJSONError(w, http.StatusUnauthorized, "Session ID does not exist.")
+		return
+	}
+	var msgPrefix = "Unable to save note: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	note := txnotes.Note{
+		TransactionID: req.FormValue("transaction_id"),
+		Note:          req.FormValue("note"),
+		Tags:          txnotes.ParseTags(req.FormValue("tags")),
+	}
+	note, err = txnotes.Set(dir, note)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+func migrateNotesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		writeJSONError(w, http.StatusUnauthorized, "Session ID does not exist.")
+		return
+	}
+	var msgPrefix = "Unable to migrate notes: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	var legacy map[string]string
+	if err := json.Unmarshal([]byte(req.FormValue("notes")), &legacy); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	notes, keys, err := legacyNotesHelper(wallet, legacy)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	count, err := txnotes.Migrate(dir, notes)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIMigratedNotes{Imported: count, Keys: keys})
+}
+
+func exportNotesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to export notes: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	notes, err := txnotes.List(dir)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeNotesExport(w, notes)
+}
+
+func importNotesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to import notes: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	wallet, err := getWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload notes file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload notes file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	notes, err := readNotesHelper(wallet, b)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	count, err := txnotes.Import(dir, notes, req.FormValue("merge_type") == "overwrite_existing")
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeMsg(w, "IMPORT NOTES", fmt.Sprintf("Imported %d notes.", count), sessionID)
+}
+
+func importExportNotesFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		msg := "Session ID does not exist."
+		writeError(w, msg, "")
+	}
+	title := "IMPORT / EXPORT NOTES"
+	form := resources.ImportExportNotesForm()
+	writeForm(w, title, form, sessionID)
+}
+
+func importExportNotesCancelHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		msg := "Session ID does not exist."
+		writeError(w, msg, "")
+	}
+	cancel := req.FormValue("cancel")
+	if cancel == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+}
+
+// apiNotesDir returns the notes directory of the request's session, writing
+// an error when no wallet is open.
+func apiNotesDir(w http.ResponseWriter, req *http.Request) (string, bool) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return "", false
+	}
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unable to open notes: %v", err))
+		return "", false
+	}
+	return dir, true
+}
+
+// apiNotesError writes a notes error with the status that matches it.
+func apiNotesError(w http.ResponseWriter, msgPrefix string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, txnotes.ErrNoteNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, txnotes.ErrInvalidTransactionID) {
+		status = http.StatusBadRequest
+	}
+	writeJSONError(w, status, fmt.Sprintf("%s%v", msgPrefix, err))
+}
+
+func apiNotesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dir, ok := apiNotesDir(w, req)
+	if !ok {
+		return
+	}
+	notes, err := txnotes.List(dir)
+	if err != nil {
+		apiNotesError(w, "Unable to open notes: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APINotes{Notes: notes})
+}
+
+func apiNoteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dir, ok := apiNotesDir(w, req)
+	if !ok {
+		return
+	}
+	note, err := txnotes.Get(dir, ps.ByName("id"))
+	if err != nil {
+		apiNotesError(w, "Unable to open note: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+func apiSetNoteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dir, ok := apiNotesDir(w, req)
+	if !ok {
+		return
+	}
+	var params apiNoteParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	note, err := txnotes.Set(dir, txnotes.Note{TransactionID: ps.ByName("id"), Note: params.Note, Tags: params.Tags})
+	if err != nil {
+		apiNotesError(w, "Unable to save note: ", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+func apiDeleteNoteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	dir, ok := apiNotesDir(w, req)
+	if !ok {
+		return
+	}
+	if err := txnotes.Remove(dir, ps.ByName("id")); err != nil {
+		apiNotesError(w, "Unable to delete note: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiImportNotesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, wallet, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	var msgPrefix = "Unable to import notes: "
+	dir, err := sessionWalletDir(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	notes, err := readNotesHelper(wallet, b)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	count, err := txnotes.Import(dir, notes, req.URL.Query().Get("overwrite") == "true")
+	if err != nil {
+		apiNotesError(w, msgPrefix, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APIImported{Imported: count})
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+	walletutil "gitlab.com/scpcorp/webwallet/utils/wallet"
+)
+
+// apiOfflineSendParams describe a send from watched addresses that is signed
+// offline or by co-signers. Only outputs of From are spent when it is set.
+// Change returns to ChangeAddress, or to the address of the first input when
+// it is empty.
+type apiOfflineSendParams struct {
+	From          string `json:"from"`
+	Amount        string `json:"amount"`
+	Destination   string `json:"destination"`
+	Unlock        string `json:"unlock"`
+	CoinType      string `json:"coin_type"`
+	ChangeAddress string `json:"change_address"`
+	FeeLevel      string `json:"fee_level"`
+	FeePerByte    string `json:"fee_per_byte"`
+}
+
+// buildOfflineHelper builds an unsigned transaction that funds the outputs
+// with the largest confirmed outputs of the watched addresses, or only of the
+// from address when it is set. Inputs whose unlock conditions the wallet does
+// not know are left for the offline wallet to fill in when it signs them, and
+// multisig inputs are left for their co-signers to add signatures to.
+func buildOfflineHelper(wallet modules.Wallet, coinOutputs []types.SiacoinOutput, fundOutputs []types.SiafundOutput, fundType string, from types.UnlockHash, changeAddress types.UnlockHash, feePerByte types.Currency) (walletutil.OfflineTransaction, error) {
+	t := walletutil.OfflineTransaction{Height: n.ConsensusSet.Height()}
+	if !n.ConsensusSet.Synced() {
+		return t, errors.New("cannot build transaction until fully synced")
+	}
+	watched, err := walletOutputsHelper(wallet, true)
+	if err != nil {
+		return t, err
+	}
+	coinCost := types.ZeroCurrency
+	for _, output := range coinOutputs {
+		coinCost = coinCost.Add(output.Value)
+	}
+	fundCost := types.ZeroCurrency
+	for _, output := range fundOutputs {
+		fundCost = fundCost.Add(output.Value)
+	}
+	outputs := len(coinOutputs) + len(fundOutputs)
+	var selected []SpendableOutput
+	ucs := make(map[types.OutputID]types.UnlockConditions)
+	var extraSize uint64
+	spendable := func(output SpendableOutput) bool {
+		if from != (types.UnlockHash{}) && output.Address != from {
+			return false
+		}
+		uc, err := wallet.UnlockConditions(output.Address)
+		if err == nil && uc.Timelock > t.Height {
+			return false
+		}
+		ucs[output.ID] = uc
+		extraSize += multisigInputExtraSize(uc)
+		return true
+	}
+	coinFund := types.ZeroCurrency
+	fundFund := types.ZeroCurrency
+	for _, output := range watched {
+		if output.FundType != fundType || fundFund.Cmp(fundCost) >= 0 || !spendable(output) {
+			continue
+		}
+		selected = append(selected, output)
+		fundFund = fundFund.Add(output.Value)
+	}
+	if fundFund.Cmp(fundCost) < 0 {
+		return t, fmt.Errorf("the watched addresses do not hold enough %s", fundType)
+	}
+	fee := feePerByte.Mul64(manualTxnSize(len(selected), outputs) + extraSize)
+	for _, output := range watched {
+		if output.FundType != "SCP" || coinFund.Cmp(coinCost.Add(fee)) >= 0 || !spendable(output) {
+			continue
+		}
+		selected = append(selected, output)
+		coinFund = coinFund.Add(output.Value)
+		fee = feePerByte.Mul64(manualTxnSize(len(selected), outputs) + extraSize)
+	}
+	if coinFund.Cmp(coinCost.Add(fee)) < 0 {
+		return t, fmt.Errorf("the watched addresses do not hold enough SCP to cover the amount and the miner fee of %s", fmtPreviewValue("SCP", fee))
+	}
+	if len(selected) == 0 {
+		return t, errors.New("nothing to send")
+	}
+	if changeAddress == (types.UnlockHash{}) {
+		changeAddress = selected[0].Address
+	}
+	txn := &t.Transaction
+	for _, output := range selected {
+		if output.FundType == "SCP" {
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{ParentID: types.SiacoinOutputID(output.ID), UnlockConditions: ucs[output.ID]})
+			t.SiacoinParents = append(t.SiacoinParents, walletutil.SiacoinParent{
+				ID:     types.SiacoinOutputID(output.ID),
+				Output: types.SiacoinOutput{Value: output.Value, UnlockHash: output.Address},
+			})
+		} else {
+			txn.SiafundInputs = append(txn.SiafundInputs, types.SiafundInput{ParentID: types.SiafundOutputID(output.ID), UnlockConditions: ucs[output.ID], ClaimUnlockHash: changeAddress})
+			t.SiafundParents = append(t.SiafundParents, walletutil.SiafundParent{
+				ID:     types.SiafundOutputID(output.ID),
+				Output: types.SiafundOutput{Value: output.Value, UnlockHash: output.Address},
+			})
+		}
+		if isMultisig(ucs[output.ID]) {
+			continue
+		}
+		txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+			ParentID:       crypto.Hash(output.ID),
+			CoveredFields:  types.CoveredFields{WholeTransaction: true},
+			PublicKeyIndex: 0,
+		})
+	}
+	txn.SiacoinOutputs = append(txn.SiacoinOutputs, coinOutputs...)
+	txn.SiafundOutputs = append(txn.SiafundOutputs, fundOutputs...)
+	if change := coinFund.Sub(coinCost).Sub(fee); !change.IsZero() {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{Value: change, UnlockHash: changeAddress})
+	}
+	if change := fundFund.Sub(fundCost); !change.IsZero() {
+		txn.SiafundOutputs = append(txn.SiafundOutputs, types.SiafundOutput{Value: change, UnlockHash: changeAddress})
+	}
+	txn.MinerFees = []types.Currency{fee}
+	return t, nil
+}
+
+// offlineSendHelper parses an offline send and builds its unsigned
+// transaction.
+func offlineSendHelper(wallet modules.Wallet, from string, amount string, destination string, unlock string, coinType string, changeAddress string, feeLevel string, customFee string) (walletutil.OfflineTransaction, error) {
+	var fromAddress types.UnlockHash
+	if strings.TrimSpace(from) != "" {
+		var err error
+		fromAddress, err = scanAddress(strings.TrimSpace(from))
+		if err != nil {
+			return walletutil.OfflineTransaction{}, errors.New("from address is not valid")
+		}
+	}
+	var change types.UnlockHash
+	if strings.TrimSpace(changeAddress) != "" {
+		var err error
+		change, err = scanAddress(strings.TrimSpace(changeAddress))
+		if err != nil {
+			return walletutil.OfflineTransaction{}, errors.New("change address is not valid")
+		}
+	}
+	coinOutputs, fundAOutputs, fundBOutputs, err := sendOutputsHelper(amount, destination, unlock, coinType)
+	if err != nil {
+		return walletutil.OfflineTransaction{}, err
+	}
+	feePerByte, err := feePerByteHelper(feeLevel, customFee)
+	if err != nil {
+		return walletutil.OfflineTransaction{}, err
+	}
+	return buildOfflineHelper(wallet, coinOutputs, append(fundAOutputs, fundBOutputs...), coinType, fromAddress, change, feePerByte)
+}
+
+// broadcastOfflineHelper checks that a transaction signed offline spends only
+// unspent outputs of the watched addresses and is fully signed, and then
+// broadcasts it.
+func broadcastOfflineHelper(wallet modules.Wallet, t walletutil.OfflineTransaction) (types.Transaction, error) {
+	txn := t.Transaction
+	if len(txn.SiacoinInputs) == 0 && len(txn.SiafundInputs) == 0 {
+		return txn, errors.New("the transaction has no inputs")
+	}
+	if err := walletutil.CheckSigned(txn); err != nil {
+		return txn, err
+	}
+	watched, err := walletOutputsHelper(wallet, true)
+	if err != nil {
+		return txn, err
+	}
+	unspent := make(map[types.OutputID]bool)
+	for _, output := range watched {
+		unspent[output.ID] = true
+	}
+	for _, sci := range txn.SiacoinInputs {
+		if !unspent[types.OutputID(sci.ParentID)] {
+			return txn, fmt.Errorf("input %v does not spend an unspent output of this wallet", sci.ParentID)
+		}
+	}
+	for _, sfi := range txn.SiafundInputs {
+		if !unspent[types.OutputID(sfi.ParentID)] {
+			return txn, fmt.Errorf("input %v does not spend an unspent output of this wallet", sfi.ParentID)
+		}
+	}
+	if err := txn.StandaloneValid(n.ConsensusSet.Height()); err != nil {
+		return txn, err
+	}
+	if err := n.TransactionPool.AcceptTransactionSet([]types.Transaction{txn}); err != nil {
+		return txn, err
+	}
+	return txn, nil
+}
+
+// watchOnlyWallet returns the session's active wallet when it is watch-only.
+func watchOnlyWallet(sessionID string) (modules.Wallet, error) {
+	if !watchOnlySession(sessionID) {
+		return nil, errors.New("only watch-only wallets exchange transactions with an offline wallet")
+	}
+	return getWallet(sessionID)
+}
+
+// writeOfflineTransaction writes the transaction as a downloadable file.
+func writeOfflineTransaction(w http.ResponseWriter, t walletutil.OfflineTransaction, filename string) {
+	b, _ := json.MarshalIndent(t, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-disposition", "attachment;filename="+filename)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+func exportUnsignedFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if _, err := watchOnlyWallet(sessionID); err != nil {
+		msg := fmt.Sprintf("Unable to export transaction: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	form := strings.Replace(resources.ExportUnsignedForm(), "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	writeForm(w, "EXPORT UNSIGNED TRANSACTION", form, sessionID)
+}
+
+func exportUnsignedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to export transaction: "
+	wallet, err := watchOnlyWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	t, err := offlineSendHelper(wallet, req.FormValue("from"), req.FormValue("amount"), req.FormValue("destination"), req.FormValue("unlock"), req.FormValue("coin_type"), req.FormValue("change_address"), req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeOfflineTransaction(w, t, "unsigned-transaction.json")
+}
+
+func broadcastSignedFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if _, err := watchOnlyWallet(sessionID); err != nil {
+		msg := fmt.Sprintf("Unable to broadcast transaction: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeForm(w, "BROADCAST SIGNED TRANSACTION", resources.BroadcastSignedForm(), sessionID)
+}
+
+func broadcastSignedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to broadcast transaction: "
+	wallet, err := watchOnlyWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload signed transaction file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to upload signed transaction file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	var t walletutil.OfflineTransaction
+	if err := json.Unmarshal(b, &t); err != nil {
+		msg := fmt.Sprintf("%s%s%v", msgPrefix, "Unable to read signed transaction file: ", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	txn, err := broadcastOfflineHelper(wallet, t)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeMsg(w, "BROADCAST", fmt.Sprintf("Broadcast transaction %v.", txn.ID()), sessionID)
+}
+
+func apiExportUnsignedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	wallet, err := watchOnlyWallet(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Unable to export transaction: %v", err))
+		return
+	}
+	var params apiOfflineSendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	t, err := offlineSendHelper(wallet, params.From, params.Amount, params.Destination, params.Unlock, params.CoinType, params.ChangeAddress, params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to export transaction: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func apiBroadcastSignedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	wallet, err := watchOnlyWallet(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Unable to broadcast transaction: %v", err))
+		return
+	}
+	var t walletutil.OfflineTransaction
+	if !apiDecodeParams(w, req, &t) {
+		return
+	}
+	txn, err := broadcastOfflineHelper(wallet, t)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to broadcast transaction: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransactionIDs([]types.Transaction{txn}))
+}
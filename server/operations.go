@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Operation types.
+const (
+	OperationScanning      = "Scanning"
+	OperationInitializing  = "Initializing"
+	OperationRestoring     = "Restoring"
+	OperationConsolidating = "Consolidating"
+)
+
+// Operation tracks a long running operation on a session.
+type Operation struct {
+	Type     string    `json:"type"`
+	Started  time.Time `json:"started"`
+	Running  bool      `json:"running"`
+	Progress float64   `json:"progress"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// startOperation starts tracking a new operation on the session.
+func startOperation(opType string, sessionID string) {
+	store.Update(sessionID, func(session *Session) {
+		session.operation = Operation{
+			Type:    opType,
+			Started: time.Now(),
+			Running: true,
+		}
+	})
+}
+
+// setOperationProgress sets the progress, from 0 to 1, of the session's
+// operation when it is still running the supplied operation type.
+func setOperationProgress(opType string, progress float64, sessionID string) {
+	store.Update(sessionID, func(session *Session) {
+		if session.operation.Type == opType && session.operation.Running {
+			session.operation.Progress = progress
+		}
+	})
+}
+
+// finishOperation marks the session's operation as finished when it is still
+// running the supplied operation type. The session's idle time starts over
+// from the end of the operation.
+func finishOperation(opType string, err error, sessionID string) {
+	store.Update(sessionID, func(session *Session) {
+		if session.operation.Type != opType || !session.operation.Running {
+			return
+		}
+		session.operation.Running = false
+		session.lastActivity = time.Now()
+		if err != nil {
+			session.operation.Error = err.Error()
+		} else {
+			session.operation.Progress = 1
+		}
+	})
+}
+
+// operationRunning returns true when the session has a running operation.
+func operationRunning(sessionID string) bool {
+	session, _ := store.Get(sessionID)
+	return session.operation.Running
+}
+
+// operationStatus returns the type of the session's running operation or an
+// empty string when no operation is running.
+func operationStatus(sessionID string) string {
+	session, _ := store.Get(sessionID)
+	if !session.operation.Running {
+		return ""
+	}
+	return session.operation.Type
+}
+
+// operationHelper returns the session's operation, estimating the progress of
+// running scans, restores and watch-only rescans from the wallet's block height.
+func operationHelper(sessionID string) Operation {
+	session, _ := store.Get(sessionID)
+	op := session.operation
+	if !op.Running || (op.Type != OperationScanning && op.Type != OperationRestoring && op.Type != OperationWatching) || session.wallet == nil {
+		return op
+	}
+	height, err := session.wallet.Height()
+	csHeight := n.ConsensusSet.Height()
+	if err != nil || csHeight == 0 {
+		return op
+	}
+	progress := float64(height) / float64(csHeight)
+	if progress > 1 {
+		progress = 1
+	}
+	setOperationProgress(op.Type, progress, sessionID)
+	op.Progress = progress
+	return op
+}
+
+func operationHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		writeJSONError(w, http.StatusUnauthorized, "Session ID does not exist.")
+		return
+	}
+	touchSession(sessionID)
+	writeJSON(w, http.StatusOK, operationHelper(sessionID))
+}
+
+func apiOperationHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, operationHelper(sessionID))
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/webwallet/modules/apitokens"
 )
 
 func buildHTTPRoutes() *httprouter.Router {
@@ -36,61 +38,215 @@ func buildHTTPRoutes() *httprouter.Router {
 		router.GET("/", guiHandler)
 		router.GET("/gui", guiHandler)
 		router.GET("/gui/export", redirect)
+		router.GET("/gui/addressBook", redirect)
 		router.GET("/gui/alert/changeLock", redirect)
+		router.GET("/gui/apiTokens", redirect)
+		router.GET("/gui/broadcastSigned", redirect)
+		router.GET("/gui/broadcastSignedForm", redirect)
 		router.GET("/gui/alert/initializeSeed", redirect)
 		router.GET("/gui/alert/sendCoins", redirect)
 		router.GET("/gui/alert/receiveCoins", redirect)
 		router.GET("/gui/alert/recoverSeed", redirect)
 		router.GET("/gui/alert/restoreFromSeed", redirect)
+		router.GET("/gui/alert/watchOnly", redirect)
 		router.GET("/gui/changeLock", redirect)
+		router.GET("/gui/claimTimelocked", redirect)
+		router.GET("/gui/coinControl", redirect)
+		router.GET("/gui/coinControlSend", redirect)
 		router.GET("/gui/collapseMenu", redirect)
+		router.GET("/gui/consolidate", redirect)
+		router.GET("/gui/consolidateForm", redirect)
+		router.GET("/gui/consolidatePlan", redirect)
+		router.GET("/gui/confirmSend", redirect)
+		router.GET("/gui/createApiToken", redirect)
 		router.GET("/gui/deleteConsensus", redirect)
+		router.GET("/gui/deleteAddressBookEntry", redirect)
 		router.GET("/gui/deleteConsensusForm", redirect)
 		router.GET("/gui/expandMenu", redirect)
+		router.GET("/gui/extendSession", redirect)
 		router.GET("/gui/explainWhale", redirect)
+		router.GET("/gui/exportAddressBook", redirect)
+		router.GET("/gui/exportHistoryForm", redirect)
+		router.GET("/gui/exportNotes", redirect)
+		router.GET("/gui/exportUnsigned", redirect)
+		router.GET("/gui/exportUnsignedForm", redirect)
 		router.GET("/gui/importExportNotesForm", redirect)
+		router.GET("/gui/importAddressBook", redirect)
+		router.GET("/gui/importNotes", redirect)
 		router.GET("/gui/initializeSeed", redirect)
 		router.GET("/gui/lockWallet", redirect)
+		router.GET("/gui/manageWallets", redirect)
+		router.GET("/gui/multisigCreate", redirect)
+		router.GET("/gui/multisigDraft", redirect)
+		router.GET("/gui/multisigForm", redirect)
+		router.GET("/gui/multisigPublicKey", redirect)
+		router.GET("/gui/multisigTransaction", redirect)
 		router.GET("/gui/privacy", redirect)
 		router.GET("/gui/restoreSeed", redirect)
+		router.GET("/gui/revokeApiToken", redirect)
+		router.GET("/gui/saveAddressBookEntry", redirect)
 		router.GET("/gui/scanning", redirect)
 		router.GET("/gui/sendCoins", redirect)
 		router.GET("/gui/uploadMultispendCsvForm", redirect)
+		router.GET("/gui/retryMultisend", redirect)
+		router.GET("/gui/multisendJobs", redirect)
+		router.GET("/gui/multisendJob", redirect)
+		router.GET("/gui/multisendReconciliation", redirect)
+		router.GET("/gui/setDisplayUnit", redirect)
+		router.GET("/gui/setTxHistoryFilter", redirect)
 		router.GET("/gui/setTxHistoryPage", redirect)
+		router.GET("/gui/sweepSeed", redirect)
+		router.GET("/gui/sweepSeedForm", redirect)
+		router.GET("/gui/switchWallet", redirect)
+		router.GET("/gui/timelockedAddress", redirect)
 		router.GET("/gui/unlockWallet", redirect)
 		router.GET("/gui/unlockWalletForm", redirect)
+		router.GET("/gui/watchOnly", redirect)
 		router.GET("/gui/explorer", redirect)
 		router.POST("/gui", guiHandler)
-		router.POST("/gui/export", transactionHistoryCsvExport)
+		router.POST("/gui/export", exportHistoryHandler)
+		router.POST("/gui/exportHistoryForm", exportHistoryFormHandler)
+		router.POST("/gui/addressBook", addressBookHandler)
 		router.POST("/gui/alert/changeLock", alertChangeLockHandler)
 		router.POST("/gui/alert/initializeSeed", alertInitializeSeedHandler)
 		router.POST("/gui/alert/sendCoins", alertSendCoinsHandler)
 		router.POST("/gui/alert/receiveCoins", alertReceiveCoinsHandler)
 		router.POST("/gui/alert/recoverSeed", alertRecoverSeedHandler)
 		router.POST("/gui/alert/restoreFromSeed", alertRestoreFromSeedHandler)
+		router.POST("/gui/alert/watchOnly", alertWatchOnlyHandler)
+		router.POST("/gui/apiTokens", apiTokensFormHandler)
+		router.POST("/gui/broadcastSigned", broadcastSignedHandler)
+		router.POST("/gui/broadcastSignedForm", broadcastSignedFormHandler)
 		router.POST("/gui/changeLock", changeLockHandler)
+		router.POST("/gui/claimTimelocked", claimTimelockedHandler)
+		router.POST("/gui/coinControl", coinControlFormHandler)
+		router.POST("/gui/coinControlSend", coinControlSendHandler)
 		router.POST("/gui/collapseMenu", collapseMenuHandler)
+		router.POST("/gui/consolidate", consolidateHandler)
+		router.POST("/gui/consolidateForm", consolidateFormHandler)
+		router.POST("/gui/consolidatePlan", consolidatePlanHandler)
+		router.POST("/gui/confirmSend", confirmSendHandler)
+		router.POST("/gui/createApiToken", createAPITokenHandler)
 		router.POST("/gui/deleteConsensus", deleteConsensusHandler)
+		router.POST("/gui/deleteAddressBookEntry", deleteAddressBookEntryHandler)
 		router.POST("/gui/deleteConsensusForm", deleteConsensusFormHandler)
 		router.POST("/gui/expandMenu", expandMenuHandler)
+		router.POST("/gui/extendSession", extendSessionHandler)
 		router.POST("/gui/explainWhale", explainWhaleHandler)
+		router.POST("/gui/exportAddressBook", exportAddressBookHandler)
+		router.POST("/gui/exportNotes", exportNotesHandler)
+		router.POST("/gui/exportUnsigned", exportUnsignedHandler)
+		router.POST("/gui/exportUnsignedForm", exportUnsignedFormHandler)
 		router.POST("/gui/importExportNotesForm", importExportNotesFormHandler)
+		router.POST("/gui/importAddressBook", importAddressBookHandler)
+		router.POST("/gui/importNotes", importNotesHandler)
 		router.POST("/gui/importExportNotesCancel", importExportNotesCancelHandler)
 		router.POST("/gui/initializeSeed", initializeSeedHandler)
 		router.POST("/gui/lockWallet", lockWalletHandler)
+		router.POST("/gui/manageWallets", manageWalletsFormHandler)
+		router.POST("/gui/multisigCreate", multisigCreateHandler)
+		router.POST("/gui/multisigDraft", multisigDraftHandler)
+		router.POST("/gui/multisigForm", multisigFormHandler)
+		router.POST("/gui/multisigPublicKey", multisigPublicKeyHandler)
+		router.POST("/gui/multisigTransaction", multisigTransactionHandler)
+		router.POST("/gui/renameWallet", renameWalletHandler)
+		router.POST("/gui/archiveWallet", archiveWalletHandler)
+		router.POST("/gui/unarchiveWallet", unarchiveWalletHandler)
+		router.POST("/gui/deleteWallet", deleteWalletHandler)
 		router.POST("/gui/privacy", privacyHandler)
 		router.POST("/gui/restoreSeed", restoreSeedHandler)
+		router.POST("/gui/revokeApiToken", revokeAPITokenHandler)
+		router.POST("/gui/saveAddressBookEntry", saveAddressBookEntryHandler)
 		router.POST("/gui/scanning", scanningHandler)
 		router.POST("/gui/sendCoins", sendCoinsHandler)
 		router.POST("/gui/uploadMultispendCsvForm", uploadMultispendCsvFormHandler)
 		router.POST("/gui/uploadMultispendCsv", uploadMultispendCsvHandler)
+		router.POST("/gui/retryMultisend", retryMultisendHandler)
+		router.POST("/gui/multisendJobs", multisendJobsHandler)
+		router.POST("/gui/multisendJob", multisendJobHandler)
+		router.POST("/gui/multisendReconciliation", multisendReconciliationHandler)
+		router.POST("/gui/setDisplayUnit", setDisplayUnitHandler)
+		router.POST("/gui/setTxHistoryFilter", setTxHistoryFilterHandler)
 		router.POST("/gui/setTxHistoryPage", setTxHistoyPage)
+		router.POST("/gui/sweepSeed", sweepSeedHandler)
+		router.POST("/gui/sweepSeedForm", sweepSeedFormHandler)
+		router.POST("/gui/switchWallet", switchWalletHandler)
+		router.POST("/gui/timelockedAddress", timelockedAddressHandler)
+		router.POST("/gui/txHistoryPage", transactionHistoryJson)
 		router.POST("/gui/unlockWallet", unlockWalletHandler)
 		router.POST("/gui/unlockWalletForm", unlockWalletFormHandler)
+		router.POST("/gui/watchOnly", watchOnlyHandler)
 		router.POST("/gui/explorer", explorerHandler)
 		router.POST("/gui/balance", balanceHandler)
 		router.POST("/gui/blockHeight", blockHeightHandler)
-		router.POST("/api/txHistoryPage", transactionHistoryJson)
+		router.POST("/gui/operation", operationHandler)
+		router.POST("/gui/saveNote", saveNoteHandler)
+		router.POST("/gui/migrateNotes", migrateNotesHandler)
+
+		//API Calls
+		router.POST("/api/v1/wallet/unlock", requireScope(apitokens.ScopeAdmin, apiUnlockWalletHandler))
+		router.POST("/api/v1/wallet/lock", requireScope(apitokens.ScopeAdmin, apiLockWalletHandler))
+		router.POST("/api/v1/wallet/init", requireScope(apitokens.ScopeAdmin, apiInitializeSeedHandler))
+		router.POST("/api/v1/wallet/restore", requireScope(apitokens.ScopeAdmin, apiRestoreSeedHandler))
+		router.POST("/api/v1/wallet/watch", requireScope(apitokens.ScopeAdmin, apiWatchOnlyHandler))
+		router.POST("/api/v1/wallet/changelock", requireScope(apitokens.ScopeAdmin, apiChangeLockHandler))
+		router.GET("/api/v1/wallet/balance", requireScope(apitokens.ScopeReadOnly, apiBalanceHandler))
+		router.GET("/api/v1/wallet/operation", requireScope(apitokens.ScopeReadOnly, apiOperationHandler))
+		router.GET("/api/v1/wallet/addresses", requireScope(apitokens.ScopeReadOnly, apiAddressesHandler))
+		router.POST("/api/v1/wallet/address", requireScope(apitokens.ScopeSpend, apiNewAddressHandler))
+		router.GET("/api/v1/wallet/timelocked", requireScope(apitokens.ScopeReadOnly, apiTimelockedAddressesHandler))
+		router.POST("/api/v1/wallet/timelocked", requireScope(apitokens.ScopeSpend, apiNewTimelockedAddressHandler))
+		router.POST("/api/v1/wallet/timelocked/claim", requireScope(apitokens.ScopeSpend, apiClaimTimelockedHandler))
+		router.GET("/api/v1/wallet/addressbook", requireScope(apitokens.ScopeReadOnly, apiAddressBookHandler))
+		router.POST("/api/v1/wallet/addressbook", requireScope(apitokens.ScopeSpend, apiAddAddressBookEntryHandler))
+		router.GET("/api/v1/wallet/addressbook/export", requireScope(apitokens.ScopeReadOnly, apiExportAddressBookHandler))
+		router.POST("/api/v1/wallet/addressbook/import", requireScope(apitokens.ScopeSpend, apiImportAddressBookHandler))
+		router.PUT("/api/v1/wallet/addressbook/:id", requireScope(apitokens.ScopeSpend, apiUpdateAddressBookEntryHandler))
+		router.DELETE("/api/v1/wallet/addressbook/:id", requireScope(apitokens.ScopeSpend, apiDeleteAddressBookEntryHandler))
+		router.GET("/api/v1/wallet/export", requireScope(apitokens.ScopeReadOnly, apiExportHistoryHandler))
+		router.GET("/api/v1/wallet/notes", requireScope(apitokens.ScopeReadOnly, apiNotesHandler))
+		router.POST("/api/v1/wallet/notes/import", requireScope(apitokens.ScopeSpend, apiImportNotesHandler))
+		router.GET("/api/v1/wallet/notes/:id", requireScope(apitokens.ScopeReadOnly, apiNoteHandler))
+		router.PUT("/api/v1/wallet/notes/:id", requireScope(apitokens.ScopeSpend, apiSetNoteHandler))
+		router.DELETE("/api/v1/wallet/notes/:id", requireScope(apitokens.ScopeSpend, apiDeleteNoteHandler))
+		router.POST("/api/v1/wallet/send", requireScope(apitokens.ScopeSpend, apiSendCoinsHandler))
+		router.POST("/api/v1/wallet/multisend", requireScope(apitokens.ScopeSpend, apiMultisendHandler))
+		router.POST("/api/v1/wallet/send/preview", requireScope(apitokens.ScopeSpend, apiPreviewSendHandler))
+		router.POST("/api/v1/wallet/multisend/preview", requireScope(apitokens.ScopeSpend, apiPreviewMultisendHandler))
+		router.POST("/api/v1/wallet/multisend/validate", requireScope(apitokens.ScopeSpend, apiValidateMultisendHandler))
+		router.GET("/api/v1/wallet/multisend/jobs", requireScope(apitokens.ScopeReadOnly, apiMultisendJobsHandler))
+		router.GET("/api/v1/wallet/multisend/jobs/:id", requireScope(apitokens.ScopeReadOnly, apiMultisendJobHandler))
+		router.POST("/api/v1/wallet/multisend/jobs/:id/retry", requireScope(apitokens.ScopeSpend, apiRetryMultisendJobHandler))
+		router.GET("/api/v1/wallet/multisend/jobs/:id/reconciliation", requireScope(apitokens.ScopeReadOnly, apiMultisendReconciliationHandler))
+		router.GET("/api/v1/wallet/outputs", requireScope(apitokens.ScopeReadOnly, apiSpendableOutputsHandler))
+		router.POST("/api/v1/wallet/coincontrol/preview", requireScope(apitokens.ScopeSpend, apiPreviewCoinControlHandler))
+		router.GET("/api/v1/wallet/consolidate", requireScope(apitokens.ScopeReadOnly, apiConsolidationPlanHandler))
+		router.POST("/api/v1/wallet/consolidate", requireScope(apitokens.ScopeSpend, apiConsolidateHandler))
+		router.POST("/api/v1/wallet/sweep", requireScope(apitokens.ScopeSpend, apiSweepSeedHandler))
+		router.POST("/api/v1/wallet/offline/unsigned", requireScope(apitokens.ScopeSpend, apiExportUnsignedHandler))
+		router.POST("/api/v1/wallet/offline/broadcast", requireScope(apitokens.ScopeSpend, apiBroadcastSignedHandler))
+		router.GET("/api/v1/wallet/multisig", requireScope(apitokens.ScopeReadOnly, apiMultisigAddressesHandler))
+		router.POST("/api/v1/wallet/multisig", requireScope(apitokens.ScopeSpend, apiCreateMultisigHandler))
+		router.POST("/api/v1/wallet/multisig/publickey", requireScope(apitokens.ScopeSpend, apiMultisigPublicKeyHandler))
+		router.POST("/api/v1/wallet/multisig/draft", requireScope(apitokens.ScopeSpend, apiMultisigDraftHandler))
+		router.POST("/api/v1/wallet/multisig/sign", requireScope(apitokens.ScopeSpend, apiMultisigSignHandler))
+		router.POST("/api/v1/wallet/multisig/broadcast", requireScope(apitokens.ScopeSpend, apiMultisigBroadcastHandler))
+		router.GET("/api/v1/wallet/send/pending", requireScope(apitokens.ScopeReadOnly, apiPendingSendHandler))
+		router.POST("/api/v1/wallet/send/confirm", requireScope(apitokens.ScopeSpend, apiConfirmSendHandler))
+		router.POST("/api/v1/wallet/send/cancel", requireScope(apitokens.ScopeSpend, apiCancelSendHandler))
+		router.GET("/api/v1/wallet/transactions", requireScope(apitokens.ScopeReadOnly, apiTransactionHistoryHandler))
+		router.GET("/api/v1/wallet/transactions/:id", requireScope(apitokens.ScopeReadOnly, apiTransactionHandler))
+		router.GET("/api/v1/fees", requireScope(apitokens.ScopeReadOnly, apiFeesHandler))
+		router.GET("/api/v1/wallets", requireScope(apitokens.ScopeReadOnly, apiWalletsHandler))
+		router.GET("/api/v1/wallets/balance", requireScope(apitokens.ScopeReadOnly, apiAggregateBalanceHandler))
+		router.POST("/api/v1/wallets/:name/rename", requireScope(apitokens.ScopeAdmin, apiRenameWalletHandler))
+		router.POST("/api/v1/wallets/:name/archive", requireScope(apitokens.ScopeAdmin, apiArchiveWalletHandler))
+		router.POST("/api/v1/wallets/:name/unarchive", requireScope(apitokens.ScopeAdmin, apiUnarchiveWalletHandler))
+		router.DELETE("/api/v1/wallets/:name", requireScope(apitokens.ScopeAdmin, apiDeleteWalletHandler))
+		router.POST("/api/v1/wallet/switch", requireScope(apitokens.ScopeReadOnly, apiSwitchWalletHandler))
+		router.GET("/api/v1/tokens", requireScope(apitokens.ScopeAdmin, apiListTokensHandler))
+		router.POST("/api/v1/tokens", requireScope(apitokens.ScopeAdmin, apiCreateTokenHandler))
+		router.DELETE("/api/v1/tokens/:id", requireScope(apitokens.ScopeAdmin, apiRevokeTokenHandler))
 	}
 	return router
 }
@@ -0,0 +1,643 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/modules/multisendjobs"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// pendingSendLifetime is how long a previewed send waits for confirmation.
+const pendingSendLifetime = 10 * time.Minute
+
+// pendingSendSweepFrequency is how often expired pending sends are dropped.
+const pendingSendSweepFrequency = time.Minute
+
+// errNoPendingSend is returned when a send is confirmed without a preview.
+var errNoPendingSend = errors.New("there is no transaction waiting for confirmation")
+
+type (
+	// PreviewOutput is an input, output or change output of a previewed send.
+	PreviewOutput struct {
+		FundType string           `json:"fund_type"`
+		Value    types.Currency   `json:"value"`
+		Address  types.UnlockHash `json:"address"`
+	}
+
+	// TransactionPreview describes a built but unsigned send.
+	TransactionPreview struct {
+		Inputs         []PreviewOutput `json:"inputs"`
+		Outputs        []PreviewOutput `json:"outputs"`
+		Change         []PreviewOutput `json:"change"`
+		MinerFee       types.Currency  `json:"miner_fee"`
+		FeePerByte     types.Currency  `json:"fee_per_byte"`
+		NewScpBalance  types.Currency  `json:"new_scp_balance"`
+		NewSpfaBalance types.Currency  `json:"new_spfa_balance"`
+		NewSpfbBalance types.Currency  `json:"new_spfb_balance"`
+		Expires        time.Time       `json:"expires"`
+	}
+
+	// apiConfirmSendParams are the parameters used to confirm a previewed send.
+	apiConfirmSendParams struct {
+		Password string `json:"password"`
+	}
+)
+
+// pendingSend is a previewed send that waits for confirmation. Each builder
+// holds the wallet outputs it funds until it is signed or dropped. A manual
+// send has a signer: it spends its inputs directly, returns its change to
+// changeAddress and is signed by the signer rather than by its builders.
+// inputValues holds the values of manual inputs the wallet does not own. The
+// builders of a multisend job pay the job parts listed in jobParts. A chunked
+// send has no builders; its parts are funded as they are broadcast. spends
+// lists the outputs the send spends once it waits on a session.
+type pendingSend struct {
+	walletName    string
+	builders      []modules.TransactionBuilder
+	fundTypes     []string
+	job           *multisendjobs.Job
+	jobDir        string
+	jobParts      []int
+	chunked       bool
+	signer        func(txn *types.Transaction) error
+	changeAddress types.UnlockHash
+	inputValues   map[types.OutputID]types.Currency
+	spends        []types.OutputID
+	summary       string
+	preview       TransactionPreview
+}
+
+// drop releases the outputs held by the pending send's builders.
+func (p *pendingSend) drop() {
+	for _, builder := range p.builders {
+		builder.Drop()
+	}
+}
+
+// add funds a transaction that pays the outputs of the coin type.
+func (p *pendingSend) add(wallet modules.Wallet, fundType string, coinOutputs []types.SiacoinOutput, fundOutputs []types.SiafundOutput, feePerByte types.Currency) error {
+	builder, err := buildBatchHelper(wallet, coinOutputs, fundOutputs, fundType == "SPF-B", feePerByte)
+	if err != nil {
+		return err
+	}
+	p.builders = append(p.builders, builder)
+	p.fundTypes = append(p.fundTypes, fundType)
+	return nil
+}
+
+// buildSendHelper funds one transaction for each kind of output, paying
+// feePerByte, without signing or broadcasting them.
+func buildSendHelper(wallet modules.Wallet, coinOutputs []types.SiacoinOutput, fundAOutputs []types.SiafundOutput, fundBOutputs []types.SiafundOutput, feePerByte types.Currency) (*pendingSend, error) {
+	p := &pendingSend{}
+	var err error
+	if len(coinOutputs) != 0 {
+		err = p.add(wallet, "SCP", coinOutputs, nil, feePerByte)
+	}
+	if err == nil && len(fundAOutputs) != 0 {
+		err = p.add(wallet, "SPF-A", nil, fundAOutputs, feePerByte)
+	}
+	if err == nil && len(fundBOutputs) != 0 {
+		err = p.add(wallet, "SPF-B", nil, fundBOutputs, feePerByte)
+	}
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	if err = p.finish(wallet, feePerByte); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// finish previews the funded send, dropping it when the preview fails.
+func (p *pendingSend) finish(wallet modules.Wallet, feePerByte types.Currency) (err error) {
+	p.preview, err = previewHelper(wallet, p)
+	if err != nil {
+		p.drop()
+		return err
+	}
+	p.preview.FeePerByte = feePerByte
+	return nil
+}
+
+// previewHelper lists the inputs, outputs, change and fee of the pending send
+// and the balances the wallet will have once it is confirmed.
+func previewHelper(wallet modules.Wallet, p *pendingSend) (TransactionPreview, error) {
+	preview := TransactionPreview{Expires: time.Now().Add(pendingSendLifetime)}
+	unspent, err := wallet.UnspentOutputs()
+	if err != nil {
+		return preview, err
+	}
+	values := make(map[types.OutputID]types.Currency)
+	for _, output := range unspent {
+		values[output.ID] = output.Value
+	}
+	for id, value := range p.inputValues {
+		values[id] = value
+	}
+	bals, _, err := confirmedBalanceHelper(wallet)
+	if err != nil {
+		return preview, err
+	}
+	spentScp := types.ZeroCurrency
+	spentSpfa := types.ZeroCurrency
+	spentSpfb := types.ZeroCurrency
+	for i, builder := range p.builders {
+		fundType := p.fundTypes[i]
+		txn, parents := builder.View()
+		if p.signer != nil {
+			// A manual send spends the chosen outputs directly and pays its
+			// change within the transaction itself.
+			for _, sci := range txn.SiacoinInputs {
+				preview.Inputs = append(preview.Inputs, PreviewOutput{"SCP", values[types.OutputID(sci.ParentID)], sci.UnlockConditions.UnlockHash()})
+			}
+			for _, sfi := range txn.SiafundInputs {
+				preview.Inputs = append(preview.Inputs, PreviewOutput{fundType, values[types.OutputID(sfi.ParentID)], sfi.UnlockConditions.UnlockHash()})
+			}
+		}
+		// The builder funds each transaction through parent transactions that
+		// spend wallet outputs into an exact output and an optional refund.
+		for _, parent := range parents {
+			for _, sci := range parent.SiacoinInputs {
+				preview.Inputs = append(preview.Inputs, PreviewOutput{"SCP", values[types.OutputID(sci.ParentID)], sci.UnlockConditions.UnlockHash()})
+			}
+			for _, sfi := range parent.SiafundInputs {
+				preview.Inputs = append(preview.Inputs, PreviewOutput{fundType, values[types.OutputID(sfi.ParentID)], sfi.UnlockConditions.UnlockHash()})
+			}
+			for j, sco := range parent.SiacoinOutputs {
+				if j > 0 {
+					preview.Change = append(preview.Change, PreviewOutput{"SCP", sco.Value, sco.UnlockHash})
+				}
+			}
+			for j, sfo := range parent.SiafundOutputs {
+				if j > 0 {
+					preview.Change = append(preview.Change, PreviewOutput{fundType, sfo.Value, sfo.UnlockHash})
+				}
+			}
+		}
+		for _, sco := range txn.SiacoinOutputs {
+			if p.signer != nil && sco.UnlockHash == p.changeAddress {
+				preview.Change = append(preview.Change, PreviewOutput{"SCP", sco.Value, sco.UnlockHash})
+				continue
+			}
+			preview.Outputs = append(preview.Outputs, PreviewOutput{"SCP", sco.Value, sco.UnlockHash})
+			spentScp = spentScp.Add(sco.Value)
+		}
+		for _, sfo := range txn.SiafundOutputs {
+			if p.signer != nil && sfo.UnlockHash == p.changeAddress {
+				preview.Change = append(preview.Change, PreviewOutput{fundType, sfo.Value, sfo.UnlockHash})
+				continue
+			}
+			preview.Outputs = append(preview.Outputs, PreviewOutput{fundType, sfo.Value, sfo.UnlockHash})
+			if fundType == "SPF-B" {
+				spentSpfb = spentSpfb.Add(sfo.Value)
+			} else {
+				spentSpfa = spentSpfa.Add(sfo.Value)
+			}
+		}
+		for _, fee := range txn.MinerFees {
+			preview.MinerFee = preview.MinerFee.Add(fee)
+		}
+	}
+	spentScp = spentScp.Add(preview.MinerFee)
+	if bals.CoinBalance.Cmp(spentScp) >= 0 {
+		preview.NewScpBalance = bals.CoinBalance.Sub(spentScp)
+	}
+	if bals.FundBalance.Cmp(spentSpfa) >= 0 {
+		preview.NewSpfaBalance = bals.FundBalance.Sub(spentSpfa)
+	}
+	if bals.FundbBalance.Cmp(spentSpfb) >= 0 {
+		preview.NewSpfbBalance = bals.FundbBalance.Sub(spentSpfb)
+	}
+	return preview, nil
+}
+
+// setPendingSend stores the pending send on the session, dropping any send
+// that was previously waiting for confirmation.
+func setPendingSend(p *pendingSend, sessionID string) {
+	var previous *pendingSend
+	p.spends = spentOutputsHelper(p.builders)
+	store.Update(sessionID, func(session *Session) {
+		previous = session.pendingSend
+		if p.walletName == "" {
+			p.walletName = session.name
+		}
+		session.pendingSend = p
+	})
+	if previous != nil {
+		previous.drop()
+	}
+}
+
+// takePendingSend removes the pending send from the session and returns it
+// when it belongs to the active wallet and has not expired.
+func takePendingSend(sessionID string) (*pendingSend, error) {
+	var p *pendingSend
+	var name string
+	store.Update(sessionID, func(session *Session) {
+		p = session.pendingSend
+		name = session.name
+		session.pendingSend = nil
+	})
+	if p == nil {
+		return nil, errNoPendingSend
+	}
+	if p.walletName != name {
+		p.drop()
+		return nil, errors.New("the transaction was built by another wallet")
+	}
+	if time.Now().After(p.preview.Expires) {
+		p.drop()
+		return nil, errors.New("the transaction preview has expired")
+	}
+	return p, nil
+}
+
+// dropPendingSend drops the send that is waiting for confirmation, if any.
+func dropPendingSend(sessionID string) {
+	var p *pendingSend
+	store.Update(sessionID, func(session *Session) {
+		p = session.pendingSend
+		session.pendingSend = nil
+	})
+	if p != nil {
+		p.drop()
+	}
+}
+
+// dropExpiredPendingSends drops the pending sends that expired without being
+// confirmed, releasing the outputs they hold.
+func dropExpiredPendingSends() {
+	now := time.Now()
+	for _, sessionID := range store.IDs() {
+		var p *pendingSend
+		store.Update(sessionID, func(session *Session) {
+			if session.pendingSend != nil && now.After(session.pendingSend.preview.Expires) {
+				p = session.pendingSend
+				session.pendingSend = nil
+			}
+		})
+		if p != nil {
+			p.drop()
+		}
+	}
+}
+
+// sweepExpiredPendingSends drops expired pending sends every time the
+// frequency elapses until the server stops.
+func sweepExpiredPendingSends(frequency time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			dropExpiredPendingSends()
+		}
+	}
+}
+
+// confirmSendHelper checks the password and then signs and broadcasts the
+// pending send, which it returns along with the broadcast transactions.
+func confirmSendHelper(wallet modules.Wallet, password string, sessionID string) (*pendingSend, []types.Transaction, error) {
+	p, err := takePendingSend(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	valid, err := isPasswordValid(wallet, password)
+	if err == nil && !valid {
+		err = errInvalidPassword
+	}
+	if err != nil {
+		// keep the send so the user can try the password again
+		store.Update(sessionID, func(session *Session) {
+			session.pendingSend = p
+		})
+		return nil, nil, err
+	}
+	txns, err := sendJobHelper(wallet, p, sessionID)
+	return p, txns, err
+}
+
+// spentOutputsHelper returns the outputs spent by the transactions of the
+// builders and by their parents.
+func spentOutputsHelper(builders []modules.TransactionBuilder) []types.OutputID {
+	var ids []types.OutputID
+	add := func(txn types.Transaction) {
+		for _, sci := range txn.SiacoinInputs {
+			ids = append(ids, types.OutputID(sci.ParentID))
+		}
+		for _, sfi := range txn.SiafundInputs {
+			ids = append(ids, types.OutputID(sfi.ParentID))
+		}
+	}
+	for _, builder := range builders {
+		txn, parents := builder.View()
+		for _, parent := range parents {
+			add(parent)
+		}
+		add(txn)
+	}
+	return ids
+}
+
+// checkInputsHelper fails when the send spends an output that a send waiting
+// for confirmation spends as well. The wallet does not hold the outputs a
+// manual send spends directly, so those must also still be unspent. The
+// transaction pool would otherwise reject the send as a double spend.
+func checkInputsHelper(wallet modules.Wallet, p *pendingSend) error {
+	pending := make(map[types.OutputID]bool)
+	for _, sessionID := range store.IDs() {
+		session, ok := store.Get(sessionID)
+		if !ok || session.pendingSend == nil || session.pendingSend == p {
+			continue
+		}
+		for _, id := range session.pendingSend.spends {
+			pending[id] = true
+		}
+	}
+	for _, id := range spentOutputsHelper(p.builders) {
+		if pending[id] {
+			return fmt.Errorf("output %v is spent by another send waiting for confirmation", id)
+		}
+	}
+	if p.signer == nil {
+		return nil
+	}
+	unspent, err := wallet.UnspentOutputs()
+	if err != nil {
+		return err
+	}
+	spendable := make(map[types.OutputID]bool)
+	for _, output := range unspent {
+		spendable[output.ID] = true
+	}
+	for _, id := range spentOutputsHelper(p.builders) {
+		if _, ok := p.inputValues[id]; !ok && !spendable[id] {
+			return fmt.Errorf("output %v was spent after the send was previewed", id)
+		}
+	}
+	return nil
+}
+
+// broadcastSendHelper signs every transaction of the send before any of them
+// is broadcast. The signed transactions are broadcast as a single set, which
+// the transaction pool accepts or rejects as a whole. A send too large for
+// one set is broadcast a transaction at a time, dropping the ones that remain
+// after a failure.
+func broadcastSendHelper(wallet modules.Wallet, p *pendingSend) ([]types.Transaction, error) {
+	err := p.checkJob()
+	if err == nil {
+		err = checkInputsHelper(wallet, p)
+	}
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	var sets [][]types.Transaction
+	var all []types.Transaction
+	for _, builder := range p.builders {
+		var txnSet []types.Transaction
+		if p.signer != nil {
+			txnSet, err = signManualHelper(builder, p.signer)
+		} else {
+			txnSet, err = builder.Sign(true)
+		}
+		if err != nil {
+			p.drop()
+			p.recordJob(0, len(p.builders), nil, err)
+			return nil, err
+		}
+		sets = append(sets, txnSet)
+		all = append(all, txnSet...)
+	}
+	// The signed transactions are recorded before they are broadcast so that
+	// a part whose broadcast is interrupted is never signed again.
+	if err = p.recordJob(0, len(sets), sets, nil); err != nil {
+		p.drop()
+		return nil, err
+	}
+	if len(sets) > 1 && transactionSetSize(all) <= modules.TransactionSetSizeLimit {
+		err = n.TransactionPool.AcceptTransactionSet(all)
+		if err != nil {
+			p.drop()
+			p.recordJob(0, len(sets), nil, err)
+			return nil, err
+		}
+		return all, p.recordJob(0, len(sets), nil, nil)
+	}
+	var txns []types.Transaction
+	var recordErr error
+	for i, txnSet := range sets {
+		err = n.TransactionPool.AcceptTransactionSet(txnSet)
+		if err != nil {
+			for _, remaining := range p.builders[i:] {
+				remaining.Drop()
+			}
+			p.recordJob(i, i+1, nil, err)
+			p.recordJob(i+1, len(sets), nil, errors.New("not broadcast because an earlier transaction failed"))
+			return txns, err
+		}
+		if err = p.recordJob(i, i+1, nil, nil); err != nil && recordErr == nil {
+			recordErr = err
+		}
+		txns = append(txns, txnSet...)
+	}
+	return txns, recordErr
+}
+
+// transactionSetSize returns the encoded size of the transaction set.
+func transactionSetSize(txns []types.Transaction) int {
+	size := 0
+	for _, txn := range txns {
+		size += txn.MarshalSiaSize()
+	}
+	return size
+}
+
+// signManualHelper signs the transaction of a manual send with the signer.
+// The builder does not sign inputs it did not fund itself.
+func signManualHelper(builder modules.TransactionBuilder, signer func(txn *types.Transaction) error) ([]types.Transaction, error) {
+	txn, parents := builder.View()
+	err := signer(&txn)
+	if err != nil {
+		return nil, err
+	}
+	builder.Drop()
+	return append(parents, txn), nil
+}
+
+// fmtPreviewValue formats the value in SCP or whole funds.
+func fmtPreviewValue(fundType string, value types.Currency) string {
+	if fundType != "SCP" {
+		return fmt.Sprintf("%s %s", value, fundType)
+	}
+	return NewExactCurrency(value).HumanString("SCP")
+}
+
+// previewRowsHelper returns the table rows of the preview outputs.
+func previewRowsHelper(label string, outputs []PreviewOutput) string {
+	rows := ""
+	for _, output := range outputs {
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n", label, fmtPreviewValue(output.FundType, output.Value), output.Address)
+	}
+	return rows
+}
+
+// sendPreviewFormHelper returns the confirmation form of the pending send
+// along with an optional message.
+func sendPreviewFormHelper(preview TransactionPreview, msg string) string {
+	rows := previewRowsHelper("Input", preview.Inputs)
+	rows += previewRowsHelper("Output", preview.Outputs)
+	rows += previewRowsHelper("Change", preview.Change)
+	form := resources.ConfirmSendForm()
+	form = strings.Replace(form, "&PREVIEW_MESSAGE;", msg, -1)
+	form = strings.Replace(form, "&PREVIEW_ROWS;", rows, -1)
+	form = strings.Replace(form, "&MINER_FEE;", fmtPreviewValue("SCP", preview.MinerFee), -1)
+	form = strings.Replace(form, "&FEE_PER_BYTE;", preview.FeePerByte.String(), -1)
+	form = strings.Replace(form, "&NEW_SCP_BALANCE;", fmtPreviewValue("SCP", preview.NewScpBalance), -1)
+	form = strings.Replace(form, "&NEW_SPFA_BALANCE;", fmtPreviewValue("SPF-A", preview.NewSpfaBalance), -1)
+	form = strings.Replace(form, "&NEW_SPFB_BALANCE;", fmtPreviewValue("SPF-B", preview.NewSpfbBalance), -1)
+	return form
+}
+
+// writeSendPreview writes the confirmation form of the pending send along with
+// an optional message.
+func writeSendPreview(w http.ResponseWriter, preview TransactionPreview, msg string, sessionID string) {
+	writeForm(w, "CONFIRM SEND", sendPreviewFormHelper(preview, msg), sessionID)
+}
+
+func confirmSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		dropPendingSend(sessionID)
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to send coins: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	p, _, err := confirmSendHelper(wallet, req.FormValue("password"), sessionID)
+	if errors.Is(err, errInvalidPassword) {
+		session, _ := store.Get(sessionID)
+		if session.pendingSend == nil {
+			writeError(w, msgPrefix+"Password is not valid.", sessionID)
+			return
+		}
+		writeSendPreview(w, session.pendingSend.preview, "Password is not valid.", sessionID)
+		return
+	} else if p != nil && p.chunked && err == nil {
+		title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
+		writeForm(w, title, resources.ScanningWalletForm(), sessionID)
+		return
+	} else if p != nil && p.job != nil {
+		writeMultisendJob(w, *p.job, err, sessionID)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	guiHandler(w, req, nil)
+}
+
+func apiPreviewSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to build transaction: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiSendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	coinOutputs, fundAOutputs, fundBOutputs, err := sendOutputsHelper(params.Amount, resolveDestination(sessionID, params.Destination), params.Unlock, params.CoinType)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	p, err := buildSendHelper(wallet, coinOutputs, fundAOutputs, fundBOutputs, feePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	setPendingSend(p, sessionID)
+	writeJSON(w, http.StatusOK, p.preview)
+}
+
+func apiPreviewMultisendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to build transaction: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiMultisendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	p, ok := apiMultisendJobHelper(w, sessionID, wallet, params, msgPrefix)
+	if !ok {
+		return
+	}
+	setPendingSend(p, sessionID)
+	writeJSON(w, http.StatusOK, p.preview)
+}
+
+func apiConfirmSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to send coins: "
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiConfirmSendParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	p, txns, err := confirmSendHelper(wallet, params.Password, sessionID)
+	if errors.Is(err, errInvalidPassword) {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if errors.Is(err, errNoPendingSend) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if p != nil && p.job != nil {
+		writeMultisendJobResult(w, p, txns, err, msgPrefix)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransactionIDs(txns))
+}
+
+func apiCancelSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	dropPendingSend(sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// inputsTestWallet is a wallet that only lists its unspent outputs.
+type inputsTestWallet struct {
+	modules.Wallet
+	unspent []modules.UnspentOutput
+}
+
+func (w *inputsTestWallet) UnspentOutputs() ([]modules.UnspentOutput, error) {
+	return w.unspent, nil
+}
+
+// manualTestSend returns a manual send that spends the outputs directly.
+func manualTestSend(ids ...types.OutputID) *pendingSend {
+	tb := &feeTestBuilder{}
+	for _, id := range ids {
+		tb.txn.SiacoinInputs = append(tb.txn.SiacoinInputs, types.SiacoinInput{ParentID: types.SiacoinOutputID(id)})
+	}
+	return &pendingSend{
+		builders: []modules.TransactionBuilder{tb},
+		signer:   func(*types.Transaction) error { return nil },
+	}
+}
+
+// TestCheckInputs checks that a send fails before it is broadcast when an
+// output it spends was spent since it was previewed or is spent by a send
+// waiting for confirmation in another session.
+func TestCheckInputs(t *testing.T) {
+	oldStore := store
+	store = newMemorySessionStore()
+	t.Cleanup(func() { store = oldStore })
+
+	x, y := types.OutputID{1}, types.OutputID{2}
+	w := &inputsTestWallet{unspent: []modules.UnspentOutput{{ID: x}, {ID: y}}}
+	p := manualTestSend(x)
+	if err := checkInputsHelper(w, p); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Add(&Session{id: "other"})
+	setPendingSend(manualTestSend(y, x), "other")
+	err := checkInputsHelper(w, p)
+	if err == nil || !strings.Contains(err.Error(), "another send waiting for confirmation") {
+		t.Fatalf("expected the send to conflict with the other session's send, got %v", err)
+	}
+	dropPendingSend("other")
+	if err := checkInputsHelper(w, p); err != nil {
+		t.Fatal(err)
+	}
+
+	w.unspent = w.unspent[1:]
+	err = checkInputsHelper(w, p)
+	if err == nil || !strings.Contains(err.Error(), "spent after the send was previewed") {
+		t.Fatalf("expected the spent output to be reported, got %v", err)
+	}
+}
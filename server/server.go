@@ -22,29 +22,47 @@ import (
 )
 
 var (
-	UI       lorca.UI
-	n        *node.Node
-	config   *wwConfig.WebWalletConfig
-	srv      *http.Server
-	status   string
-	sessions []*Session
-	waitCh   chan struct{}
+	UI     lorca.UI
+	n      *node.Node
+	config *wwConfig.WebWalletConfig
+	srv    *http.Server
+	store  SessionStore = newMemorySessionStore()
+	waitCh chan struct{}
 )
 
+// sessionSweepFrequency is how often idle sessions are checked for expiry.
+const sessionSweepFrequency = 30 * time.Second
+
 // Session is a struct that tracks session settings
 type Session struct {
-	id            string
-	alert         string
-	collapseMenu  bool
-	txHistoryPage int
-	cachedPage    string
-	wallet        modules.Wallet
-	name          string
+	id              string
+	alert           string
+	operation       Operation
+	collapseMenu    bool
+	txHistoryPage   int
+	txHistoryFilter string
+	displayUnit     string
+	cachedPage      string
+	wallet          modules.Wallet
+	name            string
+	wallets         []sessionWallet
+	pendingSend     *pendingSend
+	consolidation   *ConsolidationPlan
+	created         time.Time
+	lastActivity    time.Time
 }
 
 // StartHTTPServer starts the HTTP server to serve the GUI.
 func StartHTTPServer(webWalletConfig *wwConfig.WebWalletConfig) {
 	config = webWalletConfig
+	if webWalletConfig.PersistSessions {
+		fileStore, err := newFileSessionStore(webWalletConfig.Dir)
+		if err != nil {
+			fmt.Printf("Unable to load session preferences: %v\n", err)
+		} else {
+			store = fileStore
+		}
+	}
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	srv = &http.Server{Addr: fmt.Sprintf(":%d", webWalletConfig.Port), Handler: buildHTTPRoutes()}
@@ -60,6 +78,9 @@ func StartHTTPServer(webWalletConfig *wwConfig.WebWalletConfig) {
 		wg.Wait()
 		close(waitCh)
 	}()
+	go sweepExpiredTokens(webWalletConfig.CheckTokenExpirationFrequency, waitCh)
+	go sweepExpiredSessions(sessionSweepFrequency, waitCh)
+	go sweepExpiredPendingSends(pendingSendSweepFrequency, waitCh)
 }
 
 // IsRunning returns true when the server is running
@@ -84,6 +105,7 @@ func Wait() chan struct{} {
 // AttachNode attaches the node to the HTTP server.
 func AttachNode(node *node.Node) {
 	n = node
+	subscribeHistoryCaches()
 	if srv != nil {
 		srv.Handler = buildHTTPRoutes()
 	}
@@ -91,109 +113,160 @@ func AttachNode(node *node.Node) {
 
 // newWallet attaches a newly created wallet module to the session.
 func newWallet(walletDirName string, sessionID string) (modules.Wallet, error) {
-	loadStart := time.Now()
-	walletDeps := modules.ProdDependencies
-	fmt.Printf("Loading wallet...")
+	if err := validateWalletName(walletDirName); err != nil {
+		return nil, err
+	}
 	walletDir := filepath.Join(n.Dir, "wallets", walletDirName)
 	_, err := os.Stat(walletDir)
 	if err == nil {
 		return nil, fmt.Errorf("%s already exists", walletDirName)
 	}
-	cs := n.ConsensusSet
-	tp := n.TransactionPool
-	session, err := getSession(sessionID)
-	if err != nil {
-		return nil, err
-	}
-	if session.wallet != nil {
-		errors.New("session already has a wallet loaded")
-	}
-	w, err := wallet.NewCustomWallet(cs, tp, walletDir, walletDeps)
-	if err != nil {
-		return nil, err
+	return attachWallet(walletDirName, sessionID)
+}
+
+// discardNewWallet closes a wallet attached by newWallet that could not be set
+// up and removes its directory, so that the name can be used again. A session
+// that was added for the wallet is removed along with it.
+func discardNewWallet(walletDirName string, added bool, sessionID string) error {
+	var err error
+	if added {
+		err = discardSession(sessionID)
+	} else {
+		err = closeSessionWallet(walletDirName, sessionID)
 	}
-	session.wallet = w
-	session.name = walletDirName
-	fmt.Println(" done in", time.Since(loadStart).Seconds(), "seconds.")
-	return w, nil
+	return errors.Compose(err, os.RemoveAll(walletPath(walletDirName, false)))
 }
 
 // existingWallet attaches an existing wallet module to the session.
 func existingWallet(walletDirName string, sessionID string) (modules.Wallet, error) {
-	loadStart := time.Now()
-	walletDeps := modules.ProdDependencies
-	fmt.Printf("Loading wallet...")
+	if err := validateExistingWalletName(walletDirName); err != nil {
+		return nil, err
+	}
 	walletDir := filepath.Join(n.Dir, "wallets", walletDirName)
 	_, err := os.Stat(walletDir)
 	if checkErrors.Is(err, os.ErrNotExist) {
 		return nil, fmt.Errorf("%s does not exist", walletDirName)
 	}
-	cs := n.ConsensusSet
-	tp := n.TransactionPool
-	session, err := getSession(sessionID)
-	if err != nil {
-		return nil, err
+	return attachWallet(walletDirName, sessionID)
+}
+
+// attachWallet loads the wallet module, attaches it to the session and makes
+// it the session's active wallet.
+func attachWallet(walletDirName string, sessionID string) (modules.Wallet, error) {
+	loadStart := time.Now()
+	walletDeps := modules.ProdDependencies
+	walletDir := filepath.Join(n.Dir, "wallets", walletDirName)
+	if !sessionIDExists(sessionID) {
+		return nil, errSessionNotFound
 	}
-	if session.wallet != nil {
-		errors.New("session already has a wallet loaded")
+	if _, open := findOpenWallet(walletDirName); open {
+		return nil, fmt.Errorf("%s is already open", walletDirName)
 	}
-	w, err := wallet.NewCustomWallet(cs, tp, walletDir, walletDeps)
+	fmt.Printf("Loading wallet...")
+	w, err := wallet.NewCustomWallet(n.ConsensusSet, n.TransactionPool, walletDir, walletDeps)
 	if err != nil {
 		return nil, err
 	}
-	session.wallet = w
-	session.name = walletDirName
+	store.Update(sessionID, func(session *Session) {
+		wallets := make([]sessionWallet, 0, len(session.wallets)+1)
+		wallets = append(wallets, session.wallets...)
+		session.wallets = append(wallets, sessionWallet{name: walletDirName, wallet: w})
+		session.wallet = w
+		session.name = walletDirName
+	})
 	fmt.Println(" done in", time.Since(loadStart).Seconds(), "seconds.")
 	return w, nil
 }
 
-// closeWallet closes the wallet and detaches it from the node.
+// closeWallet closes every wallet of the session and detaches them from the node.
 func closeWallet(sessionID string) error {
+	dropPendingSend(sessionID)
+	var wallets []sessionWallet
+	found := store.Update(sessionID, func(session *Session) {
+		wallets = session.wallets
+		session.wallets = nil
+		session.wallet = nil
+		session.name = ""
+	})
+	if !found {
+		return errSessionNotFound
+	}
+	var err error
+	for _, sw := range wallets {
+		fmt.Println("Closing wallet...")
+		dropHistoryCache(sw.wallet)
+		err = errors.Compose(err, sw.wallet.Close())
+	}
+	return err
+}
+
+// closeActiveWallet closes the session's active wallet and makes the most
+// recently opened remaining wallet active.
+func closeActiveWallet(sessionID string) error {
 	session, err := getSession(sessionID)
 	if err != nil {
 		return err
 	}
-	wallet := session.wallet
-	if wallet != nil {
+	dropPendingSend(sessionID)
+	return closeSessionWallet(session.name, sessionID)
+}
+
+// closeSessionWallet closes the wallet of the session with the name. When it
+// is the active wallet the most recently opened remaining wallet becomes
+// active.
+func closeSessionWallet(walletDirName string, sessionID string) error {
+	var wallet modules.Wallet
+	found := store.Update(sessionID, func(session *Session) {
+		wallets := make([]sessionWallet, 0, len(session.wallets))
+		for _, sw := range session.wallets {
+			if sw.name == walletDirName {
+				wallet = sw.wallet
+			} else {
+				wallets = append(wallets, sw)
+			}
+		}
+		session.wallets = wallets
+		if session.name != walletDirName {
+			return
+		}
 		session.wallet = nil
 		session.name = ""
-		fmt.Println("Closing wallet...")
-		err = wallet.Close()
-		if err != nil {
-			return err
+		if len(wallets) > 0 {
+			session.wallet = wallets[len(wallets)-1].wallet
+			session.name = wallets[len(wallets)-1].name
 		}
+	})
+	if !found {
+		return errSessionNotFound
+	}
+	if wallet != nil {
+		fmt.Println("Closing wallet...")
+		dropHistoryCache(wallet)
+		return wallet.Close()
 	}
 	return nil
 }
 
 // CloseAllWallets closes all wallets and detaches them from the node.
 func CloseAllWallets() (err error) {
-	for _, session := range sessions {
-		wallet := session.wallet
-		if wallet != nil {
-			session.wallet = nil
-			session.name = ""
-			fmt.Println("Closing wallet...")
-			err = errors.Compose(wallet.Close())
-		}
+	for _, sessionID := range store.IDs() {
+		err = errors.Compose(err, closeWallet(sessionID))
 	}
 	return err
 }
 
 func getWallet(sessionID string) (modules.Wallet, error) {
-	session, err := getSession(sessionID)
-	if err != nil {
-		return nil, err
+	session, ok := store.Get(sessionID)
+	if !ok {
+		return nil, errSessionNotFound
 	} else if session.wallet == nil {
 		return nil, errors.New("no wallet is attached to the session")
 	}
 	return session.wallet, nil
 }
 
-// setStatus sets the status.
-func setStatus(s string) {
-	status = s
-}
+// errSessionNotFound is returned when a session ID is not in the store.
+var errSessionNotFound = errors.New("session ID was not found")
 
 // addSessionId adds a new session ID to memory.
 func addSessionID() string {
@@ -204,76 +277,70 @@ func addSessionID() string {
 	session.collapseMenu = true
 	session.txHistoryPage = 1
 	session.cachedPage = ""
-	sessions = append(sessions, session)
+	session.created = time.Now()
+	session.lastActivity = session.created
+	store.Add(session)
 	return session.id
 }
 
-// getSession returns the session.
-func getSession(sessionID string) (*Session, error) {
-	for _, session := range sessions {
-		if session.id == sessionID {
-			return session, nil
-		}
+// getSession returns a copy of the session.
+func getSession(sessionID string) (Session, error) {
+	session, ok := store.Get(sessionID)
+	if !ok {
+		return Session{}, errSessionNotFound
 	}
-	return nil, errors.New("session ID was not found")
+	return session, nil
 }
 
 // sessionIDExists returns true when the supplied session ID exists in memory.
 func sessionIDExists(sessionID string) bool {
-	session, _ := getSession(sessionID)
-	return session != nil
+	_, ok := store.Get(sessionID)
+	return ok
 }
 
 // setAlert sets an alert on the session.
 func setAlert(alert string, sessionID string) {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	store.Update(sessionID, func(session *Session) {
 		session.alert = alert
-	}
+	})
 }
 
 // hasAlert returns true when the session has an alert.
 func hasAlert(sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
-		return session.alert != ""
-	}
-	return false
+	session, _ := store.Get(sessionID)
+	return session.alert != ""
 }
 
 // popAlert gets the alert from the session and then clears it from the session.
 func popAlert(sessionID string) string {
-	session, _ := getSession(sessionID)
-	if session != nil {
-		alert := session.alert
+	var alert string
+	store.Update(sessionID, func(session *Session) {
+		alert = session.alert
 		session.alert = ""
-		return alert
-	}
-	return ""
+	})
+	return alert
 }
 
 // collapseMenu sets the menu state to collapsed and returns true
 func collapseMenu(sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	store.Update(sessionID, func(session *Session) {
 		session.collapseMenu = true
-	}
+	})
 	return true
 }
 
 // expandMenu sets the menu state to expanded and returns true
 func expandMenu(sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	store.Update(sessionID, func(session *Session) {
 		session.collapseMenu = false
-	}
+	})
 	return true
 }
 
 // menuIsCollapsed returns true when the menu state is collapsed
 func menuIsCollapsed(sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	session, ok := store.Get(sessionID)
+	if ok {
 		return session.collapseMenu
 	}
 	// default to the menu being expanded just in case
@@ -282,17 +349,49 @@ func menuIsCollapsed(sessionID string) bool {
 
 // setTxHistoryPage sets the session's transaction history page and returns true.
 func setTxHistoryPage(txHistoryPage int, sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	store.Update(sessionID, func(session *Session) {
 		session.txHistoryPage = txHistoryPage
-	}
+	})
+	return true
+}
+
+// setTxHistoryFilter sets the session's encoded transaction history filter
+// and returns true.
+func setTxHistoryFilter(txHistoryFilter string, sessionID string) bool {
+	store.Update(sessionID, func(session *Session) {
+		session.txHistoryFilter = txHistoryFilter
+	})
+	return true
+}
+
+// getTxHistoryFilter returns the session's encoded transaction history filter.
+func getTxHistoryFilter(sessionID string) string {
+	session, _ := store.Get(sessionID)
+	return session.txHistoryFilter
+}
+
+// setDisplayUnit sets the unit the session displays SCP amounts in and
+// returns true.
+func setDisplayUnit(displayUnit string, sessionID string) bool {
+	store.Update(sessionID, func(session *Session) {
+		session.displayUnit = displayUnit
+	})
 	return true
 }
 
+// getDisplayUnit returns the unit the session displays SCP amounts in.
+func getDisplayUnit(sessionID string) string {
+	session, ok := store.Get(sessionID)
+	if !ok || session.displayUnit == "" {
+		return "SCP"
+	}
+	return session.displayUnit
+}
+
 // getTxHistoryPage returns the session's transaction history page or -1 when no session is found.
 func getTxHistoryPage(sessionID string) int {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	session, ok := store.Get(sessionID)
+	if ok {
 		return session.txHistoryPage
 	}
 	return -1
@@ -300,18 +399,99 @@ func getTxHistoryPage(sessionID string) int {
 
 // cachedPage caches the page without the menu and returns true.
 func cachedPage(cachedPage string, sessionID string) bool {
-	session, _ := getSession(sessionID)
-	if session != nil {
+	store.Update(sessionID, func(session *Session) {
 		session.cachedPage = cachedPage
-	}
+	})
 	return true
 }
 
 // getCachedPage returns the session's cached page.
 func getCachedPage(sessionID string) string {
-	session, _ := getSession(sessionID)
-	if session != nil {
-		return session.cachedPage
+	session, _ := store.Get(sessionID)
+	return session.cachedPage
+}
+
+// touchSession records activity on the session, postponing its expiry.
+func touchSession(sessionID string) {
+	store.Update(sessionID, func(session *Session) {
+		session.lastActivity = time.Now()
+	})
+}
+
+// sessionExpiresIn returns the time left before the session expires or -1
+// when sessions do not expire.
+func sessionExpiresIn(sessionID string) time.Duration {
+	if config == nil || config.SessionIdleTimeout <= 0 {
+		return -1
+	}
+	session, ok := store.Get(sessionID)
+	if !ok {
+		return 0
+	}
+	remaining := config.SessionIdleTimeout - time.Since(session.lastActivity)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// expireSession locks and closes the session's wallets and then removes the
+// session from memory.
+func expireSession(sessionID string) error {
+	session, _ := store.Get(sessionID)
+	var err error
+	for _, sw := range session.wallets {
+		unlocked, unlockedErr := sw.wallet.Unlocked()
+		if unlockedErr == nil && unlocked {
+			err = errors.Compose(err, sw.wallet.Lock())
+		}
+	}
+	err = errors.Compose(err, closeWallet(sessionID))
+	removeSession(sessionID)
+	return err
+}
+
+// removeSession drops the session's pending send, releasing the outputs it
+// holds, and removes the session from memory.
+func removeSession(sessionID string) {
+	dropPendingSend(sessionID)
+	store.Remove(sessionID)
+}
+
+// discardSession closes the session's wallets and removes the session from
+// memory. It undoes a session that was added for a wallet that then failed to
+// unlock, so that the session ID is never handed out.
+func discardSession(sessionID string) error {
+	err := closeWallet(sessionID)
+	removeSession(sessionID)
+	return err
+}
+
+// sweepExpiredSessions periodically expires sessions that have been idle for
+// longer than the configured session idle timeout. Sessions running an
+// operation, such as a restore or a chunked multisend, are never expired so
+// that the operation is not cut off halfway.
+func sweepExpiredSessions(frequency time.Duration, stop chan struct{}) {
+	if config == nil || config.SessionIdleTimeout <= 0 || frequency <= 0 {
+		return
+	}
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, sessionID := range store.IDs() {
+			session, ok := store.Get(sessionID)
+			if !ok || session.operation.Running || time.Since(session.lastActivity) <= config.SessionIdleTimeout {
+				continue
+			}
+			fmt.Println("Session expired, locking wallet...")
+			if err := expireSession(sessionID); err != nil {
+				fmt.Printf("Unable to expire session: %v\n", err)
+			}
+		}
 	}
-	return ""
 }
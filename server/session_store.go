@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SessionsFile is the file that persisted session preferences are saved to.
+const SessionsFile = "sessions.json"
+
+// SessionStore stores the sessions of the web wallet.
+type SessionStore interface {
+	// Add stores the session.
+	Add(session *Session)
+	// Get returns a copy of the session with the supplied ID.
+	Get(id string) (Session, bool)
+	// Update calls fn with the session while holding the store's lock.
+	Update(id string, fn func(*Session)) bool
+	// Remove deletes the session with the supplied ID.
+	Remove(id string)
+	// IDs returns the IDs of every stored session.
+	IDs() []string
+}
+
+// memorySessionStore is an in-memory SessionStore.
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// newMemorySessionStore returns an empty in-memory session store.
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]*Session)}
+}
+
+// Add stores the session.
+func (s *memorySessionStore) Add(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.id] = session
+}
+
+// Get returns a copy of the session with the supplied ID.
+func (s *memorySessionStore) Get(id string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return *session, true
+}
+
+// Update calls fn with the session while holding the store's lock.
+func (s *memorySessionStore) Update(id string, fn func(*Session)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+	fn(session)
+	return true
+}
+
+// Remove deletes the session with the supplied ID.
+func (s *memorySessionStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// IDs returns the IDs of every stored session.
+func (s *memorySessionStore) IDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sessionPreferences are the GUI preferences that survive a restart.
+type sessionPreferences struct {
+	CollapseMenu    bool   `json:"collapse_menu"`
+	TxHistoryPage   int    `json:"tx_history_page"`
+	TxHistoryFilter string `json:"tx_history_filter,omitempty"`
+	DisplayUnit     string `json:"display_unit,omitempty"`
+}
+
+// fileSessionStore is a SessionStore that persists the GUI preferences of
+// every session with an attached wallet, keyed by wallet name.
+type fileSessionStore struct {
+	*memorySessionStore
+	path        string
+	preferences map[string]sessionPreferences
+}
+
+// newFileSessionStore returns a session store that persists preferences to
+// the sessions file in dir.
+func newFileSessionStore(dir string) (*fileSessionStore, error) {
+	s := &fileSessionStore{
+		memorySessionStore: newMemorySessionStore(),
+		path:               filepath.Join(dir, SessionsFile),
+		preferences:        make(map[string]sessionPreferences),
+	}
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.preferences); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", s.path, err)
+	}
+	return s, nil
+}
+
+// Update calls fn with the session while holding the store's lock. Stored
+// preferences are applied when a wallet is attached to the session and saved
+// whenever they change.
+func (s *fileSessionStore) Update(id string, fn func(*Session)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+	name := session.name
+	fn(session)
+	if session.name == "" {
+		return true
+	}
+	prefs, ok := s.preferences[session.name]
+	if ok && name != session.name {
+		session.collapseMenu = prefs.CollapseMenu
+		session.txHistoryPage = prefs.TxHistoryPage
+		session.txHistoryFilter = prefs.TxHistoryFilter
+		session.displayUnit = prefs.DisplayUnit
+		return true
+	}
+	current := sessionPreferences{CollapseMenu: session.collapseMenu, TxHistoryPage: session.txHistoryPage, TxHistoryFilter: session.txHistoryFilter, DisplayUnit: session.displayUnit}
+	if ok && prefs == current {
+		return true
+	}
+	s.preferences[session.name] = current
+	if err := s.save(); err != nil {
+		fmt.Printf("Unable to save session preferences: %v\n", err)
+	}
+	return true
+}
+
+// save writes the preferences to disk. The caller must hold the lock.
+func (s *fileSessionStore) save() error {
+	b, err := json.MarshalIndent(s.preferences, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
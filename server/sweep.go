@@ -0,0 +1,461 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+	walletutil "gitlab.com/scpcorp/webwallet/utils/wallet"
+)
+
+// OperationSweeping is the operation type of a seed sweep.
+const OperationSweeping = "Sweeping"
+
+// Limits on the number of addresses a sweep scans.
+const (
+	defaultSweepAddresses = 100
+	maxSweepAddresses     = 10000
+)
+
+// apiSweepParams are the parameters used to sweep an external seed.
+type apiSweepParams struct {
+	Seed       string `json:"seed"`
+	Addresses  int    `json:"addresses"`
+	FeeLevel   string `json:"fee_level"`
+	FeePerByte string `json:"fee_per_byte"`
+}
+
+// sweepScanner collects the unspent outputs of a set of addresses while it
+// is subscribed to the consensus set. The consensus set calls it while
+// holding its lock, so its progress is measured against a targetHeight read
+// before it subscribes.
+type sweepScanner struct {
+	keys           map[types.UnlockHash]walletutil.SpendableKey
+	siacoinOutputs map[types.SiacoinOutputID]types.SiacoinOutput
+	siafundOutputs map[types.SiafundOutputID]types.SiafundOutput
+	scannedHeight  types.BlockHeight
+	targetHeight   types.BlockHeight
+	sessionID      string
+}
+
+// newSweepScanner derives the first count addresses of the seed.
+func newSweepScanner(seed modules.Seed, count int, sessionID string) *sweepScanner {
+	s := &sweepScanner{
+		keys:           make(map[types.UnlockHash]walletutil.SpendableKey),
+		siacoinOutputs: make(map[types.SiacoinOutputID]types.SiacoinOutput),
+		siafundOutputs: make(map[types.SiafundOutputID]types.SiafundOutput),
+		sessionID:      sessionID,
+	}
+	for i := 0; i < count; i++ {
+		key := walletutil.GetAddress(walletutil.Seed(seed), uint64(i))
+		s.keys[key.UnlockConditions.UnlockHash()] = key
+	}
+	return s
+}
+
+// ProcessConsensusChange tracks the outputs created and spent at the
+// scanner's addresses.
+func (s *sweepScanner) ProcessConsensusChange(cc modules.ConsensusChange) {
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if _, exists := s.keys[diff.SiacoinOutput.UnlockHash]; !exists {
+			continue
+		}
+		if diff.Direction == modules.DiffApply {
+			s.siacoinOutputs[diff.ID] = diff.SiacoinOutput
+		} else {
+			delete(s.siacoinOutputs, diff.ID)
+		}
+	}
+	for _, diff := range cc.SiafundOutputDiffs {
+		if _, exists := s.keys[diff.SiafundOutput.UnlockHash]; !exists {
+			continue
+		}
+		if diff.Direction == modules.DiffApply {
+			s.siafundOutputs[diff.ID] = diff.SiafundOutput
+		} else {
+			delete(s.siafundOutputs, diff.ID)
+		}
+	}
+	s.scannedHeight += types.BlockHeight(len(cc.AppliedBlocks)) - types.BlockHeight(len(cc.RevertedBlocks))
+	if s.targetHeight > 0 {
+		progress := float64(s.scannedHeight) / float64(s.targetHeight)
+		if progress > 1 {
+			progress = 1
+		}
+		setOperationProgress(OperationSweeping, progress, s.sessionID)
+	}
+}
+
+// signer signs the inputs owned by the scanned seed with the derived keys and
+// the remaining inputs with the wallet's keys.
+func (s *sweepScanner) signer(wallet modules.Wallet) func(txn *types.Transaction) error {
+	return func(txn *types.Transaction) error {
+		owners := make(map[crypto.Hash]types.UnlockHash)
+		for _, sci := range txn.SiacoinInputs {
+			owners[crypto.Hash(sci.ParentID)] = sci.UnlockConditions.UnlockHash()
+		}
+		for _, sfi := range txn.SiafundInputs {
+			owners[crypto.Hash(sfi.ParentID)] = sfi.UnlockConditions.UnlockHash()
+		}
+		walletutil.SignTransaction(txn, s.keys, owners, n.ConsensusSet.Height())
+		var walletInputs []crypto.Hash
+		for _, sig := range txn.TransactionSignatures {
+			if len(sig.Signature) == 0 {
+				walletInputs = append(walletInputs, sig.ParentID)
+			}
+		}
+		if len(walletInputs) == 0 {
+			return nil
+		}
+		return wallet.SignTransaction(txn, walletInputs)
+	}
+}
+
+// addManualInput adds an input of the output together with an empty signature
+// that is filled in when the send is confirmed.
+func addManualInput(builder modules.TransactionBuilder, id types.OutputID, uc types.UnlockConditions, fund bool, claimAddress types.UnlockHash) {
+	if fund {
+		builder.AddSiafundInput(types.SiafundInput{ParentID: types.SiafundOutputID(id), UnlockConditions: uc, ClaimUnlockHash: claimAddress})
+	} else {
+		builder.AddSiacoinInput(types.SiacoinInput{ParentID: types.SiacoinOutputID(id), UnlockConditions: uc})
+	}
+	builder.AddTransactionSignature(types.TransactionSignature{
+		ParentID:       crypto.Hash(id),
+		CoveredFields:  types.CoveredFields{WholeTransaction: true},
+		PublicKeyIndex: 0,
+	})
+}
+
+// buildSweepTxnHelper builds a transaction that moves the coins and the funds
+// to the destination. When the coins do not cover the miner fee the wallet's
+// own SCP outputs pay the rest and their change returns to changeAddress.
+// Wallet outputs in used were already spent by another transaction of the
+// sweep and are skipped; the outputs this transaction spends are added to it.
+func buildSweepTxnHelper(wallet modules.Wallet, s *sweepScanner, coinIDs []types.SiacoinOutputID, fundIDs []types.SiafundOutputID, destination types.UnlockHash, changeAddress types.UnlockHash, feePerByte types.Currency, used map[types.OutputID]bool) (modules.TransactionBuilder, types.Currency, error) {
+	builder, err := wallet.StartTransaction()
+	if err != nil {
+		return nil, types.ZeroCurrency, err
+	}
+	coins := types.ZeroCurrency
+	for _, id := range coinIDs {
+		sco := s.siacoinOutputs[id]
+		addManualInput(builder, types.OutputID(id), s.keys[sco.UnlockHash].UnlockConditions, false, destination)
+		coins = coins.Add(sco.Value)
+	}
+	funds := types.ZeroCurrency
+	for _, id := range fundIDs {
+		sfo := s.siafundOutputs[id]
+		addManualInput(builder, types.OutputID(id), s.keys[sfo.UnlockHash].UnlockConditions, true, destination)
+		funds = funds.Add(sfo.Value)
+	}
+	inputs := len(coinIDs) + len(fundIDs)
+	fee := feePerByte.Mul64(manualTxnSize(inputs, 2))
+	if coins.Cmp(fee) <= 0 {
+		// Pay the fee from the wallet's largest spendable SCP outputs.
+		spendable, err := spendableOutputsHelper(wallet)
+		if err != nil {
+			builder.Drop()
+			return nil, types.ZeroCurrency, err
+		}
+		for _, output := range spendable {
+			if coins.Cmp(fee) > 0 {
+				break
+			}
+			if output.FundType != "SCP" || used[output.ID] {
+				continue
+			}
+			uc, err := wallet.UnlockConditions(output.Address)
+			if err != nil {
+				builder.Drop()
+				return nil, types.ZeroCurrency, err
+			}
+			addManualInput(builder, output.ID, uc, false, changeAddress)
+			used[output.ID] = true
+			coins = coins.Add(output.Value)
+			inputs++
+			fee = feePerByte.Mul64(manualTxnSize(inputs, 2))
+		}
+		if coins.Cmp(fee) <= 0 {
+			builder.Drop()
+			return nil, types.ZeroCurrency, fmt.Errorf("not enough SCP to pay the miner fee of %s", fmtPreviewValue("SCP", fee))
+		}
+		builder.AddSiacoinOutput(types.SiacoinOutput{Value: coins.Sub(fee), UnlockHash: changeAddress})
+	} else {
+		builder.AddSiacoinOutput(types.SiacoinOutput{Value: coins.Sub(fee), UnlockHash: destination})
+	}
+	if !funds.IsZero() {
+		builder.AddSiafundOutput(types.SiafundOutput{Value: funds, UnlockHash: destination})
+	}
+	builder.AddMinerFee(fee)
+	return builder, fee, nil
+}
+
+// buildSweepHelper builds the sweep of everything the scanner found into a
+// fresh address of the wallet. SPF-A and SPF-B cannot share a transaction, so
+// a seed that holds both is swept by a second transaction for its SPF-B.
+func buildSweepHelper(wallet modules.Wallet, s *sweepScanner, feePerByte types.Currency) (*pendingSend, error) {
+	var coinIDs []types.SiacoinOutputID
+	coins := types.ZeroCurrency
+	inputFee := feePerByte.Mul64(txnInputSize)
+	for id, sco := range s.siacoinOutputs {
+		// Outputs worth less than the fee of spending them are left behind.
+		if sco.Value.Cmp(inputFee) > 0 {
+			coinIDs = append(coinIDs, id)
+			coins = coins.Add(sco.Value)
+		}
+	}
+	var fundAIDs, fundBIDs []types.SiafundOutputID
+	fundsA := types.ZeroCurrency
+	fundsB := types.ZeroCurrency
+	for id, sfo := range s.siafundOutputs {
+		isB, err := n.ConsensusSet.IsSiafundBOutput(id)
+		if err != nil {
+			return nil, err
+		}
+		if isB {
+			fundBIDs = append(fundBIDs, id)
+			fundsB = fundsB.Add(sfo.Value)
+		} else {
+			fundAIDs = append(fundAIDs, id)
+			fundsA = fundsA.Add(sfo.Value)
+		}
+	}
+	if len(coinIDs) == 0 && len(fundAIDs) == 0 && len(fundBIDs) == 0 {
+		return nil, fmt.Errorf("no outputs worth sweeping were found at the first %d addresses of the seed", len(s.keys))
+	}
+	// Sort the inputs so the transaction does not depend on map order.
+	sort.Slice(coinIDs, func(i, j int) bool { return coinIDs[i].String() < coinIDs[j].String() })
+	sort.Slice(fundAIDs, func(i, j int) bool { return fundAIDs[i].String() < fundAIDs[j].String() })
+	sort.Slice(fundBIDs, func(i, j int) bool { return fundBIDs[i].String() < fundBIDs[j].String() })
+	destination, err := wallet.NextAddress()
+	if err != nil {
+		return nil, err
+	}
+	change, err := wallet.NextAddress()
+	if err != nil {
+		return nil, err
+	}
+	p := &pendingSend{
+		signer:        s.signer(wallet),
+		changeAddress: change.UnlockHash(),
+		inputValues:   make(map[types.OutputID]types.Currency),
+	}
+	for id, sco := range s.siacoinOutputs {
+		p.inputValues[types.OutputID(id)] = sco.Value
+	}
+	for id, sfo := range s.siafundOutputs {
+		p.inputValues[types.OutputID(id)] = sfo.Value
+	}
+	used := make(map[types.OutputID]bool)
+	add := func(fundType string, coinIDs []types.SiacoinOutputID, fundIDs []types.SiafundOutputID) (types.Currency, error) {
+		builder, fee, err := buildSweepTxnHelper(wallet, s, coinIDs, fundIDs, destination.UnlockHash(), p.changeAddress, feePerByte, used)
+		if err != nil {
+			return types.ZeroCurrency, err
+		}
+		p.builders = append(p.builders, builder)
+		p.fundTypes = append(p.fundTypes, fundType)
+		return fee, nil
+	}
+	var fee types.Currency
+	switch {
+	case len(fundAIDs) != 0:
+		fee, err = add("SPF-A", coinIDs, fundAIDs)
+		if err == nil && len(fundBIDs) != 0 {
+			var feeB types.Currency
+			feeB, err = add("SPF-B", nil, fundBIDs)
+			fee = fee.Add(feeB)
+		}
+	case len(fundBIDs) != 0:
+		fee, err = add("SPF-B", coinIDs, fundBIDs)
+	default:
+		fee, err = add("SCP", coinIDs, nil)
+	}
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	p.preview, err = previewHelper(wallet, p)
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	p.preview.FeePerByte = feePerByte
+	// The sweep pays the wallet, so its balances grow by what was found.
+	bals, _, err := confirmedBalanceHelper(wallet)
+	if err != nil {
+		p.drop()
+		return nil, err
+	}
+	newScp := bals.CoinBalance.Add(coins)
+	if newScp.Cmp(fee) >= 0 {
+		newScp = newScp.Sub(fee)
+	}
+	p.preview.NewScpBalance = newScp
+	p.preview.NewSpfaBalance = bals.FundBalance.Add(fundsA)
+	p.preview.NewSpfbBalance = bals.FundbBalance.Add(fundsB)
+	p.summary = fmt.Sprintf("Found %s, %s and %s in %d outputs at the first %d addresses of the seed.", fmtPreviewValue("SCP", coins), fmtPreviewValue("SPF-A", fundsA), fmtPreviewValue("SPF-B", fundsB), len(coinIDs)+len(fundAIDs)+len(fundBIDs), len(s.keys))
+	return p, nil
+}
+
+// startSweepHelper validates the seed the same way a restore does and starts
+// scanning its first addresses in the background.
+func startSweepHelper(wallet modules.Wallet, seedStr string, addresses int, feeLevel string, customFee string, sessionID string) error {
+	if seedStr == "" {
+		return errors.New("a seed must be provided")
+	}
+	_, seeds := encryptionKeys(seedStr)
+	if len(seeds) == 0 {
+		return errors.New("seed is not valid")
+	}
+	if addresses == 0 {
+		addresses = defaultSweepAddresses
+	}
+	if addresses < 1 || addresses > maxSweepAddresses {
+		return fmt.Errorf("the number of addresses must be between 1 and %d", maxSweepAddresses)
+	}
+	feePerByte, err := feePerByteHelper(feeLevel, customFee)
+	if err != nil {
+		return err
+	}
+	if !n.ConsensusSet.Synced() {
+		return errors.New("cannot sweep a seed until fully synced")
+	}
+	unlocked, err := wallet.Unlocked()
+	if err != nil {
+		return err
+	}
+	if !unlocked {
+		return modules.ErrLockedWallet
+	}
+	if operationRunning(sessionID) {
+		return errors.New("another operation is running")
+	}
+	session, _ := store.Get(sessionID)
+	startOperation(OperationSweeping, sessionID)
+	go sweepHelper(wallet, session.name, newSweepScanner(seeds[0], addresses, sessionID), feePerByte, sessionID)
+	return nil
+}
+
+// sweepHelper scans the blockchain for the seed's outputs and leaves the
+// sweep waiting for confirmation on the session.
+func sweepHelper(wallet modules.Wallet, walletName string, s *sweepScanner, feePerByte types.Currency, sessionID string) {
+	msgPrefix := "Unable to sweep seed: "
+	s.targetHeight = n.ConsensusSet.Height()
+	err := n.ConsensusSet.ConsensusSetSubscribe(s, modules.ConsensusChangeBeginning, nil)
+	if err != nil {
+		setAlert(fmt.Sprintf("%s%v", msgPrefix, err), sessionID)
+		finishOperation(OperationSweeping, err, sessionID)
+		return
+	}
+	n.ConsensusSet.Unsubscribe(s)
+	p, err := buildSweepHelper(wallet, s, feePerByte)
+	if err != nil {
+		setAlert(fmt.Sprintf("%s%v", msgPrefix, err), sessionID)
+		finishOperation(OperationSweeping, err, sessionID)
+		return
+	}
+	p.walletName = walletName
+	setPendingSend(p, sessionID)
+	finishOperation(OperationSweeping, nil, sessionID)
+}
+
+// sweptPendingSend returns the sweep waiting for confirmation once the
+// session's sweep operation has finished.
+func sweptPendingSend(sessionID string) (*pendingSend, bool) {
+	session, _ := store.Get(sessionID)
+	if session.operation.Type != OperationSweeping || session.operation.Running || session.pendingSend == nil {
+		return nil, false
+	}
+	return session.pendingSend, true
+}
+
+func sweepSeedFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if watchOnlySession(sessionID) {
+		msg := fmt.Sprintf("Unable to sweep seed: %v", errWatchOnly)
+		writeError(w, msg, sessionID)
+		return
+	}
+	form := resources.SweepSeedForm()
+	form = strings.Replace(form, "&FEE_OPTIONS;", feeOptionsHelper(), -1)
+	form = strings.Replace(form, "&SWEEP_ADDRESSES;", strconv.Itoa(defaultSweepAddresses), -1)
+	writeForm(w, "SWEEP SEED", form, sessionID)
+}
+
+func sweepSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to sweep seed: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	addresses, err := strconv.Atoi(req.FormValue("addresses"))
+	if err != nil {
+		msg := msgPrefix + "The number of addresses is not valid."
+		writeError(w, msg, sessionID)
+		return
+	}
+	err = startSweepHelper(wallet, req.FormValue("seed_str"), addresses, req.FormValue("fee_level"), req.FormValue("fee_per_byte"), sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
+	form := resources.ScanningWalletForm()
+	writeForm(w, title, form, sessionID)
+}
+
+func apiSweepSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiSweepParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	err := startSweepHelper(wallet, params.Seed, params.Addresses, params.FeeLevel, params.FeePerByte, sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to sweep seed: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, operationHelper(sessionID))
+}
+
+func apiPendingSendHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	session, _ := store.Get(sessionID)
+	if session.pendingSend == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unable to retrieve the transaction: %v", errNoPendingSend))
+		return
+	}
+	writeJSON(w, http.StatusOK, session.pendingSend.preview)
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	walletutil "gitlab.com/scpcorp/webwallet/utils/wallet"
+)
+
+// unlockDateLayouts are the layouts an unlock date can be written in.
+var unlockDateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+type (
+	// APITimelockedAddress is a watched address whose outputs cannot be spent
+	// before its unlock height.
+	APITimelockedAddress struct {
+		Address          types.UnlockHash       `json:"address"`
+		UnlockHeight     types.BlockHeight      `json:"unlock_height"`
+		Unlocked         bool                   `json:"unlocked"`
+		UnlockConditions types.UnlockConditions `json:"unlock_conditions"`
+	}
+
+	// APITimelockedAddresses lists the wallet's timelocked addresses.
+	APITimelockedAddresses struct {
+		Addresses []APITimelockedAddress `json:"addresses"`
+	}
+
+	// apiTimelockParams describe a timelocked address. Unlock is a block
+	// height or a date. PublicKey is one of the wallet's public keys that was
+	// shared with a sender, or empty for a new one.
+	apiTimelockParams struct {
+		PublicKey string `json:"public_key"`
+		Unlock    string `json:"unlock"`
+	}
+
+	// apiClaimParams are the fee parameters used to claim unlocked outputs.
+	apiClaimParams struct {
+		FeeLevel   string `json:"fee_level"`
+		FeePerByte string `json:"fee_per_byte"`
+	}
+)
+
+// unlockHeightHelper reads an unlock block height or an unlock date, which is
+// converted to the block height expected at that time. An empty string is no
+// timelock and returns zero.
+func unlockHeightHelper(unlock string) (types.BlockHeight, error) {
+	unlock = strings.TrimSpace(unlock)
+	if unlock == "" {
+		return 0, nil
+	}
+	if height, err := strconv.ParseUint(unlock, 10, 64); err == nil {
+		return types.BlockHeight(height), nil
+	}
+	for _, layout := range unlockDateLayouts {
+		date, err := time.ParseInLocation(layout, unlock, time.Local)
+		if err != nil {
+			continue
+		}
+		until := time.Until(date)
+		if until <= 0 {
+			return 0, errors.New("unlock date must be in the future")
+		}
+		blockTime := time.Duration(types.BlockFrequency) * time.Second
+		blocks := types.BlockHeight((until + blockTime - 1) / blockTime)
+		return n.ConsensusSet.Height() + blocks, nil
+	}
+	return 0, errors.New("unlock must be a block height or a date such as 2027-01-31")
+}
+
+// destinationHelper returns the address a send pays to. With an unlock height
+// or date the destination must be the recipient's public key, from which the
+// timelocked address is derived. Without one it is an address or a public key.
+func destinationHelper(destination string, unlock string) (types.UnlockHash, error) {
+	destination = strings.TrimSpace(destination)
+	height, err := unlockHeightHelper(unlock)
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	spk, err := scanPublicKey(destination)
+	if err != nil {
+		if height != 0 {
+			return types.UnlockHash{}, errors.New("a timelocked send needs the recipient's public key as its destination")
+		}
+		addr, err := scanAddress(destination)
+		if err != nil {
+			return types.UnlockHash{}, errors.New("destination is not valid")
+		}
+		return addr, nil
+	}
+	uc := types.UnlockConditions{PublicKeys: []types.SiaPublicKey{spk}, SignaturesRequired: 1, Timelock: height}
+	return uc.UnlockHash(), nil
+}
+
+// newTimelockedAddressHelper derives an address of the wallet that cannot be
+// spent from before the unlock height or date, and watches it. The address
+// belongs to the public key when one is given, so it matches the address a
+// sender derives from the same key and unlock height, and to a new key of the
+// wallet otherwise.
+func newTimelockedAddressHelper(wallet modules.Wallet, publicKey string, unlock string) (types.UnlockConditions, error) {
+	height, err := unlockHeightHelper(unlock)
+	if err != nil {
+		return types.UnlockConditions{}, err
+	}
+	if height <= n.ConsensusSet.Height() {
+		return types.UnlockConditions{}, fmt.Errorf("unlock height must be above the current height of %v", n.ConsensusSet.Height())
+	}
+	var uc types.UnlockConditions
+	if strings.TrimSpace(publicKey) != "" {
+		spk, err := scanPublicKey(strings.TrimSpace(publicKey))
+		if err != nil {
+			return uc, errors.New("public key is not valid")
+		}
+		uc = types.UnlockConditions{PublicKeys: []types.SiaPublicKey{spk}, SignaturesRequired: 1}
+	} else {
+		uc, err = wallet.NextAddress()
+		if err != nil {
+			return uc, err
+		}
+	}
+	uc.Timelock = height
+	if err := wallet.AddUnlockConditions(uc); err != nil {
+		return uc, err
+	}
+	if err := wallet.AddWatchAddresses([]types.UnlockHash{uc.UnlockHash()}, true); err != nil {
+		return uc, err
+	}
+	return uc, nil
+}
+
+// timelockedAddressesHelper lists the watched single signature addresses that
+// carry a timelock.
+func timelockedAddressesHelper(wallet modules.Wallet) ([]APITimelockedAddress, error) {
+	addrs, err := wallet.WatchAddresses()
+	if err != nil {
+		return nil, err
+	}
+	height := n.ConsensusSet.Height()
+	var timelocked []APITimelockedAddress
+	for _, addr := range addrs {
+		uc, err := wallet.UnlockConditions(addr)
+		if err != nil || uc.Timelock == 0 || isMultisig(uc) {
+			continue
+		}
+		timelocked = append(timelocked, APITimelockedAddress{
+			Address:          addr,
+			UnlockHeight:     uc.Timelock,
+			Unlocked:         uc.Timelock <= height,
+			UnlockConditions: uc,
+		})
+	}
+	return timelocked, nil
+}
+
+// claimTimelockedHelper moves the SCP outputs of the wallet's timelocked
+// addresses that have unlocked into a new address of the wallet.
+func claimTimelockedHelper(wallet modules.Wallet, feePerByte types.Currency) (types.Transaction, error) {
+	if !n.ConsensusSet.Synced() {
+		return types.Transaction{}, errors.New("cannot claim outputs until fully synced")
+	}
+	timelocked, err := timelockedAddressesHelper(wallet)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	ucs := make(map[types.UnlockHash]types.UnlockConditions)
+	for _, addr := range timelocked {
+		if addr.Unlocked {
+			ucs[addr.Address] = addr.UnlockConditions
+		}
+	}
+	watched, err := walletOutputsHelper(wallet, true)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	t := walletutil.OfflineTransaction{Height: n.ConsensusSet.Height()}
+	total := types.ZeroCurrency
+	for _, output := range watched {
+		uc, exists := ucs[output.Address]
+		if !exists || output.FundType != "SCP" {
+			continue
+		}
+		t.Transaction.SiacoinInputs = append(t.Transaction.SiacoinInputs, types.SiacoinInput{ParentID: types.SiacoinOutputID(output.ID), UnlockConditions: uc})
+		t.SiacoinParents = append(t.SiacoinParents, walletutil.SiacoinParent{
+			ID:     types.SiacoinOutputID(output.ID),
+			Output: types.SiacoinOutput{Value: output.Value, UnlockHash: output.Address},
+		})
+		total = total.Add(output.Value)
+	}
+	if len(t.Transaction.SiacoinInputs) == 0 {
+		return types.Transaction{}, errors.New("no timelocked SCP outputs have unlocked")
+	}
+	fee := feePerByte.Mul64(manualTxnSize(len(t.Transaction.SiacoinInputs), 1))
+	if total.Cmp(fee) <= 0 {
+		return types.Transaction{}, fmt.Errorf("the unlocked outputs do not cover the miner fee of %s", fmtPreviewValue("SCP", fee))
+	}
+	uc, err := wallet.NextAddress()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	t.Transaction.SiacoinOutputs = []types.SiacoinOutput{{Value: total.Sub(fee), UnlockHash: uc.UnlockHash()}}
+	t.Transaction.MinerFees = []types.Currency{fee}
+	if err := coSignHelper(wallet, &t); err != nil {
+		return types.Transaction{}, err
+	}
+	return broadcastOfflineHelper(wallet, t)
+}
+
+// timelockedRowsHelper renders the timelocked addresses as table rows.
+func timelockedRowsHelper(addrs []APITimelockedAddress) string {
+	rows := ""
+	for _, addr := range addrs {
+		state := "Locked"
+		if addr.Unlocked {
+			state = "Unlocked"
+		}
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%v</td><td>%s</td></tr>\n", strings.ToUpper(addr.Address.String()), addr.UnlockHeight, state)
+	}
+	if rows == "" {
+		rows = "<tr><td colspan='3'>The wallet has no timelocked addresses.</td></tr>"
+	}
+	return rows
+}
+
+func timelockedAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to generate timelocked address: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	uc, err := newTimelockedAddressHelper(wallet, req.FormValue("public_key"), req.FormValue("unlock"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	msg := fmt.Sprintf("Outputs sent to %s cannot be spent before block %v.", strings.ToUpper(uc.UnlockHash().String()), uc.Timelock)
+	writeMsg(w, "TIMELOCKED ADDRESS", msg, sessionID)
+}
+
+func claimTimelockedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to claim timelocked outputs: "
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	feePerByte, err := feePerByteHelper(req.FormValue("fee_level"), req.FormValue("fee_per_byte"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	txn, err := claimTimelockedHelper(wallet, feePerByte)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	writeMsg(w, "CLAIMED", fmt.Sprintf("Broadcast transaction %v.", txn.ID()), sessionID)
+}
+
+func apiTimelockedAddressesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return
+	}
+	addrs, err := timelockedAddressesHelper(wallet)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to retrieve timelocked addresses: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APITimelockedAddresses{Addresses: addrs})
+}
+
+func apiNewTimelockedAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiTimelockParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	uc, err := newTimelockedAddressHelper(wallet, params.PublicKey, params.Unlock)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to generate timelocked address: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APITimelockedAddress{Address: uc.UnlockHash(), UnlockHeight: uc.Timelock, UnlockConditions: uc})
+}
+
+func apiClaimTimelockedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	_, wallet, ok := apiSpendingWallet(w, req)
+	if !ok {
+		return
+	}
+	var params apiClaimParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	feePerByte, err := feePerByteHelper(params.FeeLevel, params.FeePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to claim timelocked outputs: %v", err))
+		return
+	}
+	txn, err := claimTimelockedHelper(wallet, feePerByte)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unable to claim timelocked outputs: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransactionIDs([]types.Transaction{txn}))
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+
+	"gitlab.com/scpcorp/webwallet/modules/apitokens"
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+type (
+	// APIToken is an api token as returned by the api. The secret is only
+	// populated when the token is created.
+	APIToken struct {
+		apitokens.Token
+		Secret string `json:"secret,omitempty"`
+	}
+
+	// APITokens lists api tokens.
+	APITokens struct {
+		Tokens []apitokens.Token `json:"tokens"`
+	}
+
+	// apiCreateTokenParams are the parameters used to create an api token.
+	apiCreateTokenParams struct {
+		Name    string          `json:"name"`
+		Scope   apitokens.Scope `json:"scope"`
+		Expires string          `json:"expires"`
+	}
+)
+
+// requireScope wraps an api handler so that it is only called when the
+// request carries a valid api token that includes the required scope.
+func requireScope(scope apitokens.Scope, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		secret := strings.TrimSpace(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+		if secret == "" {
+			writeJSONError(w, http.StatusUnauthorized, "An api token must be supplied in the Authorization header.")
+			return
+		}
+		token, err := apitokens.Validate(config.Dir, secret)
+		if errors.Is(err, apitokens.ErrInvalidToken) || errors.Is(err, apitokens.ErrExpiredToken) {
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to validate api token: %v", err))
+			return
+		}
+		if !token.Scope.Allows(scope) {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("api token scope %s does not allow %s calls", token.Scope, scope))
+			return
+		}
+		handle(w, req, ps)
+	}
+}
+
+// sweepExpiredTokens removes expired api tokens every time the frequency
+// elapses until the server stops.
+func sweepExpiredTokens(frequency time.Duration, stop chan struct{}) {
+	if frequency <= 0 {
+		return
+	}
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			removed, err := apitokens.RemoveExpired(config.Dir)
+			if err != nil {
+				fmt.Printf("Unable to remove expired api tokens: %v\n", err)
+			} else if removed > 0 {
+				fmt.Printf("Removed %d expired api tokens\n", removed)
+			}
+		}
+	}
+}
+
+func apiListTokensHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	tokens, err := apitokens.List(config.Dir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to list api tokens: %v", err))
+		return
+	}
+	if tokens == nil {
+		tokens = []apitokens.Token{}
+	}
+	writeJSON(w, http.StatusOK, APITokens{Tokens: tokens})
+}
+
+func apiCreateTokenHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to create api token: "
+	var params apiCreateTokenParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	var ttl time.Duration
+	if params.Expires != "" {
+		var err error
+		ttl, err = time.ParseDuration(params.Expires)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+			return
+		}
+	}
+	secret, token, err := apitokens.Create(config.Dir, params.Name, params.Scope, ttl)
+	if errors.Is(err, apitokens.ErrUnknownScope) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIToken{Token: token, Secret: secret})
+}
+
+func apiRevokeTokenHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	err := apitokens.Revoke(config.Dir, ps.ByName("id"))
+	if errors.Is(err, apitokens.ErrTokenNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to revoke api token: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errTokensLocked is returned when api tokens are managed from a session
+// whose wallet is not unlocked.
+var errTokensLocked = errors.New("an unlocked wallet is required to manage api tokens")
+
+// tokenWalletHelper returns the session's wallet when the session may manage
+// api tokens. Tokens grant access to the api of every wallet, so only a
+// session with an unlocked wallet that holds keys may manage them.
+func tokenWalletHelper(sessionID string) (modules.Wallet, error) {
+	wallet, err := getSpendingWallet(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	unlocked, err := wallet.Unlocked()
+	if err != nil {
+		return nil, err
+	}
+	if !unlocked {
+		return nil, errTokensLocked
+	}
+	return wallet, nil
+}
+
+func apiTokensFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if _, err := tokenWalletHelper(sessionID); err != nil {
+		msg := fmt.Sprintf("Unable to list api tokens: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	tokens, err := apitokens.List(config.Dir)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list api tokens: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	var rows string
+	for _, token := range tokens {
+		expires := "Never"
+		if !token.Expires.IsZero() {
+			expires = token.Expires.Format("2006-01-02 15:04")
+		}
+		revoke := fmt.Sprintf(`<form action="/gui/revokeApiToken?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="token_id" value="%s">
+      <input type="password" name="password" placeholder="Password">
+      <button class="small-button" type="submit">Revoke</button>
+    </form>`, token.ID)
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class=\"center\">%s</td></tr>\n",
+			html.EscapeString(token.Name), token.Scope, token.Created.Format("2006-01-02 15:04"), expires, revoke)
+	}
+	form := strings.Replace(resources.APITokensForm(), "&API_TOKENS;", rows, -1)
+	writeForm(w, "API TOKENS", form, sessionID)
+}
+
+func createAPITokenHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to create api token: "
+	wallet, err := tokenWalletHelper(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	err = confirmWalletPassword(wallet, req.FormValue("password"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	name := req.FormValue("name")
+	if name == "" {
+		msg := msgPrefix + "A name must be provided."
+		writeError(w, msg, sessionID)
+		return
+	}
+	scope, err := apitokens.ParseScope(req.FormValue("scope"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	days, err := strconv.Atoi(req.FormValue("expires_days"))
+	if err != nil || days < 0 {
+		msg := msgPrefix + "Expiration must be a whole number of days."
+		writeError(w, msg, sessionID)
+		return
+	}
+	secret, _, err := apitokens.Create(config.Dir, name, scope, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	msg := fmt.Sprintf("Copy the token now, it will not be shown again.<br><br><b>%s</b>", secret)
+	writeMsg(w, "API TOKEN CREATED", msg, sessionID)
+}
+
+func revokeAPITokenHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	var msgPrefix = "Unable to revoke api token: "
+	wallet, err := tokenWalletHelper(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	err = confirmWalletPassword(wallet, req.FormValue("password"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	err = apitokens.Revoke(config.Dir, req.FormValue("token_id"))
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	apiTokensFormHandler(w, req, nil)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -44,14 +45,18 @@ var (
 // SummarizedTransaction is a transaction that has been formatted for·
 // humans to read.
 type SummarizedTransaction struct {
-	TxnID     string  `json:"txn_id"`
-	Type      string  `json:"type"`
-	Time      string  `json:"time"`
-	Confirmed string  `json:"confirmed"`
-	Scp       float64 `json:"scp"`
-	ScpFee    float64 `json:"scp_fee"`
-	SpfA      float64 `json:"spfa"`
-	SpfB      float64 `json:"spfb"`
+	TxnID          string            `json:"txn_id"`
+	Type           string            `json:"type"`
+	Time           string            `json:"time"`
+	Timestamp      int64             `json:"timestamp"`
+	Height         types.BlockHeight `json:"height"`
+	Confirmed      string            `json:"confirmed"`
+	Scp            ExactCurrency     `json:"scp"`
+	ScpFee         ExactCurrency     `json:"scp_fee"`
+	SpfA           ExactCurrency     `json:"spfa"`
+	SpfB           ExactCurrency     `json:"spfb"`
+	Addresses      []string          `json:"addresses"`
+	Counterparties []string          `json:"counterparties"`
 }
 
 // ComputeSummarizedTransactions creates a set of SummarizedTransactions
@@ -70,11 +75,39 @@ func ComputeSummarizedTransactions(pts []modules.ProcessedTransaction, blockHeig
 
 		if uint64(txn.ConfirmationTimestamp) != unconfirmedTransactionTimestamp {
 			st.Time = time.Unix(int64(txn.ConfirmationTimestamp), 0).Format("2006-01-02 15:04")
+			st.Timestamp = int64(txn.ConfirmationTimestamp)
+			st.Height = txn.ConfirmationHeight
 			st.Confirmed = _stConfirmedStr
 		} else {
 			st.Confirmed = _stUnconfirmedStr
 		}
 
+		// Collect the addresses the transaction spends from and pays to, and
+		// the ones among them that do not belong to the wallet.
+		st.Addresses = []string{}
+		st.Counterparties = []string{}
+		seen := make(map[types.UnlockHash]bool)
+		related := []types.UnlockHash{}
+		walletAddress := make(map[types.UnlockHash]bool)
+		for _, input := range txn.Inputs {
+			related = append(related, input.RelatedAddress)
+			walletAddress[input.RelatedAddress] = walletAddress[input.RelatedAddress] || input.WalletAddress
+		}
+		for _, output := range txn.Outputs {
+			related = append(related, output.RelatedAddress)
+			walletAddress[output.RelatedAddress] = walletAddress[output.RelatedAddress] || output.WalletAddress
+		}
+		for _, addr := range related {
+			if addr == (types.UnlockHash{}) || seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			st.Addresses = append(st.Addresses, addr.String())
+			if !walletAddress[addr] {
+				st.Counterparties = append(st.Counterparties, addr.String())
+			}
+		}
+
 		// Determine the number of outgoing coins and funds.
 		var outgoingFundsA, outgoingFundsB types.Currency
 		outgoingTransaction := true
@@ -130,23 +163,10 @@ func ComputeSummarizedTransactions(pts []modules.ProcessedTransaction, blockHeig
 				minerFee = minerFee.Add(fee)
 			}
 		}
-		// Convert the scp to a float.
-		incomingCoinsFloat, _ := new(big.Rat).SetFrac(txn.ConfirmedIncomingValue.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-		outgoingCoinsFloat, _ := new(big.Rat).SetFrac(txn.ConfirmedOutgoingValue.Sub(minerFee).Big(), types.ScPrimecoinPrecision.Big()).Float64()
-
-		st.Scp = incomingCoinsFloat - outgoingCoinsFloat
-		scpFee, _ := new(big.Rat).SetFrac(minerFee.Big(), types.ScPrimecoinPrecision.Big()).Float64()
-		st.ScpFee = -1 * scpFee
-
-		// For funds, need to avoid having a negative types.Currency.
-		// Doing with floats, and for display float precision is more than enough.
-		incomingSPFA, _ := incomingFundsA.Float64()
-		outgoingSPFA, _ := outgoingFundsA.Float64()
-		st.SpfA = incomingSPFA - outgoingSPFA
-
-		incomingSPFB, _ := incomingFundsB.Float64()
-		outgoingSPFB, _ := outgoingFundsB.Float64()
-		st.SpfB = incomingSPFB - outgoingSPFB
+		st.Scp = NewExactCurrency(txn.ConfirmedIncomingValue).Sub(NewExactCurrency(txn.ConfirmedOutgoingValue.Sub(minerFee)))
+		st.ScpFee = NewExactCurrency(minerFee).Neg()
+		st.SpfA = NewExactFunds(incomingFundsA).Sub(NewExactFunds(outgoingFundsA))
+		st.SpfB = NewExactFunds(incomingFundsB).Sub(NewExactFunds(outgoingFundsB))
 
 		sts = append(sts, st)
 	}
@@ -209,3 +229,181 @@ func NewCurrencyStr(amount string) (types.Currency, error) {
 	}
 	return currency, nil
 }
+
+// DisplayUnits are the units SCP amounts can be displayed in.
+var DisplayUnits = []string{"H", "pS", "nS", "uS", "mS", "SCP", "KS", "MS", "GS", "TS"}
+
+// displayUnitExponent returns the power of ten of hastings in the display
+// unit.
+func displayUnitExponent(unit string) (int, bool) {
+	for i, u := range DisplayUnits {
+		if u == unit {
+			if i == 0 {
+				return 0, true
+			}
+			return 27 + 3*(i-5), true
+		}
+	}
+	return 0, false
+}
+
+// ExactCurrency is a signed amount of hastings, or of whole funds for SPF.
+// Unlike types.Currency it can be negative, and unlike a float64 it is never
+// rounded. It is encoded in JSON as an exact decimal string in SCP or SPF.
+type ExactCurrency struct {
+	value *big.Int
+	funds bool
+}
+
+// NewExactCurrency returns the exact amount of an SCP currency.
+func NewExactCurrency(c types.Currency) ExactCurrency {
+	return ExactCurrency{value: c.Big()}
+}
+
+// NewExactFunds returns the exact amount of an SPF currency.
+func NewExactFunds(c types.Currency) ExactCurrency {
+	return ExactCurrency{value: c.Big(), funds: true}
+}
+
+// ParseExactCurrency parses a decimal amount of SCP in the display unit, or
+// of whole funds when the unit is SPF.
+func ParseExactCurrency(amount string, unit string) (ExactCurrency, error) {
+	exp, ok := displayUnitExponent(unit)
+	if !ok && unit != "SPF" {
+		return ExactCurrency{}, ErrParseCurrencyUnits
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok {
+		return ExactCurrency{}, ErrParseCurrencyAmount
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)))
+	if !r.IsInt() {
+		return ExactCurrency{}, ErrParseCurrencyInteger
+	}
+	return ExactCurrency{value: new(big.Int).Set(r.Num()), funds: unit == "SPF"}, nil
+}
+
+// Big returns the amount in hastings or funds.
+func (c ExactCurrency) Big() *big.Int {
+	if c.value == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(c.value)
+}
+
+// Currency returns the amount as a types.Currency. Negative amounts cannot be
+// converted.
+func (c ExactCurrency) Currency() (types.Currency, error) {
+	if c.Sign() < 0 {
+		return types.Currency{}, ErrNegativeCurrency
+	}
+	return types.NewCurrency(c.Big()), nil
+}
+
+// Funds returns true when the amount is of SPF.
+func (c ExactCurrency) Funds() bool {
+	return c.funds
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of the amount.
+func (c ExactCurrency) Sign() int {
+	if c.value == nil {
+		return 0
+	}
+	return c.value.Sign()
+}
+
+// IsZero returns true when the amount is zero.
+func (c ExactCurrency) IsZero() bool {
+	return c.Sign() == 0
+}
+
+// Cmp compares the amounts and returns -1, 0 or 1.
+func (c ExactCurrency) Cmp(y ExactCurrency) int {
+	return c.Big().Cmp(y.Big())
+}
+
+// Add returns the sum of the amounts.
+func (c ExactCurrency) Add(y ExactCurrency) ExactCurrency {
+	return ExactCurrency{value: new(big.Int).Add(c.Big(), y.Big()), funds: c.funds}
+}
+
+// Sub returns the difference of the amounts.
+func (c ExactCurrency) Sub(y ExactCurrency) ExactCurrency {
+	return ExactCurrency{value: new(big.Int).Sub(c.Big(), y.Big()), funds: c.funds}
+}
+
+// Neg returns the negated amount.
+func (c ExactCurrency) Neg() ExactCurrency {
+	return ExactCurrency{value: new(big.Int).Neg(c.Big()), funds: c.funds}
+}
+
+// Abs returns the absolute amount.
+func (c ExactCurrency) Abs() ExactCurrency {
+	return ExactCurrency{value: new(big.Int).Abs(c.Big()), funds: c.funds}
+}
+
+// Rat returns the amount in SCP or SPF.
+func (c ExactCurrency) Rat() *big.Rat {
+	if c.funds {
+		return new(big.Rat).SetInt(c.Big())
+	}
+	return new(big.Rat).SetFrac(c.Big(), types.ScPrimecoinPrecision.Big())
+}
+
+// Float64 returns the amount in SCP or SPF, rounded to the nearest float64.
+// It is only meant for comparisons that do not need to be exact.
+func (c ExactCurrency) Float64() float64 {
+	f, _ := c.Rat().Float64()
+	return f
+}
+
+// Format returns the amount as an exact decimal in the display unit, without
+// the unit. Amounts of SPF are always whole funds. Unknown units are treated
+// as SCP.
+func (c ExactCurrency) Format(unit string) string {
+	exp, ok := displayUnitExponent(unit)
+	if !ok {
+		exp, _ = displayUnitExponent("SCP")
+	}
+	if c.funds {
+		exp = 0
+	}
+	s := new(big.Int).Abs(c.Big()).String()
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+		whole, fraction := s[:len(s)-exp], strings.TrimRight(s[len(s)-exp:], "0")
+		s = whole
+		if fraction != "" {
+			s += "." + fraction
+		}
+	}
+	if c.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// HumanString returns the amount in the display unit followed by the unit, or
+// by SPF for funds.
+func (c ExactCurrency) HumanString(unit string) string {
+	if c.funds {
+		return c.Format("") + " SPF"
+	}
+	if _, ok := displayUnitExponent(unit); !ok {
+		unit = "SCP"
+	}
+	return c.Format(unit) + " " + unit
+}
+
+// String returns the amount as an exact decimal in SCP or SPF.
+func (c ExactCurrency) String() string {
+	return c.Format("SCP")
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c ExactCurrency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// TestExactCurrencyRoundTrip checks that formatting an amount in every
+// display unit and parsing it back gives the same number of hastings.
+func TestExactCurrencyRoundTrip(t *testing.T) {
+	scp := types.ScPrimecoinPrecision
+	amounts := []types.Currency{
+		types.ZeroCurrency,
+		types.NewCurrency64(1),
+		types.NewCurrency64(7),
+		types.NewCurrency64(1000),
+		types.NewCurrency64(123456789),
+		scp.Div64(1000).Add(types.NewCurrency64(1)),
+		scp.Sub(types.NewCurrency64(1)),
+		scp,
+		scp.Mul64(3).Add(types.NewCurrency64(5)),
+		scp.Mul64(1e6).Add(scp.Div64(1e9)),
+		scp.Mul64(1e15).Add(types.NewCurrency64(1)),
+	}
+	for _, unit := range DisplayUnits {
+		for _, amount := range amounts {
+			formatted := NewExactCurrency(amount).Format(unit)
+			parsed, err := ParseExactCurrency(formatted, unit)
+			if err != nil {
+				t.Fatalf("%v H formatted in %s as %q did not parse: %v", amount, unit, formatted, err)
+			}
+			got, err := parsed.Currency()
+			if err != nil {
+				t.Fatalf("%v H formatted in %s as %q: %v", amount, unit, formatted, err)
+			}
+			if !got.Equals(amount) {
+				t.Fatalf("%v H formatted in %s as %q parsed as %v H", amount, unit, formatted, got)
+			}
+		}
+	}
+}
+
+// TestExactCurrencyFormat checks the decimals of amounts below a unit, which
+// need leading zeros after the point.
+func TestExactCurrencyFormat(t *testing.T) {
+	tests := []struct {
+		hastings string
+		unit     string
+		want     string
+	}{
+		{"0", "SCP", "0"},
+		{"0", "H", "0"},
+		{"1", "H", "1"},
+		{"1", "SCP", "0.000000000000000000000000001"},
+		{"1", "pS", "0.000000000000001"},
+		{"1000", "pS", "0.000000000001"},
+		{"1000000000000000", "pS", "1"},
+		{"5000000000000000000000000", "SCP", "0.005"},
+		{"1050000000000000000000000000", "SCP", "1.05"},
+		{"1000000000000000000000000000", "KS", "0.001"},
+		{"-1", "SCP", "-0.000000000000000000000000001"},
+		{"-2500000000000000000000000000", "SCP", "-2.5"},
+	}
+	for _, test := range tests {
+		value, ok := new(big.Int).SetString(test.hastings, 10)
+		if !ok {
+			t.Fatalf("bad test amount %s", test.hastings)
+		}
+		c := ExactCurrency{value: value}
+		if got := c.Format(test.unit); got != test.want {
+			t.Errorf("%s H in %s formatted as %q, expected %q", test.hastings, test.unit, got, test.want)
+		}
+		parsed, err := ParseExactCurrency(test.want, test.unit)
+		if err != nil {
+			t.Fatalf("%q %s did not parse: %v", test.want, test.unit, err)
+		}
+		if parsed.Cmp(c) != 0 {
+			t.Errorf("%q %s parsed as %s H, expected %s H", test.want, test.unit, parsed.Big(), test.hastings)
+		}
+	}
+}
+
+// TestExactCurrencyNegative checks that negative amounts round trip but
+// cannot be converted to a types.Currency.
+func TestExactCurrencyNegative(t *testing.T) {
+	c := NewExactCurrency(types.ScPrimecoinPrecision.Mul64(3)).Neg()
+	for _, unit := range DisplayUnits {
+		parsed, err := ParseExactCurrency(c.Format(unit), unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Cmp(c) != 0 {
+			t.Fatalf("%s formatted in %s parsed as %s", c.Big(), unit, parsed.Big())
+		}
+		if _, err := parsed.Currency(); !errors.Is(err, ErrNegativeCurrency) {
+			t.Fatalf("expected %v, got %v", ErrNegativeCurrency, err)
+		}
+	}
+}
+
+// TestExactFundsRoundTrip checks that SPF amounts are whole funds whatever
+// the display unit.
+func TestExactFundsRoundTrip(t *testing.T) {
+	for _, amount := range []uint64{0, 1, 15, 10000} {
+		funds := NewExactFunds(types.NewCurrency64(amount))
+		for _, unit := range append(DisplayUnits, "SPF") {
+			formatted := funds.Format(unit)
+			parsed, err := ParseExactCurrency(formatted, "SPF")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.Funds() {
+				t.Fatalf("%q SPF parsed as coins", formatted)
+			}
+			got, err := parsed.Currency()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equals64(amount) {
+				t.Fatalf("%d SPF formatted in %s as %q parsed as %v", amount, unit, formatted, got)
+			}
+		}
+		if got, want := funds.HumanString("KS"), funds.Format("")+" SPF"; got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+	if _, err := ParseExactCurrency("1.5", "SPF"); !errors.Is(err, ErrParseCurrencyInteger) {
+		t.Fatalf("expected %v, got %v", ErrParseCurrencyInteger, err)
+	}
+}
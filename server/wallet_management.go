@@ -0,0 +1,408 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/modules/wallet"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// ArchivedWalletsDir is the folder inside the wallets directory that archived
+// wallets are moved to.
+const ArchivedWalletsDir = "archived"
+
+var (
+	// walletNameRegexp matches the names that wallet directories may have.
+	walletNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+	errInvalidWalletName  = errors.New("wallet name must be 1 to 64 letters, digits, dots, dashes or underscores and start with a letter or digit")
+	errWalletNamePath     = errors.New("wallet name must not be empty or contain slashes or ..")
+	errReservedWalletName = fmt.Errorf("%s is a reserved wallet name", ArchivedWalletsDir)
+)
+
+type (
+	// apiRenameWalletParams are the parameters used to rename a wallet.
+	apiRenameWalletParams struct {
+		NewName string `json:"new_name"`
+	}
+
+	// apiDeleteWalletParams are the parameters used to delete a wallet.
+	apiDeleteWalletParams struct {
+		Password string `json:"password"`
+	}
+)
+
+// validateWalletName returns an error when the name cannot be used as a wallet
+// directory name.
+func validateWalletName(name string) error {
+	if !walletNameRegexp.MatchString(name) {
+		return errInvalidWalletName
+	}
+	if strings.EqualFold(name, ArchivedWalletsDir) {
+		return errReservedWalletName
+	}
+	return nil
+}
+
+// validateExistingWalletName returns an error when the name of an existing
+// wallet would reach outside the wallets directory. Wallets created before
+// names were validated keep working, so only new names must match
+// walletNameRegexp.
+func validateExistingWalletName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return errWalletNamePath
+	}
+	if strings.EqualFold(name, ArchivedWalletsDir) {
+		return errReservedWalletName
+	}
+	return nil
+}
+
+// walletPath returns the directory of the wallet, inside the archived folder
+// when archived is true.
+func walletPath(name string, archived bool) string {
+	if archived {
+		return filepath.Join(n.Dir, "wallets", ArchivedWalletsDir, name)
+	}
+	return filepath.Join(n.Dir, "wallets", name)
+}
+
+// closedWalletPath checks the name and returns the directory of the wallet
+// after checking that it exists and is not open in any session.
+func closedWalletPath(name string, archived bool) (string, error) {
+	if err := validateExistingWalletName(name); err != nil {
+		return "", err
+	}
+	dir := walletPath(name, archived)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return "", fmt.Errorf("%s does not exist", name)
+	} else if err != nil {
+		return "", err
+	}
+	if _, open := findOpenWallet(name); open && !archived {
+		return "", fmt.Errorf("%s is open, lock it first", name)
+	}
+	return dir, nil
+}
+
+// moveWallet moves a closed wallet directory, refusing to overwrite an
+// existing wallet.
+func moveWallet(name string, fromArchived bool, newName string, toArchived bool) error {
+	from, err := closedWalletPath(name, fromArchived)
+	if err != nil {
+		return err
+	}
+	if newName != name {
+		if err := validateWalletName(newName); err != nil {
+			return err
+		}
+	}
+	to := walletPath(newName, toArchived)
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("%s already exists", newName)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// renameWallet renames a closed wallet.
+func renameWallet(name string, newName string) error {
+	return moveWallet(name, false, newName, false)
+}
+
+// archiveWallet moves a closed wallet into the archived folder.
+func archiveWallet(name string) error {
+	return moveWallet(name, false, name, true)
+}
+
+// unarchiveWallet moves an archived wallet back into the wallets directory.
+func unarchiveWallet(name string) error {
+	return moveWallet(name, true, name, false)
+}
+
+// confirmWalletPassword returns an error when the wallet is encrypted and the
+// password is not valid.
+func confirmWalletPassword(w modules.Wallet, password string) error {
+	encrypted, err := w.Encrypted()
+	if err != nil || !encrypted {
+		return err
+	}
+	valid, err := isPasswordValid(w, password)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errInvalidPassword
+	}
+	return nil
+}
+
+// deleteWallet permanently deletes a wallet after confirming its password. A
+// wallet that is open in the session is closed first.
+func deleteWallet(name string, password string, archived bool, sessionID string) error {
+	session, _ := store.Get(sessionID)
+	for _, sw := range session.wallets {
+		if archived || sw.name != name {
+			continue
+		}
+		if err := confirmWalletPassword(sw.wallet, password); err != nil {
+			return err
+		}
+		if err := switchWallet(name, sessionID); err != nil {
+			return err
+		}
+		if err := closeActiveWallet(sessionID); err != nil {
+			return err
+		}
+		dir, err := closedWalletPath(name, archived)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(dir)
+	}
+	dir, err := closedWalletPath(name, archived)
+	if err != nil {
+		return err
+	}
+	w, err := wallet.NewCustomWallet(n.ConsensusSet, n.TransactionPool, dir, modules.ProdDependencies)
+	if err != nil {
+		return err
+	}
+	err = confirmWalletPassword(w, password)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// archivedWallets lists the names of the archived wallets.
+func archivedWallets() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(n.Dir, "wallets", ArchivedWalletsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// manageWalletActionsHelper returns the management forms for a wallet row.
+func manageWalletActionsHelper(name string, archived bool) string {
+	name = html.EscapeString(name)
+	action, label := "archiveWallet", "Archive"
+	if archived {
+		action, label = "unarchiveWallet", "Unarchive"
+	}
+	actions := fmt.Sprintf(`<form class="inline-block" action="/gui/%s?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="wallet_dir_name" value="%s">
+      <button class="small-button" type="submit">%s</button>
+    </form>`, action, name, label)
+	if !archived {
+		actions += fmt.Sprintf(`
+    <form class="inline-block" action="/gui/renameWallet?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="wallet_dir_name" value="%s">
+      <input type="text" name="new_wallet_dir_name" placeholder="New Name">
+      <button class="small-button" type="submit">Rename</button>
+    </form>`, name)
+	}
+	actions += fmt.Sprintf(`
+    <form class="inline-block" action="/gui/deleteWallet?&CACHE_BUSTER;" method="post">
+      <input type="hidden" name="session_id" value="&SESSION_ID;">
+      <input type="hidden" name="wallet_dir_name" value="%s">
+      <input type="hidden" name="archived" value="%t">
+      <input type="password" name="password" placeholder="Password">
+      <button class="small-button" type="submit">Delete</button>
+    </form>`, name, archived)
+	return actions
+}
+
+func manageWalletsFormHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	if req.FormValue("cancel") == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	wallets, err := listWallets(sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list wallets: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	var rows string
+	for _, wallet := range wallets {
+		state := "Closed"
+		if wallet.Unlocked {
+			state = "Unlocked"
+		} else if wallet.Open {
+			state = "Locked"
+		}
+		if wallet.WatchOnly {
+			state += ", Watch-Only"
+		}
+		actions := ""
+		if !wallet.Open {
+			actions = manageWalletActionsHelper(wallet.Name, false)
+		}
+		rows += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n", html.EscapeString(wallet.Name), state, actions)
+	}
+	archived, err := archivedWallets()
+	if err != nil {
+		msg := fmt.Sprintf("Unable to list archived wallets: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	for _, name := range archived {
+		rows += fmt.Sprintf("<tr><td>%s</td><td>Archived</td><td>%s</td></tr>\n", html.EscapeString(name), manageWalletActionsHelper(name, true))
+	}
+	form := strings.Replace(resources.ManageWalletsForm(), "&WALLETS;", rows, -1)
+	writeForm(w, "MANAGE WALLETS", form, sessionID)
+}
+
+func renameWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	err := renameWallet(req.FormValue("wallet_dir_name"), req.FormValue("new_wallet_dir_name"))
+	if err != nil {
+		msg := fmt.Sprintf("Unable to rename wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	manageWalletsFormHandler(w, req, nil)
+}
+
+func archiveWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	err := archiveWallet(req.FormValue("wallet_dir_name"))
+	if err != nil {
+		msg := fmt.Sprintf("Unable to archive wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	manageWalletsFormHandler(w, req, nil)
+}
+
+func unarchiveWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	err := unarchiveWallet(req.FormValue("wallet_dir_name"))
+	if err != nil {
+		msg := fmt.Sprintf("Unable to unarchive wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	manageWalletsFormHandler(w, req, nil)
+}
+
+func deleteWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		redirect(w, req, nil)
+		return
+	}
+	name := req.FormValue("wallet_dir_name")
+	archived := req.FormValue("archived") == "true"
+	err := deleteWallet(name, req.FormValue("password"), archived, sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	msg := fmt.Sprintf("Wallet %s was permanently deleted.", name)
+	writeMsg(w, "WALLET DELETED", msg, sessionID)
+}
+
+// apiWalletManagementError writes the error with a status code that matches
+// its cause.
+func apiWalletManagementError(w http.ResponseWriter, msgPrefix string, err error) {
+	switch {
+	case errors.Is(err, errInvalidWalletName), errors.Is(err, errReservedWalletName):
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+	case errors.Is(err, errInvalidPassword):
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("%s%v", msgPrefix, err))
+	default:
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+	}
+}
+
+func apiRenameWalletHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var params apiRenameWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	err := renameWallet(ps.ByName("name"), params.NewName)
+	if err != nil {
+		apiWalletManagementError(w, "Unable to rename wallet: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiArchiveWalletHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	err := archiveWallet(ps.ByName("name"))
+	if err != nil {
+		apiWalletManagementError(w, "Unable to archive wallet: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiUnarchiveWalletHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	err := unarchiveWallet(ps.ByName("name"))
+	if err != nil {
+		apiWalletManagementError(w, "Unable to unarchive wallet: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiDeleteWalletHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var params apiDeleteWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	archived := req.URL.Query().Get("archived") == "true"
+	err := deleteWallet(ps.ByName("name"), params.Password, archived, apiSessionID(req))
+	if err != nil {
+		apiWalletManagementError(w, "Unable to delete wallet: ", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// sessionWallet is a wallet module that is open in a session.
+type sessionWallet struct {
+	name   string
+	wallet modules.Wallet
+}
+
+type (
+	// WalletInfo describes a wallet directory and the state of its wallet.
+	// Encrypted is nil for a closed wallet, whose state is unknown until it
+	// is loaded.
+	WalletInfo struct {
+		Name      string `json:"name"`
+		Open      bool   `json:"open"`
+		Active    bool   `json:"active"`
+		Encrypted *bool  `json:"encrypted"`
+		Unlocked  bool   `json:"unlocked"`
+		WatchOnly bool   `json:"watch_only"`
+	}
+
+	// APIWallets lists the wallet directories.
+	APIWallets struct {
+		Wallets []WalletInfo `json:"wallets"`
+	}
+
+	// APIAggregateBalances lists the balances summed across every unlocked
+	// wallet that is open in the session.
+	APIAggregateBalances struct {
+		Wallets                int            `json:"wallets"`
+		ScpBalance             types.Currency `json:"scp_balance"`
+		ScpClaimBalance        types.Currency `json:"scp_claim_balance"`
+		ScpUnconfirmedIncoming types.Currency `json:"scp_unconfirmed_incoming"`
+		ScpUnconfirmedOutgoing types.Currency `json:"scp_unconfirmed_outgoing"`
+		SpfaBalance            types.Currency `json:"spfa_balance"`
+		SpfbBalance            types.Currency `json:"spfb_balance"`
+		ScpHeldBalance         types.Currency `json:"scp_held_balance"`
+		SpfaHeldBalance        types.Currency `json:"spfa_held_balance"`
+		SpfbHeldBalance        types.Currency `json:"spfb_held_balance"`
+	}
+
+	// apiSwitchWalletParams are the parameters used to switch the active wallet.
+	apiSwitchWalletParams struct {
+		WalletName string `json:"wallet_name"`
+	}
+)
+
+// findOpenWallet returns the wallet module with the supplied name when it is
+// open in any session.
+func findOpenWallet(walletDirName string) (modules.Wallet, bool) {
+	for _, sessionID := range store.IDs() {
+		session, _ := store.Get(sessionID)
+		for _, sw := range session.wallets {
+			if sw.name == walletDirName {
+				return sw.wallet, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// listWallets lists every wallet directory along with the state of its wallet.
+func listWallets(sessionID string) ([]WalletInfo, error) {
+	walletsDir := filepath.Join(n.Dir, "wallets")
+	entries, err := os.ReadDir(walletsDir)
+	if os.IsNotExist(err) {
+		return []WalletInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	session, _ := store.Get(sessionID)
+	wallets := []WalletInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == ArchivedWalletsDir {
+			continue
+		}
+		info := WalletInfo{Name: entry.Name(), Active: session.name == entry.Name(), WatchOnly: isWatchOnlyWallet(entry.Name())}
+		wallet, open := findOpenWallet(info.Name)
+		if open {
+			info.Open = true
+			if encrypted, err := wallet.Encrypted(); err == nil {
+				info.Encrypted = &encrypted
+			}
+			info.Unlocked, _ = wallet.Unlocked()
+		}
+		wallets = append(wallets, info)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Name < wallets[j].Name })
+	return wallets, nil
+}
+
+// switchWallet makes the open wallet with the supplied name the session's
+// active wallet.
+func switchWallet(walletDirName string, sessionID string) error {
+	var switched bool
+	found := store.Update(sessionID, func(session *Session) {
+		for _, sw := range session.wallets {
+			if sw.name == walletDirName {
+				session.wallet = sw.wallet
+				session.name = sw.name
+				switched = true
+				return
+			}
+		}
+	})
+	if !found {
+		return errSessionNotFound
+	}
+	if !switched {
+		return fmt.Errorf("%s is not open in this session", walletDirName)
+	}
+	return nil
+}
+
+// aggregateBalancesHelper sums the balances of every unlocked wallet that is
+// open in the session.
+func aggregateBalancesHelper(sessionID string) (APIAggregateBalances, error) {
+	var bals APIAggregateBalances
+	session, _ := store.Get(sessionID)
+	for _, sw := range session.wallets {
+		unlocked, err := sw.wallet.Unlocked()
+		if err != nil {
+			return bals, err
+		}
+		if !unlocked {
+			continue
+		}
+		allBals, held, err := confirmedBalanceHelper(sw.wallet)
+		if err != nil {
+			return bals, err
+		}
+		scpOut, scpIn, err := sw.wallet.UnconfirmedBalance()
+		if err != nil {
+			return bals, err
+		}
+		bals.Wallets++
+		bals.ScpBalance = bals.ScpBalance.Add(allBals.CoinBalance)
+		bals.ScpClaimBalance = bals.ScpClaimBalance.Add(allBals.ClaimBalance)
+		bals.ScpUnconfirmedIncoming = bals.ScpUnconfirmedIncoming.Add(scpIn)
+		bals.ScpUnconfirmedOutgoing = bals.ScpUnconfirmedOutgoing.Add(scpOut)
+		bals.SpfaBalance = bals.SpfaBalance.Add(allBals.FundBalance)
+		bals.SpfbBalance = bals.SpfbBalance.Add(allBals.FundbBalance)
+		bals.ScpHeldBalance = bals.ScpHeldBalance.Add(held.CoinBalance)
+		bals.SpfaHeldBalance = bals.SpfaHeldBalance.Add(held.FundBalance)
+		bals.SpfbHeldBalance = bals.SpfbHeldBalance.Add(held.FundbBalance)
+	}
+	return bals, nil
+}
+
+// walletSwitcherHelper returns the menu's wallet switcher, or an empty string
+// when fewer than two wallets are open in the session.
+func walletSwitcherHelper(sessionID string) string {
+	session, _ := store.Get(sessionID)
+	if len(session.wallets) < 2 {
+		return ""
+	}
+	options := ""
+	for _, sw := range session.wallets {
+		selected := ""
+		if sw.name == session.name {
+			selected = " selected"
+		}
+		name := html.EscapeString(sw.name)
+		options = options + fmt.Sprintf("<option value='%s'%s>%s</option>", name, selected, name)
+	}
+	form := resources.WalletSwitcherForm()
+	return strings.Replace(form, "&WALLET_OPTIONS;", options, -1)
+}
+
+// aggregateBalanceHelper returns the formatted SCP balance summed across the
+// session's unlocked wallets, or an empty string when fewer than two are open.
+func aggregateBalanceHelper(sessionID string) string {
+	bals, err := aggregateBalancesHelper(sessionID)
+	if err != nil || bals.Wallets < 2 {
+		return ""
+	}
+	return fmt.Sprintf("<div>Total Across %d Wallets: %s</div>", bals.Wallets, NewExactCurrency(bals.ScpBalance).HumanString(getDisplayUnit(sessionID)))
+}
+
+func switchWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" || !sessionIDExists(sessionID) {
+		msg := "Session ID does not exist."
+		writeError(w, msg, "")
+		return
+	}
+	err := switchWallet(req.FormValue("wallet_dir_name"), sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to switch wallet: %v", err)
+		writeError(w, msg, sessionID)
+		return
+	}
+	guiHandler(w, req, nil)
+}
+
+func apiWalletsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	wallets, err := listWallets(apiSessionID(req))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to list wallets: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, APIWallets{Wallets: wallets})
+}
+
+func apiSwitchWalletHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	var params apiSwitchWalletParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	err := switchWallet(params.WalletName, sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unable to switch wallet: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiAggregateBalanceHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sessionID, _, ok := apiWallet(w, req, false)
+	if !ok {
+		return
+	}
+	bals, err := aggregateBalancesHelper(sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to obtain balance: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, bals)
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/modules"
+	"gitlab.com/scpcorp/ScPrime/types"
+
+	"gitlab.com/scpcorp/webwallet/resources"
+)
+
+// OperationWatching is the operation type of the scan that follows the
+// creation of a watch-only wallet.
+const OperationWatching = "Watching"
+
+// watchOnlyMarker is the file that marks a wallet directory as watch-only.
+const watchOnlyMarker = "watchonly"
+
+// errWatchOnly is returned when a watch-only wallet is asked to spend or to
+// reveal its seed.
+var errWatchOnly = errors.New("this is a watch-only wallet, it holds no keys for the addresses it watches")
+
+// apiWatchOnlyParams are the parameters used to create a watch-only wallet.
+// Addresses holds addresses or ed25519 public keys.
+type apiWatchOnlyParams struct {
+	WalletName       string                   `json:"wallet_name"`
+	Password         string                   `json:"password"`
+	Addresses        []string                 `json:"addresses"`
+	UnlockConditions []types.UnlockConditions `json:"unlock_conditions"`
+}
+
+// watchList is the set of addresses a watch-only wallet tracks along with the
+// unlock conditions that were supplied for them.
+type watchList struct {
+	addresses        []types.UnlockHash
+	unlockConditions []types.UnlockConditions
+	seen             map[types.UnlockHash]bool
+	seenConditions   map[types.UnlockHash]bool
+}
+
+// addAddress adds the address to the list unless it is already on it.
+func (l *watchList) addAddress(addr types.UnlockHash) {
+	if l.seen == nil {
+		l.seen = make(map[types.UnlockHash]bool)
+	}
+	if !l.seen[addr] {
+		l.seen[addr] = true
+		l.addresses = append(l.addresses, addr)
+	}
+}
+
+// addUnlockConditions adds the unlock conditions and their address to the list.
+func (l *watchList) addUnlockConditions(uc types.UnlockConditions) {
+	addr := uc.UnlockHash()
+	l.addAddress(addr)
+	if l.seenConditions == nil {
+		l.seenConditions = make(map[types.UnlockHash]bool)
+	}
+	if !l.seenConditions[addr] {
+		l.seenConditions[addr] = true
+		l.unlockConditions = append(l.unlockConditions, uc)
+	}
+}
+
+// merge adds the entries of another list to the list.
+func (l *watchList) merge(other watchList) {
+	for _, uc := range other.unlockConditions {
+		l.addUnlockConditions(uc)
+	}
+	for _, addr := range other.addresses {
+		l.addAddress(addr)
+	}
+}
+
+// addEntry adds an address, an ed25519 public key or a JSON encoded set of
+// unlock conditions to the list. A public key is watched through the standard
+// single signature unlock conditions built from it.
+func (l *watchList) addEntry(entry string) error {
+	entry = strings.TrimSpace(entry)
+	switch {
+	case strings.HasPrefix(entry, "{"):
+		var uc types.UnlockConditions
+		if err := json.Unmarshal([]byte(entry), &uc); err != nil {
+			return fmt.Errorf("unable to read unlock conditions: %v", err)
+		}
+		l.addUnlockConditions(uc)
+	case strings.HasPrefix(strings.ToLower(entry), types.SignatureEd25519.String()+":"):
+		spk, err := scanPublicKey(entry)
+		if err != nil {
+			return fmt.Errorf("%s is not a valid public key", entry)
+		}
+		l.addUnlockConditions(types.UnlockConditions{PublicKeys: []types.SiaPublicKey{spk}, SignaturesRequired: 1})
+	default:
+		addr, err := scanAddress(entry)
+		if err != nil {
+			return fmt.Errorf("%s is not a valid address", entry)
+		}
+		l.addAddress(addr)
+	}
+	return nil
+}
+
+// parseWatchListHelper reads a watch list from text that is either a JSON
+// array of entries or one entry per line. Blank lines and lines starting with
+// # are skipped.
+func parseWatchListHelper(text string) (watchList, error) {
+	var list watchList
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "[") {
+		var entries []json.RawMessage
+		if err := json.Unmarshal([]byte(text), &entries); err != nil {
+			return list, fmt.Errorf("unable to read watch list: %v", err)
+		}
+		for _, raw := range entries {
+			entry := string(raw)
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				entry = s
+			}
+			if err := list.addEntry(entry); err != nil {
+				return list, err
+			}
+		}
+		return list, nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := list.addEntry(line); err != nil {
+			return list, err
+		}
+	}
+	return list, nil
+}
+
+// isWatchOnlyWallet returns true when the wallet directory is marked as
+// watch-only.
+func isWatchOnlyWallet(walletDirName string) bool {
+	_, err := os.Stat(filepath.Join(walletPath(walletDirName, false), watchOnlyMarker))
+	return err == nil
+}
+
+// watchOnlySession returns true when the session's active wallet is watch-only.
+func watchOnlySession(sessionID string) bool {
+	session, err := getSession(sessionID)
+	return err == nil && session.name != "" && isWatchOnlyWallet(session.name)
+}
+
+// getSpendingWallet returns the session's active wallet unless it is
+// watch-only.
+func getSpendingWallet(sessionID string) (modules.Wallet, error) {
+	if watchOnlySession(sessionID) {
+		return nil, errWatchOnly
+	}
+	return getWallet(sessionID)
+}
+
+// apiSpendingWallet returns the session's unlocked wallet, writing an error
+// when it cannot be found, is locked or is watch-only.
+func apiSpendingWallet(w http.ResponseWriter, req *http.Request) (string, modules.Wallet, bool) {
+	sessionID, wallet, ok := apiWallet(w, req, true)
+	if !ok {
+		return "", nil, false
+	}
+	if watchOnlySession(sessionID) {
+		writeJSONError(w, http.StatusForbidden, "Wallet is watch-only.")
+		return "", nil, false
+	}
+	return sessionID, wallet, true
+}
+
+// watchOnlyMenuHelper disables the menu buttons that need the wallet's keys.
+func watchOnlyMenuHelper(menu string) string {
+	for _, label := range []string{"Recover Seed", "Send Coins", "Multisend Coins", "Consolidate Outputs", "Sweep Seed"} {
+		button := fmt.Sprintf("<button class=\"input-wide\" type=\"submit\">%s</button>", label)
+		disabled := fmt.Sprintf("<button class=\"input-wide\" type=\"submit\" title=\"Disabled for watch-only wallets\" disabled>%s</button>", label)
+		menu = strings.Replace(menu, button, disabled, -1)
+	}
+	return menu
+}
+
+// createWatchOnlyHelper creates a wallet that watches the addresses of the
+// list. The wallet is encrypted with a random seed that is never shown, so
+// the password only guards who can view it, and marked as watch-only before
+// any of its addresses are added. When it cannot be created the session that
+// was added for it is removed, along with the new wallet's directory.
+func createWatchOnlyHelper(walletDirName string, password string, list watchList, added bool, sessionID string) (err error) {
+	if len(list.addresses) == 0 {
+		return errors.New("at least one address, public key or set of unlock conditions must be provided")
+	}
+	wallet, err := newWallet(walletDirName, sessionID)
+	if err != nil {
+		if added {
+			discardSession(sessionID)
+		}
+		return err
+	}
+	defer func() {
+		if err != nil {
+			discardNewWallet(walletDirName, added, sessionID)
+		}
+	}()
+	encrypted, err := wallet.Encrypted()
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return errors.New("seed is already initialized")
+	}
+	marker := filepath.Join(walletPath(walletDirName, false), watchOnlyMarker)
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		return err
+	}
+	startOperation(OperationWatching, sessionID)
+	go watchOnlyHelper(wallet, walletDirName, password, list, sessionID)
+	return nil
+}
+
+// watchOnlyHelper encrypts and unlocks the watch-only wallet and then rescans
+// the blockchain for the watched addresses. When a step fails the wallet is
+// closed and its directory removed, keeping the session to show the alert.
+func watchOnlyHelper(wallet modules.Wallet, walletDirName string, password string, list watchList, sessionID string) {
+	msgPrefix := "Unable to create watch-only wallet: "
+	fail := func(err error) {
+		discardNewWallet(walletDirName, false, sessionID)
+		setAlert(fmt.Sprintf("%s%v", msgPrefix, err), sessionID)
+		finishOperation(OperationWatching, err, sessionID)
+	}
+	encryptionKey := crypto.NewWalletKey(crypto.HashObject(password))
+	if _, err := wallet.Encrypt(encryptionKey); err != nil {
+		fail(err)
+		return
+	}
+	if err := unlockWallet(wallet, password); err != nil {
+		fail(err)
+		return
+	}
+	for _, uc := range list.unlockConditions {
+		if err := wallet.AddUnlockConditions(uc); err != nil {
+			fail(err)
+			return
+		}
+	}
+	if err := wallet.AddWatchAddresses(list.addresses, false); err != nil {
+		fail(err)
+		return
+	}
+	finishOperation(OperationWatching, nil, sessionID)
+}
+
+// watchListFromRequest reads the watch list pasted into the form and the one
+// uploaded with it, if any.
+func watchListFromRequest(req *http.Request) (watchList, error) {
+	text := req.FormValue("watch_list")
+	file, _, err := req.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		b, err := io.ReadAll(file)
+		if err != nil {
+			return watchList{}, fmt.Errorf("unable to upload watch list: %v", err)
+		}
+		if strings.TrimSpace(text) != "" {
+			list, err := parseWatchListHelper(text)
+			if err != nil {
+				return list, err
+			}
+			uploaded, err := parseWatchListHelper(string(b))
+			if err != nil {
+				return list, err
+			}
+			list.merge(uploaded)
+			return list, nil
+		}
+		text = string(b)
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return watchList{}, fmt.Errorf("unable to upload watch list: %v", err)
+	}
+	return parseWatchListHelper(text)
+}
+
+func alertWatchOnlyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeStaticHTML(w, resources.WatchOnlyForm(), "")
+}
+
+func watchOnlyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	cancel := req.FormValue("cancel")
+	walletDirName := req.FormValue("wallet_dir_name")
+	if walletDirName == "" {
+		walletDirName = "wallet"
+	}
+	newPassword := req.FormValue("new_password")
+	confirmPassword := req.FormValue("confirm_password")
+	var msgPrefix = "Unable to create watch-only wallet: "
+	if cancel == "true" {
+		guiHandler(w, req, nil)
+		return
+	}
+	if len(newPassword) < 8 {
+		msg := msgPrefix + "Password must be at least eight characters long."
+		writeError(w, msg, "")
+		return
+	}
+	if newPassword != confirmPassword {
+		msg := msgPrefix + "New password does not match confirmation password."
+		writeError(w, msg, "")
+		return
+	}
+	list, err := watchListFromRequest(req)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, "")
+		return
+	}
+	sessionID := addSessionID()
+	err = createWatchOnlyHelper(walletDirName, newPassword, list, true, sessionID)
+	if err != nil {
+		msg := fmt.Sprintf("%s%v", msgPrefix, err)
+		writeError(w, msg, "")
+		return
+	}
+	title := "<font class='status &STATUS_COLOR;'>&STATUS;</font> WALLET"
+	form := resources.ScanningWalletForm()
+	writeForm(w, title, form, sessionID)
+}
+
+func apiWatchOnlyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var msgPrefix = "Unable to create watch-only wallet: "
+	var params apiWatchOnlyParams
+	if !apiDecodeParams(w, req, &params) {
+		return
+	}
+	if params.WalletName == "" {
+		params.WalletName = "wallet"
+	}
+	if len(params.Password) < 8 {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"Password must be at least eight characters long.")
+		return
+	}
+	var list watchList
+	for _, entry := range params.Addresses {
+		if err := list.addEntry(entry); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s%v", msgPrefix, err))
+			return
+		}
+	}
+	for _, uc := range params.UnlockConditions {
+		list.addUnlockConditions(uc)
+	}
+	if len(list.addresses) == 0 {
+		writeJSONError(w, http.StatusBadRequest, msgPrefix+"At least one address, public key or set of unlock conditions must be provided.")
+		return
+	}
+	sessionID, added := apiSessionOrNew(req)
+	err := createWatchOnlyHelper(params.WalletName, params.Password, list, added, sessionID)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("%s%v", msgPrefix, err))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, APISession{SessionID: sessionID})
+}
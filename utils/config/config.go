@@ -15,4 +15,6 @@ type WebWalletConfig struct {
 	Port                          int
 	Dir                           string
 	CheckTokenExpirationFrequency time.Duration
+	SessionIdleTimeout            time.Duration
+	PersistSessions               bool
 }
@@ -0,0 +1,276 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/scpcorp/ScPrime/crypto"
+	"gitlab.com/scpcorp/ScPrime/types"
+)
+
+// MaxSignAddresses is the number of addresses of a seed that are searched for
+// the keys of an offline transaction's inputs.
+const MaxSignAddresses = 10000
+
+type (
+	// SignatureCount is the number of signatures an input of a transaction
+	// has and the number its unlock conditions require.
+	SignatureCount struct {
+		ParentID crypto.Hash `json:"parent_id"`
+		Signed   uint64      `json:"signed"`
+		Required uint64      `json:"required"`
+	}
+
+	// SiacoinParent is an SCP output spent by an offline transaction.
+	SiacoinParent struct {
+		ID     types.SiacoinOutputID `json:"id"`
+		Output types.SiacoinOutput   `json:"output"`
+	}
+
+	// SiafundParent is an SPF output spent by an offline transaction.
+	SiafundParent struct {
+		ID     types.SiafundOutputID `json:"id"`
+		Output types.SiafundOutput   `json:"output"`
+	}
+
+	// OfflineTransaction is a transaction that is built by a watch-only wallet
+	// and signed by an offline wallet holding the seed. It carries the outputs
+	// its inputs spend so the offline wallet can find their keys and show what
+	// is being signed, and the height its signatures are made for.
+	OfflineTransaction struct {
+		Transaction    types.Transaction `json:"transaction"`
+		SiacoinParents []SiacoinParent   `json:"siacoin_parents"`
+		SiafundParents []SiafundParent   `json:"siafund_parents"`
+		Height         types.BlockHeight `json:"height"`
+	}
+)
+
+// Owners maps the parent ids of the transaction's inputs to the addresses
+// they spend from.
+func (t *OfflineTransaction) Owners() map[crypto.Hash]types.UnlockHash {
+	owners := make(map[crypto.Hash]types.UnlockHash)
+	for _, parent := range t.SiacoinParents {
+		owners[crypto.Hash(parent.ID)] = parent.Output.UnlockHash
+	}
+	for _, parent := range t.SiafundParents {
+		owners[crypto.Hash(parent.ID)] = parent.Output.UnlockHash
+	}
+	return owners
+}
+
+// Summary describes what the transaction spends and pays so it can be checked
+// before it is signed.
+func (t *OfflineTransaction) Summary() string {
+	var lines []string
+	coins := types.ZeroCurrency
+	for _, parent := range t.SiacoinParents {
+		coins = coins.Add(parent.Output.Value)
+	}
+	funds := types.ZeroCurrency
+	for _, parent := range t.SiafundParents {
+		funds = funds.Add(parent.Output.Value)
+	}
+	lines = append(lines, fmt.Sprintf("Spends %s and %s SPF from %d outputs.", coins.HumanString(), funds, len(t.SiacoinParents)+len(t.SiafundParents)))
+	for _, sco := range t.Transaction.SiacoinOutputs {
+		lines = append(lines, fmt.Sprintf("Pays %s to %s.", sco.Value.HumanString(), sco.UnlockHash))
+	}
+	for _, sfo := range t.Transaction.SiafundOutputs {
+		lines = append(lines, fmt.Sprintf("Pays %s SPF to %s.", sfo.Value, sfo.UnlockHash))
+	}
+	fees := types.ZeroCurrency
+	for _, fee := range t.Transaction.MinerFees {
+		fees = fees.Add(fee)
+	}
+	lines = append(lines, fmt.Sprintf("Miner fee: %s.", fees.HumanString()))
+	return strings.Join(lines, "\n")
+}
+
+// SignWithSeed signs the inputs that spend from the seed's first
+// MaxSignAddresses addresses, and co-signs the multisig inputs that list one
+// of their public keys. It returns the number of signatures added.
+func (t *OfflineTransaction) SignWithSeed(seed Seed) (int, error) {
+	owners := t.Owners()
+	needed := make(map[string]bool)
+	for _, owner := range owners {
+		needed[owner.String()] = true
+	}
+	for _, input := range transactionInputs(t.Transaction) {
+		for _, pk := range input.uc.PublicKeys {
+			needed[pk.String()] = true
+		}
+	}
+	keys := make(map[types.UnlockHash]SpendableKey)
+	secretKeys := make(map[string]crypto.SecretKey)
+	for i := uint64(0); i < MaxSignAddresses && len(needed) != 0; i++ {
+		key := GetAddress(seed, i)
+		addr := key.UnlockConditions.UnlockHash()
+		pk := key.UnlockConditions.PublicKeys[0].String()
+		if needed[addr.String()] {
+			keys[addr] = key
+			delete(needed, addr.String())
+		}
+		if needed[pk] {
+			secretKeys[pk] = key.SecretKeys[0]
+			delete(needed, pk)
+		}
+	}
+	signed := SignTransaction(&t.Transaction, keys, owners, t.Height)
+	signed += CoSignTransaction(&t.Transaction, secretKeys, t.Height)
+	if signed == 0 {
+		return 0, fmt.Errorf("none of the inputs spend from the first %d addresses of the seed", MaxSignAddresses)
+	}
+	return signed, nil
+}
+
+// SignTransaction signs every unsigned input of the transaction whose owner
+// is one of the keys, filling in the unlock conditions of inputs that were
+// built without them. owners maps the parent ids of the inputs to the
+// addresses they spend from. It returns the number of signatures added.
+func SignTransaction(txn *types.Transaction, keys map[types.UnlockHash]SpendableKey, owners map[crypto.Hash]types.UnlockHash, height types.BlockHeight) int {
+	var empty types.UnlockConditions
+	for i, sci := range txn.SiacoinInputs {
+		key, exists := keys[owners[crypto.Hash(sci.ParentID)]]
+		if exists && sci.UnlockConditions.UnlockHash() == empty.UnlockHash() {
+			txn.SiacoinInputs[i].UnlockConditions = key.UnlockConditions
+		}
+	}
+	for i, sfi := range txn.SiafundInputs {
+		key, exists := keys[owners[crypto.Hash(sfi.ParentID)]]
+		if exists && sfi.UnlockConditions.UnlockHash() == empty.UnlockHash() {
+			txn.SiafundInputs[i].UnlockConditions = key.UnlockConditions
+		}
+	}
+	signed := 0
+	for i, sig := range txn.TransactionSignatures {
+		key, exists := keys[owners[sig.ParentID]]
+		if !exists || len(sig.Signature) != 0 || sig.PublicKeyIndex >= uint64(len(key.SecretKeys)) {
+			continue
+		}
+		encodedSig := crypto.SignHash(txn.SigHash(i, height), key.SecretKeys[sig.PublicKeyIndex])
+		txn.TransactionSignatures[i].Signature = encodedSig[:]
+		signed++
+	}
+	return signed
+}
+
+// CoSignTransaction adds a signature for every public key of an input's
+// unlock conditions that has a secret key in keys, until the input has as
+// many signatures as it requires. keys maps public keys in their string form
+// to their secret keys. Signatures cover the whole transaction except the
+// other signatures, so co-signers can add theirs in any order. It returns the
+// number of signatures added.
+func CoSignTransaction(txn *types.Transaction, keys map[string]crypto.SecretKey, height types.BlockHeight) int {
+	signed := 0
+	for _, input := range transactionInputs(*txn) {
+		parentID, uc := input.parentID, input.uc
+		for index, pk := range uc.PublicKeys {
+			if countSignatures(*txn, parentID) >= uc.SignaturesRequired {
+				break
+			}
+			sk, exists := keys[pk.String()]
+			if !exists {
+				continue
+			}
+			i := -1
+			for j, sig := range txn.TransactionSignatures {
+				if sig.ParentID == parentID && sig.PublicKeyIndex == uint64(index) {
+					i = j
+				}
+			}
+			if i == -1 {
+				txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+					ParentID:       parentID,
+					CoveredFields:  types.CoveredFields{WholeTransaction: true},
+					PublicKeyIndex: uint64(index),
+				})
+				i = len(txn.TransactionSignatures) - 1
+			} else if len(txn.TransactionSignatures[i].Signature) != 0 {
+				continue
+			}
+			encodedSig := crypto.SignHash(txn.SigHash(i, height), sk)
+			txn.TransactionSignatures[i].Signature = encodedSig[:]
+			signed++
+		}
+	}
+	return signed
+}
+
+// SignatureCounts returns the number of signatures each input of the
+// transaction has and requires, in input order.
+func SignatureCounts(txn types.Transaction) []SignatureCount {
+	var counts []SignatureCount
+	for _, input := range transactionInputs(txn) {
+		counts = append(counts, SignatureCount{ParentID: input.parentID, Signed: countSignatures(txn, input.parentID), Required: input.uc.SignaturesRequired})
+	}
+	return counts
+}
+
+// CheckSigned returns an error when an input of the transaction has fewer
+// signatures than it requires or carries an empty signature.
+func CheckSigned(txn types.Transaction) error {
+	for _, sig := range txn.TransactionSignatures {
+		if len(sig.Signature) == 0 {
+			return errors.New("the transaction is not fully signed")
+		}
+	}
+	for _, count := range SignatureCounts(txn) {
+		if count.Signed < count.Required {
+			return fmt.Errorf("input %v has %d of the %d signatures it requires", count.ParentID, count.Signed, count.Required)
+		}
+	}
+	return nil
+}
+
+// txnInput is the parent id and the unlock conditions of an input.
+type txnInput struct {
+	parentID crypto.Hash
+	uc       types.UnlockConditions
+}
+
+// transactionInputs returns the SCP and then the SPF inputs of the
+// transaction.
+func transactionInputs(txn types.Transaction) []txnInput {
+	var inputs []txnInput
+	for _, sci := range txn.SiacoinInputs {
+		inputs = append(inputs, txnInput{parentID: crypto.Hash(sci.ParentID), uc: sci.UnlockConditions})
+	}
+	for _, sfi := range txn.SiafundInputs {
+		inputs = append(inputs, txnInput{parentID: crypto.Hash(sfi.ParentID), uc: sfi.UnlockConditions})
+	}
+	return inputs
+}
+
+// countSignatures returns the number of non-empty signatures of the input.
+func countSignatures(txn types.Transaction, parentID crypto.Hash) uint64 {
+	var count uint64
+	for _, sig := range txn.TransactionSignatures {
+		if sig.ParentID == parentID && len(sig.Signature) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// NewMultisigUnlockConditions returns the unlock conditions of an address
+// that requires required of the public keys to sign. The order of the keys
+// is part of the address, so co-signers must list them in the same order.
+func NewMultisigUnlockConditions(publicKeys []types.SiaPublicKey, required uint64) (types.UnlockConditions, error) {
+	if len(publicKeys) < 2 {
+		return types.UnlockConditions{}, errors.New("a multisig address needs at least two public keys")
+	}
+	if required < 1 || required > uint64(len(publicKeys)) {
+		return types.UnlockConditions{}, fmt.Errorf("the number of signatures required must be between 1 and %d", len(publicKeys))
+	}
+	seen := make(map[string]bool)
+	for _, pk := range publicKeys {
+		if pk.Algorithm != types.SignatureEd25519 || len(pk.Key) != crypto.PublicKeySize {
+			return types.UnlockConditions{}, fmt.Errorf("%s is not a valid ed25519 public key", pk)
+		}
+		if seen[pk.String()] {
+			return types.UnlockConditions{}, fmt.Errorf("%s is listed more than once", pk)
+		}
+		seen[pk.String()] = true
+	}
+	return types.UnlockConditions{PublicKeys: publicKeys, SignaturesRequired: required}, nil
+}